@@ -35,7 +35,7 @@ func NewClient(serverURL string) *Client {
 }
 
 // Upscale sends an image to the server for upscaling and downloads the result to the specified output path.
-func (c *Client) Upscale(inputPath, outputPath string, scale int, model string) error {
+func (c *Client) Upscale(inputPath, outputPath string, scale float64, model string) error {
     file, err := os.Open(inputPath)
     if err != nil {
         return fmt.Errorf("failed to open input: %w", err)
@@ -51,7 +51,7 @@ func (c *Client) Upscale(inputPath, outputPath string, scale int, model string)
     }
     io.Copy(part, file)
 
-    writer.WriteField("scale", fmt.Sprintf("%d", scale))
+    writer.WriteField("scale", fmt.Sprintf("%g", scale))
     if model != "" {
         writer.WriteField("model_name", model)
     }
@@ -142,7 +142,7 @@ func main() {
     serverURL := flag.String("server", "http://localhost:8080", "Server URL")
     inputFile := flag.String("input", "", "Input image file")
     outputFile := flag.String("output", "upscaled.png", "Output image file")
-    scale := flag.Int("scale", 4, "Scale factor")
+    scale := flag.Float64("scale", 4, "Scale factor (may be fractional, e.g. 1.5)")
     model := flag.String("model", "realesrgan-x4plus", "Model name")
     listModels := flag.Bool("list-models", false, "List available models")
     showVersion := flag.Bool("version", false, "Show version")
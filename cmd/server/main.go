@@ -4,11 +4,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -44,12 +50,47 @@ func main() {
     if !filepath.IsAbs(cfg.Upscaler.ModelsPath) {
         cfg.Upscaler.ModelsPath = filepath.Join(getBaseDir(), cfg.Upscaler.ModelsPath)
     }
+    if cfg.Upscaler.WorkDir != "" && !filepath.IsAbs(cfg.Upscaler.WorkDir) {
+        cfg.Upscaler.WorkDir = filepath.Join(getBaseDir(), cfg.Upscaler.WorkDir)
+    }
     if !filepath.IsAbs(cfg.Storage.UploadDir) {
         cfg.Storage.UploadDir = filepath.Join(getBaseDir(), cfg.Storage.UploadDir)
     }
     if !filepath.IsAbs(cfg.Storage.OutputDir) {
         cfg.Storage.OutputDir = filepath.Join(getBaseDir(), cfg.Storage.OutputDir)
     }
+    if cfg.Storage.JobJournal != "" && !filepath.IsAbs(cfg.Storage.JobJournal) {
+        cfg.Storage.JobJournal = filepath.Join(getBaseDir(), cfg.Storage.JobJournal)
+    }
+
+    jobStore := upscaler.NewMemoryStore()
+    if cfg.Storage.JobStore == "journal" {
+        jobStore, err = upscaler.NewJournalStore(cfg.Storage.JobJournal)
+        if err != nil {
+            log.Fatalf("Failed to open job journal: %v", err)
+        }
+    }
+
+    devices := make([]upscaler.Device, 0, len(cfg.Upscaler.Devices))
+    for _, d := range cfg.Upscaler.Devices {
+        devices = append(devices, upscaler.Device{
+            Name:    d.Name,
+            Kind:    d.Kind,
+            GPUID:   d.GPUID,
+            Workers: d.Workers,
+        })
+    }
+
+    engines := make([]upscaler.EngineConfig, 0, len(cfg.Upscaler.Engines))
+    for _, e := range cfg.Upscaler.Engines {
+        engines = append(engines, upscaler.EngineConfig{
+            Type:       e.Type,
+            Name:       e.Name,
+            BinaryPath: e.BinaryPath,
+            ModelsPath: e.ModelsPath,
+            Threads:    e.Threads,
+        })
+    }
 
     // Initialize services
     upscalerService := upscaler.NewService(upscaler.Config{
@@ -60,7 +101,46 @@ func main() {
         Threads:      cfg.Upscaler.Threads,
         EnableGPU:    cfg.Upscaler.EnableGPU,
         GPUID:        cfg.Upscaler.GPUID,
+        Engines:      engines,
+        Devices:      devices,
+        ResampleFallback: cfg.Upscaler.ResampleFallback,
+        WorkDir:          cfg.Upscaler.WorkDir,
+        SplitTileSize:    cfg.Upscaler.SplitTileSize,
+        SplitOverlap:     cfg.Upscaler.SplitOverlap,
+        SplitThresholdMP: cfg.Upscaler.SplitThresholdMP,
+        Store:            jobStore,
+        MaxQueueSize:     cfg.Limits.MaxQueueSize,
+        TimeoutMin:         time.Duration(cfg.Limits.JobTimeoutMinSeconds) * time.Second,
+        TimeoutMax:         time.Duration(cfg.Limits.JobTimeoutMaxSeconds) * time.Second,
+        TimeoutPerMP:       time.Duration(cfg.Limits.JobTimeoutPerMegapixelSeconds) * time.Second,
+        TimeoutOverrideMax: time.Duration(cfg.Limits.JobTimeoutOverrideMaxSeconds) * time.Second,
+        MaxRetries:       cfg.Upscaler.MaxRetries,
+        RetryBackoff:     time.Duration(cfg.Upscaler.RetryBackoffSeconds) * time.Second,
+        CPUFallback:      cfg.Upscaler.CPUFallback,
+        PriorityAging:    time.Duration(cfg.Upscaler.PriorityAgingSeconds) * time.Second,
+        HistoryMaxJobs:   cfg.Storage.JobHistoryMaxJobs,
+        HistoryMaxAge:    time.Duration(cfg.Storage.JobHistoryMaxAgeHours) * time.Hour,
+        DownloadTokens:   cfg.Server.DownloadTokens,
+        MaxBatchSize:     cfg.Limits.MaxBatchSize,
+        ModelsPollInterval: time.Duration(cfg.Upscaler.ModelsPollSeconds) * time.Second,
     })
+    defer upscalerService.Close()
+
+    // Check the model files before jobs can use them
+    if _, err := upscalerService.VerifyModels(); err != nil {
+        log.Printf("Failed to verify models: %v", err)
+    }
+
+    // Re-queue jobs that were queued or interrupted by a crash or restart
+    if resumed, err := upscalerService.ResumeJobs(); err != nil {
+        log.Printf("Failed to resume jobs: %v", err)
+    } else if resumed > 0 {
+        log.Printf("Resumed %d interrupted job(s)", resumed)
+    }
+
+    // Log job transitions; subscribe before the workers start
+    events, _ := upscalerService.Subscribe(256)
+    go logEvents(events)
 
     // Start workers
     upscalerService.StartWorkers(cfg.Limits.MaxConcurrentJobs)
@@ -71,21 +151,40 @@ func main() {
         MaxFileSizeMB:   cfg.Storage.MaxFileSizeMB,
         CleanupTTL:      15 * time.Minute, // Hardcoded to 15 mins per requirement
         RetentionPolicy: cfg.Storage.RetentionPolicy,
+        InUse:           upscalerService.UsesFile,
     })
     if err != nil {
         log.Fatalf("Failed to initialize storage: %v", err)
     }
 
+    // Stop on SIGINT/SIGTERM
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    // Reload the model catalogue when models are added, removed or replaced
+    go upscalerService.WatchModels(ctx)
+
     // Start cleanup routine
+    cleanupDone := make(chan struct{})
     go func() {
+        defer close(cleanupDone)
+
         // Run cleanup every minute
         ticker := time.NewTicker(1 * time.Minute)
         defer ticker.Stop()
 
-        for range ticker.C {
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
             if err := storageManager.CleanupOldFiles(); err != nil {
                 log.Printf("Cleanup failed: %v", err)
             }
+            if evicted := upscalerService.PruneHistory(); evicted > 0 {
+                log.Printf("Evicted %d finished job(s) from the history", evicted)
+            }
         }
     }()
 
@@ -108,18 +207,35 @@ func main() {
     // API Group with optional Auth
     apiGroup := router.Group(cfg.Server.APIPrefix)
 
-    if cfg.Server.AuthToken != "" {
+    tokens := authTokens(cfg.Server)
+    if len(tokens) > 0 {
         log.Println("Authentication enabled")
-        apiGroup.Use(api.AuthMiddleware(cfg.Server.AuthToken))
     }
+    if !slices.ContainsFunc(tokens, func(t api.Token) bool { return t.Principal.Admin }) {
+        log.Println("No admin token configured, admin endpoints are disabled")
+    }
+    apiGroup.Use(api.AuthMiddleware(tokens), api.IDParamsMiddleware())
 
     {
         apiGroup.POST("/upscale", handler.HandleUpscale)
+        apiGroup.POST("/estimate", handler.HandleEstimate)
         apiGroup.GET("/download/:job_id", handler.HandleDownload)
         apiGroup.GET("/status/:job_id", handler.HandleStatus)
+        apiGroup.GET("/status/:job_id/events", handler.HandleEvents)
         apiGroup.POST("/cancel/:job_id", handler.HandleCancel)
+        apiGroup.POST("/batch", handler.HandleBatch)
+        apiGroup.GET("/batch/:batch_id", handler.HandleBatchStatus)
+        apiGroup.GET("/batch/:batch_id/download", handler.HandleBatchDownload)
         apiGroup.GET("/models", handler.HandleModels)
         apiGroup.GET("/health", handler.HandleHealth)
+
+        adminGroup := apiGroup.Group("/admin", api.AdminMiddleware())
+        adminGroup.POST("/jobs/:job_id/priority", handler.HandleSetPriority)
+        adminGroup.GET("/queue", handler.HandleQueue)
+        adminGroup.POST("/queue/pause", handler.HandlePause)
+        adminGroup.POST("/queue/resume", handler.HandleResume)
+        adminGroup.POST("/maintenance", handler.HandleMaintenance)
+        adminGroup.POST("/models/verify", handler.HandleVerifyModels)
     }
 
     // Swagger UI
@@ -138,9 +254,78 @@ func main() {
     addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
     log.Printf("Server listening on %s%s", addr, cfg.Server.APIPrefix)
 
-    if err := router.Run(addr); err != nil {
+    server := &http.Server{Addr: addr, Handler: router}
+    serverErr := make(chan error, 1)
+    go func() {
+        serverErr <- server.ListenAndServe()
+    }()
+
+    select {
+    case err := <-serverErr:
         log.Fatal(err)
+    case <-ctx.Done():
+    }
+    stop()
+
+    // Reject new uploads while running jobs drain; status and downloads keep working
+    drain := cfg.GetShutdownDrain()
+    log.Printf("Shutting down, waiting up to %s for running jobs", drain)
+    drainCtx, cancelDrain := context.WithTimeout(context.Background(), drain)
+    if err := upscalerService.Shutdown(drainCtx); err != nil {
+        log.Printf("Running jobs interrupted, they are resumed on the next start")
+    }
+    cancelDrain()
+
+    // Wait for open requests, but do not hang on event streams
+    shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancelShutdown()
+    if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+        log.Printf("HTTP server shutdown failed: %v", err)
+    }
+    <-cleanupDone
+
+    log.Printf("Server stopped")
+}
+
+// logEvents writes the status transitions of all jobs to the log.
+func logEvents(events <-chan upscaler.Event) {
+    for e := range events {
+        switch e.Type {
+        case upscaler.EventProgress, upscaler.EventStage, upscaler.EventExpired:
+            continue
+        case upscaler.EventModelsChanged:
+            // Logged by the service with the models kept for running jobs
+            continue
+        }
+        if e.Error != "" {
+            log.Printf("Job %s %s (%s): %s", e.JobID, e.Type, e.ErrorCode, e.Error)
+        } else {
+            log.Printf("Job %s %s", e.JobID, e.Type)
+        }
+    }
+}
+
+// authTokens builds the accepted auth tokens. The main auth_token has full
+// permissions; additional tokens default to normal priority without admin rights.
+func authTokens(cfg config.ServerConfig) []api.Token {
+    tokens := make([]api.Token, 0, len(cfg.Tokens)+1)
+    if cfg.AuthToken != "" {
+        tokens = append(tokens, api.Token{
+            Value:     cfg.AuthToken,
+            Principal: api.Principal{Name: "default", MaxPriority: upscaler.PriorityHigh, Admin: true},
+        })
     }
+
+    for _, t := range cfg.Tokens {
+        // Validated by config.Load
+        maxPriority, _ := upscaler.ParsePriority(t.MaxPriority)
+        tokens = append(tokens, api.Token{
+            Value:     t.Token,
+            Principal: api.Principal{Name: t.Name, MaxPriority: maxPriority, Admin: t.Admin},
+        })
+    }
+
+    return tokens
 }
 
 // getBaseDir returns the directory where the executable is located.
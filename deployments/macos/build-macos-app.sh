@@ -40,6 +40,8 @@ chmod +x "$MACOS_DIR/bin/realesrgan-ncnn-vulkan"
 
 # Copy models (from downloaded zip or project - the zip includes them)
 cp "$BUILD_DIR/realesrgan/models/"* "$MACOS_DIR/models/"
+# Model manifests live in the project
+cp "$SCRIPT_DIR/../../models/"*.yaml "$MACOS_DIR/models/"
 
 # Build Go binary (assumes Go is installed)
 cd "$SCRIPT_DIR/../.."
@@ -0,0 +1,471 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upscale-service/internal/ids"
+	"upscale-service/internal/upscaler"
+)
+
+// maxArchiveEntries is the number of entries read from an uploaded archive,
+// images or not, before it is rejected.
+const maxArchiveEntries = 10000
+
+// imageExtensions are the file types taken from uploaded archives.
+var imageExtensions = map[string]bool{
+    ".png":  true,
+    ".jpg":  true,
+    ".jpeg": true,
+    ".webp": true,
+}
+
+// batchUpload is a saved image of a batch.
+type batchUpload struct {
+    // name is the file name, or the path inside the uploaded archive.
+    name string
+    path string
+}
+
+// HandleBatch accepts many images as one batch with shared parameters. Images
+// are sent as repeated 'image' parts and/or as 'archive' parts holding a zip,
+// tar or tar.gz file.
+func (h *Handler) HandleBatch(c *gin.Context) {
+    req, ok := h.bindUpscaleRequest(c)
+    if !ok {
+        return
+    }
+
+    form, err := c.MultipartForm()
+    if err != nil {
+        c.JSON(http.StatusBadRequest, UpscaleResponse{
+            Success: false,
+            Error:   fmt.Sprintf("invalid multipart form: %v", err),
+        })
+        return
+    }
+
+    uploads := make([]batchUpload, 0)
+    discard := func() {
+        for _, u := range uploads {
+            _ = h.storage.DeleteFile(u.path)
+        }
+    }
+    add := func(name string, r io.Reader) error {
+        if maxItems := h.upscaler.MaxBatchSize(); maxItems > 0 && len(uploads) >= maxItems {
+            return fmt.Errorf("batch exceeds the maximum of %d images", maxItems)
+        }
+
+        limit := h.storage.MaxFileSize()
+        data, err := io.ReadAll(io.LimitReader(r, limit+1))
+        if err != nil {
+            return fmt.Errorf("failed to read %s: %w", name, err)
+        }
+        if int64(len(data)) > limit {
+            return fmt.Errorf("%s is larger than %d MB", name, limit/(1024*1024))
+        }
+
+        inputPath, err := h.storage.SaveUpload(path.Base(name), data)
+        if err != nil {
+            return fmt.Errorf("failed to save %s: %w", name, err)
+        }
+        uploads = append(uploads, batchUpload{name: name, path: inputPath})
+        return nil
+    }
+
+    for _, fh := range form.File["image"] {
+        if err = addFile(fh, func(f multipart.File) error {
+            return add(path.Base(filepath.ToSlash(fh.Filename)), f)
+        }); err != nil {
+            break
+        }
+    }
+    for _, fh := range form.File["archive"] {
+        if err != nil {
+            break
+        }
+        err = addFile(fh, func(f multipart.File) error {
+            return readArchive(f, fh.Size, add)
+        })
+    }
+    if err != nil {
+        discard()
+        c.JSON(http.StatusBadRequest, UpscaleResponse{
+            Success: false,
+            Error:   fmt.Sprintf("invalid batch upload: %v", err),
+        })
+        return
+    }
+
+    if len(uploads) == 0 {
+        c.JSON(http.StatusBadRequest, UpscaleResponse{
+            Success: false,
+            Error:   "no images provided",
+        })
+        return
+    }
+
+    reqs := make([]upscaler.Request, len(uploads))
+    for i, u := range uploads {
+        jobID := ids.New()
+        reqs[i] = req.request(u.path, h.storage.GetOutputPath(jobID, u.name))
+        reqs[i].JobID = jobID
+        reqs[i].Name = u.name
+    }
+
+    batch, err := h.upscaler.SubmitBatch(reqs)
+    if err != nil {
+        discard()
+        submitFailed(c, err)
+        return
+    }
+
+    items := make([]gin.H, len(batch.Jobs))
+    for i, job := range batch.Jobs {
+        items[i] = gin.H{
+            "index":  job.Request.BatchItem,
+            "name":   job.Request.Name,
+            "job_id": job.ID,
+        }
+    }
+
+    response := gin.H{
+        "success":    true,
+        "batch_id":   batch.ID,
+        "status_url": "/api/v1/batch/" + batch.ID,
+        "items":      items,
+    }
+    if token := batch.Jobs[0].DownloadToken; token != "" {
+        response["download_token"] = token
+    }
+
+    c.JSON(http.StatusAccepted, response)
+}
+
+// addFile opens an uploaded file and passes it to fn.
+func addFile(fh *multipart.FileHeader, fn func(f multipart.File) error) error {
+    f, err := fh.Open()
+    if err != nil {
+        return fmt.Errorf("failed to read %s: %w", fh.Filename, err)
+    }
+    defer f.Close()
+
+    return fn(f)
+}
+
+// readArchive passes the images in a zip, tar or tar.gz archive to add. The
+// format is detected from the content.
+func readArchive(f multipart.File, size int64, add func(name string, r io.Reader) error) error {
+    magic := make([]byte, 512)
+    n, _ := f.ReadAt(magic, 0)
+    magic = magic[:n]
+
+    switch {
+    case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+        return readZip(f, size, add)
+    case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+        gz, err := gzip.NewReader(f)
+        if err != nil {
+            return fmt.Errorf("invalid gzip archive: %w", err)
+        }
+        defer gz.Close()
+        return readTar(gz, add)
+    case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+        return readTar(f, add)
+    default:
+        return errors.New("unsupported archive, use zip, tar or tar.gz")
+    }
+}
+
+// readZip passes the images in a zip archive to add.
+func readZip(f io.ReaderAt, size int64, add func(name string, r io.Reader) error) error {
+    zr, err := zip.NewReader(f, size)
+    if err != nil {
+        return fmt.Errorf("invalid zip archive: %w", err)
+    }
+    if len(zr.File) > maxArchiveEntries {
+        return fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+    }
+
+    for _, zf := range zr.File {
+        name, ok := archiveImageName(zf.Name)
+        if !ok || zf.FileInfo().IsDir() {
+            continue
+        }
+
+        rc, err := zf.Open()
+        if err != nil {
+            return fmt.Errorf("failed to read %s: %w", name, err)
+        }
+        err = add(name, rc)
+        rc.Close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// readTar passes the images in a tar stream to add.
+func readTar(r io.Reader, add func(name string, r io.Reader) error) error {
+    tr := tar.NewReader(r)
+    for entries := 0; ; entries++ {
+        if entries >= maxArchiveEntries {
+            return fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+        }
+
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return fmt.Errorf("invalid tar archive: %w", err)
+        }
+
+        name, ok := archiveImageName(hdr.Name)
+        if !ok || hdr.Typeflag != tar.TypeReg {
+            continue
+        }
+        if err := add(name, tr); err != nil {
+            return err
+        }
+    }
+}
+
+// archiveImageName cleans the path of an archive entry and makes it relative
+// to the archive root. It reports false for entries that are not images, are
+// hidden or hold macOS metadata.
+func archiveImageName(name string) (string, bool) {
+    name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+    if name == "" {
+        return "", false
+    }
+
+    for _, part := range strings.Split(name, "/") {
+        if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+            return "", false
+        }
+    }
+
+    return name, imageExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// batchNotFound answers a request for an unknown batch: 410 Gone with the
+// tombstones of its jobs if the batch was evicted from the history, 404
+// otherwise.
+func (h *Handler) batchNotFound(c *gin.Context, batchID string) {
+    tombstones := h.upscaler.BatchTombstones(batchID)
+    if len(tombstones) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "batch not found"})
+        return
+    }
+
+    var expiredAt time.Time
+    items := make([]gin.H, len(tombstones))
+    for i, t := range tombstones {
+        items[i] = gin.H{
+            "job_id":      t.ID,
+            "status":      t.Status,
+            "finished_at": t.FinishedAt.Format(time.RFC3339),
+        }
+        if t.ExpiredAt.After(expiredAt) {
+            expiredAt = t.ExpiredAt
+        }
+    }
+
+    c.JSON(http.StatusGone, gin.H{
+        "error":      "batch expired",
+        "batch_id":   batchID,
+        "expired_at": expiredAt.Format(time.RFC3339),
+        "items":      items,
+    })
+}
+
+// HandleBatchStatus returns the aggregate status of a batch and the status of
+// each of its items.
+func (h *Handler) HandleBatchStatus(c *gin.Context) {
+    batchID := c.Param("batch_id")
+
+    batch, ok := h.upscaler.GetBatch(batchID)
+    if !ok {
+        h.batchNotFound(c, batchID)
+        return
+    }
+
+    items := make([]gin.H, len(batch.Jobs))
+    for i, job := range batch.Jobs {
+        item := gin.H{
+            "index":    job.Request.BatchItem,
+            "name":     job.Request.Name,
+            "job_id":   job.ID,
+            "status":   job.Status,
+            "progress": job.Progress,
+        }
+        if (job.Status == "failed" || job.Status == "timed_out") && job.Error != nil {
+            item["error"] = job.Error.Error()
+        }
+        if job.ErrorCode != "" {
+            item["error_code"] = job.ErrorCode
+        }
+        items[i] = item
+    }
+
+    response := gin.H{
+        "batch_id": batch.ID,
+        "status":   batch.Status,
+        "progress": batch.Progress,
+        "total":    len(batch.Jobs),
+        "counts":   batch.Counts,
+        "items":    items,
+    }
+    if batch.Counts["completed"] > 0 {
+        response["download_url"] = "/api/v1/batch/" + batch.ID + "/download"
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+// HandleBatchDownload streams the completed outputs of a batch as a zip
+// archive. Items that are not included are listed in errors.txt.
+func (h *Handler) HandleBatchDownload(c *gin.Context) {
+    batchID := c.Param("batch_id")
+
+    batch, ok := h.upscaler.GetBatch(batchID)
+    if !ok {
+        h.batchNotFound(c, batchID)
+        return
+    }
+
+    token := batch.Jobs[0].DownloadToken
+    if token != "" && subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(token)) != 1 {
+        c.JSON(http.StatusForbidden, gin.H{"error": "invalid download token"})
+        return
+    }
+
+    if batch.Counts["completed"] == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":  "no completed items",
+            "status": batch.Status,
+        })
+        return
+    }
+
+    c.Header("Content-Description", "File Transfer")
+    c.Header("Content-Disposition", "attachment; filename=batch_"+batch.ID+".zip")
+    c.Header("Content-Type", "application/zip")
+
+    // Images are compressed already, store them as they are
+    zw := zip.NewWriter(c.Writer)
+    used := make(map[string]bool)
+    written := make([]string, 0, len(batch.Jobs))
+    var missing strings.Builder
+
+    for _, job := range batch.Jobs {
+        if job.Status != "completed" || job.Result == nil {
+            reason := job.Status
+            if job.Error != nil {
+                reason += ": " + job.Error.Error()
+            }
+            fmt.Fprintf(&missing, "%s (%s): %s\n", job.Request.Name, job.ID, reason)
+            continue
+        }
+
+        name := batchEntryName(job, used)
+        if err := copyToZip(zw, name, job.Result.OutputPath); err != nil {
+            if errors.Is(err, os.ErrNotExist) {
+                fmt.Fprintf(&missing, "%s (%s): output file missing\n", job.Request.Name, job.ID)
+                continue
+            }
+            // The response has started, all we can do is abort it
+            log.Printf("Batch %s: failed to write %s: %v", batch.ID, name, err)
+            return
+        }
+        written = append(written, job.Result.OutputPath)
+    }
+
+    if missing.Len() > 0 {
+        w, err := zw.CreateHeader(&zip.FileHeader{Name: "errors.txt", Method: zip.Deflate})
+        if err == nil {
+            _, err = io.WriteString(w, missing.String())
+        }
+        if err != nil {
+            log.Printf("Batch %s: failed to write errors.txt: %v", batch.ID, err)
+            return
+        }
+    }
+    if err := zw.Close(); err != nil {
+        log.Printf("Batch %s: failed to finish archive: %v", batch.ID, err)
+        return
+    }
+
+    // Delete after download if policy dictates
+    if h.storage.ShouldDeleteAfterDownload() {
+        for _, p := range written {
+            if err := h.storage.DeleteFile(p); err != nil {
+                log.Printf("Failed to delete file after download: %v", err)
+            }
+        }
+    }
+}
+
+// batchEntryName returns the archive name of an item's output: its upload
+// name with the output's extension, made unique with the item index.
+func batchEntryName(job *upscaler.Job, used map[string]bool) string {
+    base := job.Request.Name
+    if base == "" {
+        base = fmt.Sprintf("item_%d", job.Request.BatchItem)
+    }
+    stem := strings.TrimSuffix(base, path.Ext(base))
+    ext := filepath.Ext(job.Result.OutputPath)
+
+    name := stem + ext
+    if used[name] {
+        name = fmt.Sprintf("%s_%d%s", stem, job.Request.BatchItem, ext)
+    }
+    used[name] = true
+    return name
+}
+
+// copyToZip adds the file at src to the archive without compression.
+func copyToZip(zw *zip.Writer, name, src string) error {
+    f, err := os.Open(src)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    info, err := f.Stat()
+    if err != nil {
+        return err
+    }
+
+    w, err := zw.CreateHeader(&zip.FileHeader{
+        Name:     name,
+        Method:   zip.Store,
+        Modified: info.ModTime(),
+    })
+    if err != nil {
+        return err
+    }
+    _, err = io.Copy(w, f)
+    return err
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"upscale-service/internal/storage"
+	"upscale-service/internal/upscaler"
+)
+
+// archiveEntry is a file or directory of a test archive.
+type archiveEntry struct {
+    name string
+    size int
+    // link makes the entry a symbolic link (tar only).
+    link bool
+}
+
+// archiveFile serves an in-memory archive as an uploaded file.
+type archiveFile struct {
+    *bytes.Reader
+}
+
+func (archiveFile) Close() error { return nil }
+
+// makeArchive builds a zip, tar or tar.gz archive with the given entries.
+func makeArchive(t *testing.T, format string, entries []archiveEntry) []byte {
+    t.Helper()
+
+    var buf bytes.Buffer
+    switch format {
+    case "zip":
+        zw := zip.NewWriter(&buf)
+        for _, e := range entries {
+            w, err := zw.Create(e.name)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if _, err := w.Write(make([]byte, e.size)); err != nil {
+                t.Fatal(err)
+            }
+        }
+        if err := zw.Close(); err != nil {
+            t.Fatal(err)
+        }
+    case "tar", "tar.gz":
+        var w io.Writer = &buf
+        var gz *gzip.Writer
+        if format == "tar.gz" {
+            gz = gzip.NewWriter(&buf)
+            w = gz
+        }
+        tw := tar.NewWriter(w)
+        for _, e := range entries {
+            hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(e.size), Typeflag: tar.TypeReg}
+            switch {
+            case e.link:
+                hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, "/etc/passwd", 0
+            case strings.HasSuffix(e.name, "/"):
+                hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+            }
+            if err := tw.WriteHeader(hdr); err != nil {
+                t.Fatal(err)
+            }
+            if _, err := tw.Write(make([]byte, hdr.Size)); err != nil {
+                t.Fatal(err)
+            }
+        }
+        if err := tw.Close(); err != nil {
+            t.Fatal(err)
+        }
+        if gz != nil {
+            if err := gz.Close(); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+    return buf.Bytes()
+}
+
+func TestArchiveImageName(t *testing.T) {
+    tests := []struct {
+        name string
+        want string
+        ok   bool
+    }{
+        {"photo.png", "photo.png", true},
+        {"album/IMG_1.JPG", "album/IMG_1.JPG", true},
+        {"../../etc/cron.d/x.png", "etc/cron.d/x.png", true},
+        {"/abs/path.webp", "abs/path.webp", true},
+        {"a\\..\\..\\b.jpeg", "b.jpeg", true},
+        {"album/../../c.png", "c.png", true},
+        {"notes.txt", "notes.txt", false},
+        {".hidden.png", "", false},
+        {"album/.thumbs/a.png", "", false},
+        {"__MACOSX/album/._a.png", "", false},
+        {"..", "", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, ok := archiveImageName(tt.name)
+            if ok != tt.ok || (ok && got != tt.want) {
+                t.Errorf("archiveImageName(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+            }
+        })
+    }
+}
+
+func TestReadArchive(t *testing.T) {
+    entries := []archiveEntry{
+        {name: "album/"},
+        {name: "album/a.png", size: 10},
+        {name: "../../escape.jpg", size: 10},
+        {name: "readme.txt", size: 10},
+        {name: "__MACOSX/album/._a.png", size: 10},
+    }
+    tarEntries := append(slices.Clone(entries), archiveEntry{name: "link.png", link: true})
+
+    tests := []struct {
+        format  string
+        entries []archiveEntry
+        want    []string
+        wantErr bool
+    }{
+        {"zip", entries, []string{"album/a.png", "escape.jpg"}, false},
+        {"tar", tarEntries, []string{"album/a.png", "escape.jpg"}, false},
+        {"tar.gz", tarEntries, []string{"album/a.png", "escape.jpg"}, false},
+        {"zip", make([]archiveEntry, maxArchiveEntries+1), nil, true},
+        {"tar", make([]archiveEntry, maxArchiveEntries+1), nil, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(fmt.Sprintf("%s/%d entries", tt.format, len(tt.entries)), func(t *testing.T) {
+            for i := range tt.entries {
+                if tt.entries[i].name == "" {
+                    tt.entries[i].name = fmt.Sprintf("f%d.txt", i)
+                }
+            }
+            data := makeArchive(t, tt.format, tt.entries)
+
+            var got []string
+            err := readArchive(archiveFile{bytes.NewReader(data)}, int64(len(data)), func(name string, r io.Reader) error {
+                got = append(got, name)
+                return nil
+            })
+            if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+                t.Errorf("readArchive() = %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+            }
+        })
+    }
+
+    if err := readArchive(archiveFile{bytes.NewReader([]byte("not an archive"))}, 14, nil); err == nil {
+        t.Error("readArchive() accepted an unknown format")
+    }
+}
+
+func TestHandleBatchRejectsOversizedImages(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    uploads := t.TempDir()
+    manager, err := storage.NewManager(storage.Config{UploadDir: uploads, OutputDir: t.TempDir(), MaxFileSizeMB: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    h := NewHandler(upscaler.NewService(upscaler.Config{WorkDir: t.TempDir()}), manager)
+
+    router := gin.New()
+    router.POST("/batch", AuthMiddleware(nil), h.HandleBatch)
+
+    archive := makeArchive(t, "zip", []archiveEntry{
+        {name: "small.png", size: 100},
+        {name: "large.png", size: 1024*1024 + 1},
+    })
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    fw, err := mw.CreateFormFile("archive", "images.zip")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := fw.Write(archive); err != nil {
+        t.Fatal(err)
+    }
+    if err := mw.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    req := httptest.NewRequest(http.MethodPost, "/batch", &body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, req)
+
+    if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "large.png is larger than 1 MB") {
+        t.Fatalf("status = %d %s, want 400 for large.png", w.Code, w.Body)
+    }
+    // The images saved before the oversized one are discarded
+    if left, _ := os.ReadDir(uploads); len(left) != 0 {
+        t.Errorf("%d uploads left behind", len(left))
+    }
+}
+
+func TestBatchNotFound(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    store := upscaler.NewMemoryStore()
+    for _, job := range []*upscaler.Job{
+        {ID: "a", Status: "completed", Request: upscaler.Request{BatchID: "expired"}},
+        {ID: "b", Status: "completed", Request: upscaler.Request{BatchID: "expired", BatchItem: 1}},
+    } {
+        if err := store.Put(job); err != nil {
+            t.Fatal(err)
+        }
+        if err := store.Delete(job.ID); err != nil {
+            t.Fatal(err)
+        }
+    }
+    h := NewHandler(upscaler.NewService(upscaler.Config{WorkDir: t.TempDir(), Store: store}), nil)
+
+    router := gin.New()
+    router.GET("/batch/:batch_id", h.HandleBatchStatus)
+    router.GET("/batch/:batch_id/download", h.HandleBatchDownload)
+
+    tests := []struct {
+        path       string
+        wantStatus int
+    }{
+        {"/batch/expired", http.StatusGone},
+        {"/batch/expired/download", http.StatusGone},
+        {"/batch/unknown", http.StatusNotFound},
+        {"/batch/unknown/download", http.StatusNotFound},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.path, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+        })
+    }
+}
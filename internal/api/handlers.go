@@ -4,8 +4,12 @@
 package api
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,11 +17,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"upscale-service/internal/ids"
 	"upscale-service/internal/storage"
 	"upscale-service/internal/upscaler"
 	"upscale-service/internal/version"
 )
 
+const (
+    // queueFullRetryAfter is the Retry-After value in seconds sent when the queue is full.
+    queueFullRetryAfter = 30
+    // eventBuffer is the number of events queued for a stream client before
+    // its progress events are dropped.
+    eventBuffer = 64
+    // eventKeepAlive is the interval of comments sent on idle event streams.
+    eventKeepAlive = 15 * time.Second
+)
+
 // Handler manages the HTTP requests for the upscaling service.
 // It coordinates between the Gin web framework, the upscaler service, and the storage manager.
 type Handler struct {
@@ -35,14 +50,47 @@ func NewHandler(upscalerService *upscaler.Service, storageManager *storage.Manag
 
 // UpscaleRequest represents the form data parameters for an upscale request.
 type UpscaleRequest struct {
-    // Scale factor for the image (2, 3, or 4).
-    Scale     int    `form:"scale" json:"scale"`
+    // Scale factor for the image, may be fractional (e.g. 1.5 or 6).
+    Scale        float64 `form:"scale" json:"scale"`
+    // TargetWidth is the desired output width in pixels (alternative to Scale).
+    TargetWidth  int     `form:"target_width" json:"target_width"`
+    // TargetHeight is the desired output height in pixels (alternative to Scale).
+    TargetHeight int     `form:"target_height" json:"target_height"`
+    // Fit decides how a target box is filled: "contain" (default) or "stretch".
+    Fit          string  `form:"fit" json:"fit"`
     // ModelName is the name of the AI model to use.
-    ModelName string `form:"model_name" json:"model_name"`
+    ModelName    string  `form:"model_name" json:"model_name"`
     // TileSize is the tile size for processing (0 for auto).
-    TileSize  int    `form:"tile_size" json:"tile_size"`
+    TileSize     int     `form:"tile_size" json:"tile_size"`
     // Format is the desired output format (png, jpg, webp).
-    Format    string `form:"format" json:"format"`
+    Format       string  `form:"format" json:"format"`
+    // Device is the device preference: "auto" (default), "gpu", "cpu" or a device name.
+    Device       string  `form:"device" json:"device"`
+    // Priority is the scheduling priority: low, normal (default) or high.
+    Priority     string  `form:"priority" json:"priority"`
+    // TimeoutSeconds overrides the computed job timeout (0 for computed).
+    TimeoutSeconds int   `form:"timeout_seconds" json:"timeout_seconds"`
+    // Pipeline lists processing stages to run instead of a single upscale.
+    Pipeline     Pipeline `form:"pipeline" json:"pipeline"`
+    // Denoise is the denoise level of Real-CUGAN and waifu2x models (-1 to 3).
+    Denoise      *int    `form:"denoise" json:"denoise"`
+    // TTA enables test-time augmentation (slower, slightly cleaner).
+    TTA          bool    `form:"tta" json:"tta"`
+    // SyncGap is the Real-CUGAN sync gap mode (0 to 3).
+    SyncGap      *int    `form:"syncgap" json:"syncgap"`
+}
+
+// Pipeline is an ordered list of processing stages. Multipart forms send it
+// as a JSON array in a single field.
+type Pipeline []upscaler.PipelineStage
+
+// UnmarshalParam decodes a pipeline sent as a form field.
+func (p *Pipeline) UnmarshalParam(param string) error {
+    if param == "" {
+        *p = nil
+        return nil
+    }
+    return json.Unmarshal([]byte(param), (*[]upscaler.PipelineStage)(p))
 }
 
 // UpscaleResponse represents the JSON response returned by the upscale endpoint.
@@ -53,6 +101,8 @@ type UpscaleResponse struct {
     JobID         string                `json:"job_id,omitempty"`
     // StatusURL is the URL to check job status.
     StatusURL     string                `json:"status_url,omitempty"`
+    // DownloadToken must be passed as ?token= to download the result, if enabled.
+    DownloadToken string                `json:"download_token,omitempty"`
     // DownloadURL is the relative URL to download the processed image.
     DownloadURL   string                `json:"download_url,omitempty"`
     // Duration is the time taken to process the image in seconds.
@@ -65,28 +115,18 @@ type UpscaleResponse struct {
     FileSizeBytes int64                 `json:"file_size_bytes,omitempty"`
     // Error contains the error message if the request failed.
     Error         string                `json:"error,omitempty"`
+    // ErrorCode classifies the error (e.g. "invalid_request").
+    ErrorCode     upscaler.ErrorCode    `json:"error_code,omitempty"`
 }
 
 // HandleUpscale processes the image upload and submits an upscaling job.
 // It expects a multipart form request with an 'image' file and optional parameters.
 func (h *Handler) HandleUpscale(c *gin.Context) {
-    var req UpscaleRequest
-    if err := c.ShouldBind(&req); err != nil {
-        c.JSON(http.StatusBadRequest, UpscaleResponse{
-            Success: false,
-            Error:   fmt.Sprintf("invalid request: %v", err),
-        })
+    req, ok := h.bindUpscaleRequest(c)
+    if !ok {
         return
     }
 
-    // Apply defaults
-    if req.Scale == 0 {
-        req.Scale = 4
-    }
-    if req.ModelName == "" {
-        req.ModelName = "realesrgan-x4plus"
-    }
-
     fileHeader, err := c.FormFile("image")
     if err != nil {
         c.JSON(http.StatusBadRequest, UpscaleResponse{
@@ -124,42 +164,144 @@ func (h *Handler) HandleUpscale(c *gin.Context) {
         return
     }
 
-    // Generate output path
-    preID := fmt.Sprintf("%d", time.Now().UnixNano())
-    outputPath := h.storage.GetOutputPath(preID, fileHeader.Filename)
+    // Name the output after the job
+    jobID := ids.New()
+    request := req.request(inputPath, h.storage.GetOutputPath(jobID, fileHeader.Filename))
+    request.JobID = jobID
 
-    jobID, err := h.upscaler.SubmitJob(upscaler.Request{
-        InputPath:  inputPath,
-        OutputPath: outputPath,
-        Scale:      req.Scale,
-        ModelName:  req.ModelName,
-        TileSize:   req.TileSize,
-        Format:     req.Format,
-    })
-
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, UpscaleResponse{
-            Success: false,
-            Error:   fmt.Sprintf("failed to submit job: %v", err),
-        })
+    if _, err := h.upscaler.SubmitJob(request); err != nil {
+        // The upload is not needed anymore
+        _ = h.storage.DeleteFile(inputPath)
+        submitFailed(c, err)
         return
     }
 
-    // Async response
-    c.JSON(http.StatusAccepted, UpscaleResponse{
+    response := UpscaleResponse{
         Success:   true,
         JobID:     jobID,
         StatusURL: "/api/v1/status/" + jobID,
+    }
+    if job, ok := h.upscaler.GetJob(jobID); ok {
+        response.DownloadToken = job.DownloadToken
+    }
+
+    // Async response
+    c.JSON(http.StatusAccepted, response)
+}
+
+// submitFailed answers a rejected submission: 503 with Retry-After if the
+// service cannot take jobs right now, 400 for invalid requests, 500 otherwise.
+func submitFailed(c *gin.Context, err error) {
+    unavailable := map[error]string{
+        upscaler.ErrQueueFull:    "queue is full, retry later",
+        upscaler.ErrMaintenance:  "server is in maintenance mode, retry later",
+        upscaler.ErrShuttingDown: "server is shutting down, retry later",
+    }
+    for target, msg := range unavailable {
+        if errors.Is(err, target) {
+            c.Header("Retry-After", fmt.Sprintf("%d", queueFullRetryAfter))
+            c.JSON(http.StatusServiceUnavailable, UpscaleResponse{
+                Success: false,
+                Error:   msg,
+            })
+            return
+        }
+    }
+
+    if errors.Is(err, upscaler.ErrInvalidRequest) {
+        c.JSON(http.StatusBadRequest, UpscaleResponse{
+            Success:   false,
+            Error:     err.Error(),
+            ErrorCode: upscaler.ErrCodeInvalidRequest,
+        })
+        return
+    }
+
+    c.JSON(http.StatusInternalServerError, UpscaleResponse{
+        Success:   false,
+        Error:     fmt.Sprintf("failed to submit job: %v", err),
+        ErrorCode: upscaler.ErrCodeInternal,
     })
 }
 
+// bindUpscaleRequest parses the upscale parameters of a request, applies the
+// defaults and checks the priority against the caller. On failure it writes
+// the error response and returns false.
+func (h *Handler) bindUpscaleRequest(c *gin.Context) (UpscaleRequest, bool) {
+    var req UpscaleRequest
+    if err := c.ShouldBind(&req); err != nil {
+        c.JSON(http.StatusBadRequest, UpscaleResponse{
+            Success: false,
+            Error:   fmt.Sprintf("invalid request: %v", err),
+        })
+        return req, false
+    }
+
+    // Apply defaults
+    if req.Scale == 0 && req.TargetWidth == 0 && req.TargetHeight == 0 {
+        req.Scale = 4
+    }
+    if req.ModelName == "" {
+        req.ModelName = h.upscaler.DefaultModel()
+    }
+
+    priority, err := upscaler.ParsePriority(req.Priority)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, UpscaleResponse{
+            Success: false,
+            Error:   err.Error(),
+        })
+        return req, false
+    }
+    if caller := principal(c); priority > caller.MaxPriority {
+        c.JSON(http.StatusForbidden, UpscaleResponse{
+            Success: false,
+            Error:   fmt.Sprintf("priority %s exceeds the maximum allowed priority %s", priority, caller.MaxPriority),
+        })
+        return req, false
+    }
+
+    return req, true
+}
+
+// request builds the service request for an uploaded file. The priority has
+// been validated by bindUpscaleRequest.
+func (r UpscaleRequest) request(inputPath, outputPath string) upscaler.Request {
+    priority, _ := upscaler.ParsePriority(r.Priority)
+    return upscaler.Request{
+        InputPath:    inputPath,
+        OutputPath:   outputPath,
+        Scale:        r.Scale,
+        TargetWidth:  r.TargetWidth,
+        TargetHeight: r.TargetHeight,
+        Fit:          r.Fit,
+        ModelName:    r.ModelName,
+        TileSize:     r.TileSize,
+        Format:       r.Format,
+        Device:       r.Device,
+        Priority:     priority,
+        Timeout:      time.Duration(r.TimeoutSeconds) * time.Second,
+        Pipeline:     r.Pipeline,
+        Options: upscaler.EngineOptions{
+            Denoise: r.Denoise,
+            TTA:     r.TTA,
+            SyncGap: r.SyncGap,
+        },
+    }
+}
+
 // HandleDownload serves the upscaled image file for a given job ID.
 func (h *Handler) HandleDownload(c *gin.Context) {
     jobID := c.Param("job_id")
 
     job, ok := h.upscaler.GetJob(jobID)
     if !ok {
-        c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+        h.jobNotFound(c, jobID)
+        return
+    }
+
+    if job.DownloadToken != "" && subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(job.DownloadToken)) != 1 {
+        c.JSON(http.StatusForbidden, gin.H{"error": "invalid download token"})
         return
     }
 
@@ -216,13 +358,31 @@ func (h *Handler) HandleDownload(c *gin.Context) {
     }
 }
 
+// jobNotFound answers a request for an unknown job: 410 Gone with the
+// tombstone if the job was evicted from the history, 404 otherwise.
+func (h *Handler) jobNotFound(c *gin.Context, jobID string) {
+    t, ok := h.upscaler.Tombstone(jobID)
+    if !ok {
+        c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+        return
+    }
+
+    c.JSON(http.StatusGone, gin.H{
+        "error":       "job expired",
+        "job_id":      t.ID,
+        "status":      t.Status,
+        "finished_at": t.FinishedAt.Format(time.RFC3339),
+        "expired_at":  t.ExpiredAt.Format(time.RFC3339),
+    })
+}
+
 // HandleStatus returns the current status and progress of a specific job.
 func (h *Handler) HandleStatus(c *gin.Context) {
     jobID := c.Param("job_id")
 
     job, ok := h.upscaler.GetJob(jobID)
     if !ok {
-        c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+        h.jobNotFound(c, jobID)
         return
     }
 
@@ -230,6 +390,47 @@ func (h *Handler) HandleStatus(c *gin.Context) {
         "job_id":   job.ID,
         "status":   job.Status,
         "progress": job.Progress,
+        "priority": job.Request.Priority,
+    }
+
+    if job.Status == "queued" {
+        if pos := h.upscaler.QueuePosition(job.ID); pos > 0 {
+            response["queue_position"] = pos
+        }
+    }
+    if start, finish, ok := h.upscaler.EstimateJob(job.ID); ok {
+        if job.Status == "queued" {
+            response["estimated_start"] = start.Format(time.RFC3339)
+        }
+        response["estimated_finish"] = finish.Format(time.RFC3339)
+    }
+    if job.TilesTotal > 0 {
+        response["tiles"] = gin.H{
+            "done":  job.TilesDone,
+            "total": job.TilesTotal,
+        }
+    }
+    if job.Resumed {
+        response["resumed"] = true
+        response["resumed_tiles"] = job.ResumedTiles
+    }
+    if job.Plan != nil {
+        response["plan"] = job.Plan
+    }
+    if job.Device != "" {
+        response["device"] = job.Device
+    }
+    if job.Stage != "" {
+        response["stage"] = job.Stage
+    }
+    if len(job.Pipeline) > 0 {
+        response["pipeline"] = job.Pipeline
+    }
+    if job.Timeout > 0 {
+        response["timeout_seconds"] = job.Timeout.Seconds()
+    }
+    if len(job.Attempts) > 0 {
+        response["attempts"] = job.Attempts
     }
 
     if job.Status == "completed" && job.Result != nil {
@@ -238,21 +439,89 @@ func (h *Handler) HandleStatus(c *gin.Context) {
         response["input_size"] = job.Result.InputSize
         response["output_size"] = job.Result.OutputSize
         response["file_size_bytes"] = job.Result.FileSizeBytes
-    } else if job.Status == "failed" {
+        response["engine"] = job.Result.Engine
+    } else if job.Status == "failed" || job.Status == "timed_out" {
         errMsg := "unknown error"
         if job.Error != nil {
             errMsg = job.Error.Error()
         }
         response["error"] = errMsg
     }
+    if job.ErrorCode != "" {
+        response["error_code"] = job.ErrorCode
+        response["error_message"] = job.ErrorCode.Message()
+    }
 
     c.JSON(http.StatusOK, response)
 }
 
+// HandleEvents streams the lifecycle events of a job as server-sent events.
+// The current state is sent first; the stream ends after the job's final event.
+func (h *Handler) HandleEvents(c *gin.Context) {
+    jobID := c.Param("job_id")
+
+    // Subscribe before reading the job, so no transition is missed in between
+    events, unsubscribe := h.upscaler.SubscribeJob(jobID, eventBuffer)
+    defer unsubscribe()
+
+    job, ok := h.upscaler.GetJob(jobID)
+    if !ok {
+        h.jobNotFound(c, jobID)
+        return
+    }
+
+    current := upscaler.Event{
+        Type:      "status",
+        JobID:     job.ID,
+        Status:    job.Status,
+        Progress:  job.Progress,
+        Stage:     job.Stage,
+        Device:    job.Device,
+        ErrorCode: job.ErrorCode,
+        Time:      time.Now(),
+    }
+    if job.Error != nil {
+        current.Error = job.Error.Error()
+    }
+
+    c.Header("Cache-Control", "no-cache")
+    c.Header("X-Accel-Buffering", "no")
+    c.SSEvent(string(current.Type), current)
+    c.Writer.Flush()
+
+    if job.Finished() {
+        return
+    }
+
+    keepAlive := time.NewTicker(eventKeepAlive)
+    defer keepAlive.Stop()
+
+    c.Stream(func(w io.Writer) bool {
+        select {
+        case <-c.Request.Context().Done():
+            return false
+        case <-keepAlive.C:
+            _, _ = io.WriteString(w, ": keep-alive\n\n")
+            return true
+        case e, ok := <-events:
+            if !ok {
+                return false
+            }
+            c.SSEvent(string(e.Type), e)
+            return !e.Final()
+        }
+    })
+}
+
 // HandleCancel cancels a running or queued job.
 func (h *Handler) HandleCancel(c *gin.Context) {
     jobID := c.Param("job_id")
 
+    if _, ok := h.upscaler.Tombstone(jobID); ok {
+        h.jobNotFound(c, jobID)
+        return
+    }
+
     if err := h.upscaler.CancelJob(jobID); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{
             "success": false,
@@ -267,6 +536,190 @@ func (h *Handler) HandleCancel(c *gin.Context) {
     })
 }
 
+// EstimateRequest describes an image and the intended upscale parameters.
+type EstimateRequest struct {
+    Width        int     `form:"width" json:"width" binding:"required"`
+    Height       int     `form:"height" json:"height" binding:"required"`
+    Scale        float64 `form:"scale" json:"scale"`
+    TargetWidth  int     `form:"target_width" json:"target_width"`
+    TargetHeight int     `form:"target_height" json:"target_height"`
+    Fit          string  `form:"fit" json:"fit"`
+    ModelName    string  `form:"model_name" json:"model_name"`
+    Format       string  `form:"format" json:"format"`
+    Device       string  `form:"device" json:"device"`
+    Pipeline     Pipeline `form:"pipeline" json:"pipeline"`
+}
+
+// HandleEstimate predicts the duration and output file size of an upscale
+// request before the image is uploaded.
+func (h *Handler) HandleEstimate(c *gin.Context) {
+    var req EstimateRequest
+    if err := c.ShouldBind(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   fmt.Sprintf("invalid request: %v", err),
+        })
+        return
+    }
+
+    // Same defaults as HandleUpscale
+    if req.Scale == 0 && req.TargetWidth == 0 && req.TargetHeight == 0 {
+        req.Scale = 4
+    }
+    if req.ModelName == "" {
+        req.ModelName = h.upscaler.DefaultModel()
+    }
+    if req.Format == "" {
+        req.Format = "png"
+    }
+
+    est, err := h.upscaler.Estimate(upscaler.Request{
+        Scale:        req.Scale,
+        TargetWidth:  req.TargetWidth,
+        TargetHeight: req.TargetHeight,
+        Fit:          req.Fit,
+        ModelName:    req.ModelName,
+        Format:       req.Format,
+        Device:       req.Device,
+        Pipeline:     req.Pipeline,
+    }, upscaler.ImageSize{Width: req.Width, Height: req.Height})
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   err.Error(),
+        })
+        return
+    }
+
+    response := gin.H{
+        "success":                   true,
+        "output_size":               est.Plan.OutputSize,
+        "plan":                      est.Plan,
+        "estimated_file_size_bytes": est.FileSizeBytes,
+    }
+    if est.DurationKnown {
+        response["estimated_duration_seconds"] = est.Duration.Seconds()
+    }
+    if est.StartKnown {
+        response["estimated_start_seconds"] = est.StartIn.Seconds()
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+// HandleSetPriority changes the priority of a queued job (admin only).
+func (h *Handler) HandleSetPriority(c *gin.Context) {
+    jobID := c.Param("job_id")
+
+    var body struct {
+        Priority string `form:"priority" json:"priority" binding:"required"`
+    }
+    if err := c.ShouldBind(&body); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   fmt.Sprintf("invalid request: %v", err),
+        })
+        return
+    }
+
+    priority, err := upscaler.ParsePriority(body.Priority)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   err.Error(),
+        })
+        return
+    }
+
+    if _, ok := h.upscaler.Tombstone(jobID); ok {
+        h.jobNotFound(c, jobID)
+        return
+    }
+
+    if err := h.upscaler.SetPriority(jobID, priority); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   err.Error(),
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "success":  true,
+        "job_id":   jobID,
+        "priority": priority,
+    })
+}
+
+// HandleQueue returns the queued and running jobs and the dispatch state.
+func (h *Handler) HandleQueue(c *gin.Context) {
+    c.JSON(http.StatusOK, h.upscaler.Queue())
+}
+
+// HandlePause stops workers from starting queued jobs; uploads are still accepted.
+func (h *Handler) HandlePause(c *gin.Context) {
+    h.upscaler.PauseDispatch()
+    log.Printf("Dispatch paused by %s", principal(c).Name)
+
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "state":   h.upscaler.State(),
+    })
+}
+
+// HandleResume lets workers start queued jobs again.
+func (h *Handler) HandleResume(c *gin.Context) {
+    h.upscaler.ResumeDispatch()
+    log.Printf("Dispatch resumed by %s", principal(c).Name)
+
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "state":   h.upscaler.State(),
+    })
+}
+
+// HandleMaintenance enables or disables maintenance mode, in which uploads are
+// rejected while queued and running jobs finish.
+func (h *Handler) HandleMaintenance(c *gin.Context) {
+    var body struct {
+        Enabled *bool `form:"enabled" json:"enabled" binding:"required"`
+    }
+    if err := c.ShouldBind(&body); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "success": false,
+            "error":   fmt.Sprintf("invalid request: %v", err),
+        })
+        return
+    }
+
+    h.upscaler.SetMaintenance(*body.Enabled)
+    log.Printf("Maintenance mode set to %t by %s", *body.Enabled, principal(c).Name)
+
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "state":   h.upscaler.State(),
+    })
+}
+
+// HandleVerifyModels checks the files of all models again, including their
+// checksums, and returns the result.
+func (h *Handler) HandleVerifyModels(c *gin.Context) {
+    models, err := h.upscaler.VerifyModels()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "success": false,
+            "error":   fmt.Sprintf("failed to verify models: %v", err),
+        })
+        return
+    }
+    log.Printf("Models verified by %s", principal(c).Name)
+
+    c.JSON(http.StatusOK, gin.H{
+        "success": true,
+        "models":  models,
+    })
+}
+
 // HandleModels returns a list of available AI models and their capabilities.
 // It supports filtering by 'scale' query parameter.
 func (h *Handler) HandleModels(c *gin.Context) {
@@ -304,9 +757,47 @@ func (h *Handler) HandleModels(c *gin.Context) {
 
 // HandleHealth provides a health check endpoint returning status, version, and server time.
 func (h *Handler) HandleHealth(c *gin.Context) {
-    c.JSON(http.StatusOK, gin.H{
-        "status":  "ok",
+    state := h.upscaler.State()
+
+    status, code := "ok", http.StatusOK
+    switch {
+    case state.ShuttingDown:
+        // Lets load balancers stop routing uploads here
+        status, code = "shutting_down", http.StatusServiceUnavailable
+    case state.Maintenance:
+        status = "maintenance"
+    case state.Paused:
+        status = "paused"
+    }
+
+    // Broken models are reported but do not fail the check; the other
+    // models keep working
+    models, _ := h.upscaler.GetAvailableModels()
+    available := 0
+    unavailable := make([]gin.H, 0)
+    for _, m := range models {
+        if m.Available {
+            available++
+        } else {
+            unavailable = append(unavailable, gin.H{"name": m.Name, "problem": m.Problem})
+        }
+    }
+    if status == "ok" && len(unavailable) > 0 {
+        status = "degraded"
+    }
+
+    c.JSON(code, gin.H{
+        "status":  status,
         "version": version.Version,
         "time":    time.Now().Unix(),
+        "devices": h.upscaler.Devices(),
+        "queue_length": state.Queued,
+        "running_jobs": state.Running,
+        "dispatch_paused": state.Paused,
+        "maintenance": state.Maintenance,
+        "models": gin.H{
+            "available":   available,
+            "unavailable": unavailable,
+        },
     })
 }
@@ -0,0 +1,71 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"upscale-service/internal/upscaler"
+)
+
+func TestJobNotFound(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    store := upscaler.NewMemoryStore()
+    old := &upscaler.Job{ID: "expired", Status: "completed", FinishedAt: time.Now().Add(-48 * time.Hour)}
+    if err := store.Put(old); err != nil {
+        t.Fatal(err)
+    }
+    s := upscaler.NewService(upscaler.Config{WorkDir: t.TempDir(), Store: store, HistoryMaxAge: 24 * time.Hour})
+    if n := s.PruneHistory(); n != 1 {
+        t.Fatalf("PruneHistory() = %d, want 1", n)
+    }
+    h := NewHandler(s, nil)
+
+    router := gin.New()
+    router.GET("/status/:job_id", h.HandleStatus)
+    router.GET("/status/:job_id/events", h.HandleEvents)
+    router.GET("/download/:job_id", h.HandleDownload)
+    router.POST("/cancel/:job_id", h.HandleCancel)
+
+    tests := []struct {
+        method     string
+        path       string
+        wantStatus int
+    }{
+        {http.MethodGet, "/status/expired", http.StatusGone},
+        {http.MethodGet, "/status/expired/events", http.StatusGone},
+        {http.MethodGet, "/download/expired", http.StatusGone},
+        {http.MethodPost, "/cancel/expired", http.StatusGone},
+        {http.MethodGet, "/status/unknown", http.StatusNotFound},
+        {http.MethodGet, "/download/unknown", http.StatusNotFound},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+            }
+            if tt.wantStatus != http.StatusGone {
+                return
+            }
+
+            var body map[string]string
+            if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+                t.Fatal(err)
+            }
+            if body["job_id"] != "expired" || body["status"] != "completed" || body["expired_at"] == "" {
+                t.Errorf("tombstone = %v", body)
+            }
+        })
+    }
+}
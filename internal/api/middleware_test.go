@@ -0,0 +1,132 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package api
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+
+    "upscale-service/internal/upscaler"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    admin := Token{Value: "secret", Principal: Principal{Name: "ops", MaxPriority: upscaler.PriorityHigh, Admin: true}}
+    user := Token{Value: "user-token", Principal: Principal{Name: "user", MaxPriority: upscaler.PriorityNormal}}
+
+    tests := []struct {
+        name       string
+        tokens     []Token
+        header     string
+        value      string
+        wantStatus int
+        want       Principal
+    }{
+        {"auth disabled", nil, "", "", http.StatusOK, anonymous},
+        {"bearer admin", []Token{admin, user}, "Authorization", "Bearer secret", http.StatusOK, admin.Principal},
+        {"x-auth-token user", []Token{admin, user}, "X-Auth-Token", "user-token", http.StatusOK, user.Principal},
+        {"wrong token", []Token{admin}, "X-Auth-Token", "secreT", http.StatusUnauthorized, Principal{}},
+        {"token prefix", []Token{admin}, "X-Auth-Token", "secre", http.StatusUnauthorized, Principal{}},
+        {"missing token", []Token{admin}, "", "", http.StatusUnauthorized, Principal{}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got Principal
+            router := gin.New()
+            router.GET("/", AuthMiddleware(tt.tokens), func(c *gin.Context) {
+                got = principal(c)
+                c.Status(http.StatusOK)
+            })
+
+            req := httptest.NewRequest(http.MethodGet, "/", nil)
+            if tt.header != "" {
+                req.Header.Set(tt.header, tt.value)
+            }
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, req)
+
+            if w.Code != tt.wantStatus {
+                t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+            }
+            if got != tt.want {
+                t.Fatalf("principal = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestAdminWithoutTokens(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    router := gin.New()
+    router.GET("/admin", AuthMiddleware(nil), AdminMiddleware(), func(c *gin.Context) {
+        c.Status(http.StatusOK)
+    })
+
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+    if w.Code != http.StatusForbidden {
+        t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+    }
+    if anonymous.Admin || anonymous.MaxPriority != upscaler.PriorityNormal {
+        t.Fatalf("anonymous = %+v, want normal priority without admin rights", anonymous)
+    }
+}
+
+func TestPrincipalWithoutAuthMiddleware(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    router := gin.New()
+    router.GET("/admin", AdminMiddleware(), func(c *gin.Context) {
+        c.Status(http.StatusOK)
+    })
+
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+    if w.Code != http.StatusForbidden {
+        t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+    }
+
+    c, _ := gin.CreateTestContext(httptest.NewRecorder())
+    if p := principal(c); p.Admin || p.MaxPriority != upscaler.PriorityLow {
+        t.Fatalf("principal = %+v, want no admin rights and low priority", p)
+    }
+}
+
+func TestIDParamsMiddleware(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    router := gin.New()
+    router.Use(IDParamsMiddleware())
+    ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+    router.GET("/status/:job_id", ok)
+    router.GET("/batch/:batch_id", ok)
+    router.GET("/models", ok)
+
+    tests := []struct {
+        path string
+        want int
+    }{
+        {"/status/01ARYZ6S410000000000000000", http.StatusOK},
+        {"/status/01aryz6s410000000000000000", http.StatusNotFound},
+        {"/status/job_1709223344", http.StatusNotFound},
+        {"/status/..%2F..%2Fetc%2Fpasswd", http.StatusNotFound},
+        {"/batch/01ARYZ6S410000000000000000", http.StatusOK},
+        {"/batch/x", http.StatusNotFound},
+        {"/models", http.StatusOK},
+    }
+
+    for _, tt := range tests {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+        if w.Code != tt.want {
+            t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+        }
+    }
+}
@@ -30,6 +30,21 @@ type ServerConfig struct {
     ReadTimeout       int    `yaml:"read_timeout_seconds"`
     WriteTimeout      int    `yaml:"write_timeout_seconds"`
     MaxRequestSizeMB  int64  `yaml:"max_request_size_mb"`
+    // Tokens are additional auth tokens with restricted permissions.
+    Tokens            []TokenConfig `yaml:"tokens"`
+    // DownloadTokens requires a per-job secret token to download results.
+    DownloadTokens    bool   `yaml:"download_tokens"`
+    // ShutdownDrainSeconds is the time running jobs get to finish on shutdown
+    // before they are interrupted and resumed on the next start (default 30).
+    ShutdownDrainSeconds int `yaml:"shutdown_drain_seconds"`
+}
+
+// TokenConfig describes an auth token and the permissions it grants.
+type TokenConfig struct {
+    Token       string `yaml:"token"`
+    Name        string `yaml:"name"`
+    MaxPriority string `yaml:"max_priority"` // low, normal (default) or high
+    Admin       bool   `yaml:"admin"`
 }
 
 // UpscalerConfig holds the settings for the upscaling engine.
@@ -41,6 +56,48 @@ type UpscalerConfig struct {
     Threads      string `yaml:"threads"`
     EnableGPU    bool   `yaml:"enable_gpu"`
     GPUID        int    `yaml:"gpu_id"`
+    // Engines are additional ncnn-vulkan binaries whose models are served
+    // alongside the ones of binary_path.
+    Engines      []EngineConfig `yaml:"engines"`
+    // Devices binds workers to compute devices; overrides enable_gpu/gpu_id when set.
+    Devices      []DeviceConfig `yaml:"devices"`
+    // ResampleFallback uses the built-in resample engine when the binary or models are missing.
+    ResampleFallback bool `yaml:"resample_fallback"`
+    // WorkDir holds temporary job files and tiles (default ~/.mlcupscale/tmp).
+    WorkDir          string  `yaml:"work_dir"`
+    // SplitTileSize is the tile edge in input pixels for split-and-stitch (0 = disabled).
+    SplitTileSize    int     `yaml:"split_tile_size"`
+    SplitOverlap     int     `yaml:"split_overlap"`
+    SplitThresholdMP float64 `yaml:"split_threshold_megapixels"`
+    // MaxRetries repeats transiently failed jobs, waiting retry_backoff_seconds
+    // before the first retry and doubling it for each further one.
+    MaxRetries          int  `yaml:"max_retries"`
+    RetryBackoffSeconds int  `yaml:"retry_backoff_seconds"`
+    // CPUFallback repeats jobs on the CPU when the GPU cannot be initialised.
+    CPUFallback         bool `yaml:"cpu_fallback"`
+    // PriorityAgingSeconds is the waiting time after which a queued job is
+    // treated as one priority level higher (0 = 600).
+    PriorityAgingSeconds int `yaml:"priority_aging_seconds"`
+    // ModelsPollSeconds is the interval at which the models directories are
+    // checked for changed models (0 = 10, negative disables the reload).
+    ModelsPollSeconds    int `yaml:"models_poll_seconds"`
+}
+
+// EngineConfig describes an additional ncnn-vulkan binary.
+type EngineConfig struct {
+    Type       string `yaml:"type"` // realesrgan, realcugan or waifu2x
+    Name       string `yaml:"name"` // default: type
+    BinaryPath string `yaml:"binary_path"`
+    ModelsPath string `yaml:"models_path"`
+    Threads    string `yaml:"threads"` // default: upscaler.threads
+}
+
+// DeviceConfig describes a compute device and the number of workers bound to it.
+type DeviceConfig struct {
+    Name    string `yaml:"name"`
+    Kind    string `yaml:"kind"`    // gpu or cpu
+    GPUID   int    `yaml:"gpu_id"`  // -1 = auto-detect
+    Workers int    `yaml:"workers"` // 0 = limits.max_concurrent_jobs
 }
 
 // StorageConfig holds settings for file storage locations and cleanup policies.
@@ -50,13 +107,30 @@ type StorageConfig struct {
     MaxFileSizeMB     int64  `yaml:"max_file_size_mb"`
     CleanupAfterHours int    `yaml:"cleanup_after_hours"`
     RetentionPolicy   string `yaml:"retention_policy"`
+    // JobStore is "memory" (jobs are lost on restart) or "journal".
+    JobStore          string `yaml:"job_store"`
+    // JobJournal is the journal file of the "journal" job store.
+    JobJournal        string `yaml:"job_journal"`
+    // JobHistoryMaxJobs and JobHistoryMaxAgeHours bound the finished jobs kept
+    // for status queries; evicted jobs answer 410 Gone.
+    JobHistoryMaxJobs     int `yaml:"job_history_max_jobs"`
+    JobHistoryMaxAgeHours int `yaml:"job_history_max_age_hours"`
 }
 
 // LimitsConfig holds concurrency and rate limiting settings.
 type LimitsConfig struct {
     MaxConcurrentJobs  int `yaml:"max_concurrent_jobs"`
     MaxQueueSize       int `yaml:"max_queue_size"`
+    // MaxBatchSize is the largest number of images in a batch (0 = unlimited).
+    MaxBatchSize       int `yaml:"max_batch_size"`
     RateLimitPerMinute int `yaml:"rate_limit_per_minute"`
+    // Job timeouts are computed from the predicted duration or the output
+    // megapixels and clamped to [JobTimeoutMin, JobTimeoutMax].
+    JobTimeoutMinSeconds          int `yaml:"job_timeout_min_seconds"`
+    JobTimeoutMaxSeconds          int `yaml:"job_timeout_max_seconds"`
+    JobTimeoutPerMegapixelSeconds int `yaml:"job_timeout_per_megapixel_seconds"`
+    // JobTimeoutOverrideMaxSeconds limits the per-request timeout_seconds.
+    JobTimeoutOverrideMaxSeconds  int `yaml:"job_timeout_override_max_seconds"`
 }
 
 // LoggingConfig holds logging preferences.
@@ -126,6 +200,9 @@ func applyEnvOverrides(cfg *Config) {
     if models := os.Getenv("UPSCALE_MODELS_PATH"); models != "" {
         cfg.Upscaler.ModelsPath = models
     }
+    if workDir := os.Getenv("UPSCALE_WORK_DIR"); workDir != "" {
+        cfg.Upscaler.WorkDir = workDir
+    }
     if threads := os.Getenv("UPSCALE_THREADS"); threads != "" {
         cfg.Upscaler.Threads = threads
     }
@@ -138,6 +215,9 @@ func applyEnvOverrides(cfg *Config) {
     if outputDir := os.Getenv("UPSCALE_STORAGE_OUTPUT_DIR"); outputDir != "" {
         cfg.Storage.OutputDir = outputDir
     }
+    if journal := os.Getenv("UPSCALE_STORAGE_JOB_JOURNAL"); journal != "" {
+        cfg.Storage.JobJournal = journal
+    }
 }
 
 
@@ -146,6 +226,44 @@ func validate(cfg *Config) error {
     if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
         return fmt.Errorf("invalid port: %d", cfg.Server.Port)
     }
+    for _, t := range cfg.Server.Tokens {
+        if t.Token == "" {
+            return fmt.Errorf("empty token for %q", t.Name)
+        }
+        switch t.MaxPriority {
+        case "", "low", "normal", "high":
+        default:
+            return fmt.Errorf("invalid max_priority for token %q: %s", t.Name, t.MaxPriority)
+        }
+    }
+    names := map[string]bool{"realesrgan": true, "resample": true}
+    for _, e := range cfg.Upscaler.Engines {
+        switch e.Type {
+        case "realesrgan", "realcugan", "waifu2x":
+        default:
+            return fmt.Errorf("invalid engine type: %q", e.Type)
+        }
+        if e.BinaryPath == "" || e.ModelsPath == "" {
+            return fmt.Errorf("binary_path and models_path are required for the %s engine", e.Type)
+        }
+        name := e.Name
+        if name == "" {
+            name = e.Type
+        }
+        if names[name] {
+            return fmt.Errorf("duplicate engine name: %s", name)
+        }
+        names[name] = true
+    }
+    switch cfg.Storage.JobStore {
+    case "", "memory":
+    case "journal":
+        if cfg.Storage.JobJournal == "" {
+            return fmt.Errorf("job_journal is required for the journal job store")
+        }
+    default:
+        return fmt.Errorf("invalid job store: %s", cfg.Storage.JobStore)
+    }
     return nil
 }
 
@@ -154,6 +272,14 @@ func (c *Config) GetReadTimeout() time.Duration {
     return time.Duration(c.Server.ReadTimeout) * time.Second
 }
 
+// GetShutdownDrain returns the drain period for running jobs on shutdown.
+func (c *Config) GetShutdownDrain() time.Duration {
+    if c.Server.ShutdownDrainSeconds <= 0 {
+        return 30 * time.Second
+    }
+    return time.Duration(c.Server.ShutdownDrainSeconds) * time.Second
+}
+
 // GetWriteTimeout converts the configured write timeout to a time.Duration.
 func (c *Config) GetWriteTimeout() time.Duration {
     return time.Duration(c.Server.WriteTimeout) * time.Second
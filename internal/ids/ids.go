@@ -0,0 +1,85 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+// Package ids generates unguessable identifiers for jobs, files and tokens.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Length is the length of an ID returned by New.
+const Length = 26
+
+// New returns a ULID: a 48-bit millisecond timestamp followed by 80 random
+// bits, encoded as 26 Crockford base32 characters. IDs sort by creation time
+// to the millisecond; within a millisecond the order is random.
+func New() string {
+    var b [16]byte
+    ms := uint64(time.Now().UnixMilli())
+    for i := 0; i < 6; i++ {
+        b[i] = byte(ms >> (40 - 8*i))
+    }
+    if _, err := rand.Read(b[6:]); err != nil {
+        // crypto/rand does not fail on supported platforms
+        panic("ids: failed to read random bytes: " + err.Error())
+    }
+    return encode(b)
+}
+
+// encode writes 128 bits as 26 base32 characters, most significant first.
+// The first character only carries the top 3 bits.
+func encode(b [16]byte) string {
+    out := make([]byte, Length)
+    // Process the value as a 130-bit number padded with two leading zero bits
+    bit := -2
+    for i := range out {
+        v := 0
+        for j := 0; j < 5; j++ {
+            v <<= 1
+            if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+                v |= 1
+            }
+            bit++
+        }
+        out[i] = crockford[v]
+    }
+    return string(out)
+}
+
+// Valid reports whether s has the form of an ID returned by New.
+func Valid(s string) bool {
+    if len(s) != Length || s[0] > '7' {
+        return false
+    }
+    for i := 0; i < len(s); i++ {
+        if !validChar(s[i]) {
+            return false
+        }
+    }
+    return true
+}
+
+// validChar reports whether c belongs to the Crockford base32 alphabet.
+func validChar(c byte) bool {
+    for i := 0; i < len(crockford); i++ {
+        if crockford[i] == c {
+            return true
+        }
+    }
+    return false
+}
+
+// Token returns a random secret of 192 bits, URL-safe base64 encoded.
+func Token() string {
+    var b [24]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        panic("ids: failed to read random bytes: " + err.Error())
+    }
+    return base64.RawURLEncoding.EncodeToString(b[:])
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package ids
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+    // 1469918176385 is the timestamp of the example in the ULID specification
+    var example [16]byte
+    ms := uint64(1469918176385)
+    for i := 0; i < 6; i++ {
+        example[i] = byte(ms >> (40 - 8*i))
+    }
+
+    var ones [16]byte
+    for i := range ones {
+        ones[i] = 0xFF
+    }
+
+    tests := []struct {
+        name string
+        in   [16]byte
+        want string
+    }{
+        {"zero", [16]byte{}, "00000000000000000000000000"},
+        {"max", ones, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+        {"lowest bit", [16]byte{15: 1}, "00000000000000000000000001"},
+        {"timestamp", example, "01ARYZ6S410000000000000000"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := encode(tt.in); got != tt.want {
+                t.Errorf("encode() = %s, want %s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNewSortsByTime(t *testing.T) {
+    prev := New()
+    for i := 0; i < 5; i++ {
+        time.Sleep(2 * time.Millisecond)
+        id := New()
+        if id <= prev {
+            t.Fatalf("%s created after %s sorts before it", id, prev)
+        }
+        prev = id
+    }
+}
+
+func TestNewIsUnique(t *testing.T) {
+    seen := make(map[string]bool)
+    for i := 0; i < 100000; i++ {
+        id := New()
+        if !Valid(id) {
+            t.Fatalf("New() = %q is not valid", id)
+        }
+        if seen[id] {
+            t.Fatalf("duplicate ID %s after %d IDs", id, i)
+        }
+        seen[id] = true
+    }
+}
+
+func TestValid(t *testing.T) {
+    tests := []struct {
+        id   string
+        want bool
+    }{
+        {"01ARYZ6S410000000000000000", true},
+        {"7ZZZZZZZZZZZZZZZZZZZZZZZZZ", true},
+        {"", false},
+        {"01ARYZ6S41000000000000000", false},
+        {"01ARYZ6S4100000000000000000", false},
+        {"8ZZZZZZZZZZZZZZZZZZZZZZZZZ", false},
+        {"01aryz6s410000000000000000", false},
+        {"01ARYZ6S41000000000000000I", false},
+        {"01ARYZ6S41000000000000000U", false},
+        {"../../../../etc/passwd0000", false},
+        {"job_1709223344000000000000", false},
+    }
+
+    for _, tt := range tests {
+        if got := Valid(tt.id); got != tt.want {
+            t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+        }
+    }
+}
+
+func TestToken(t *testing.T) {
+    a, b := Token(), Token()
+    if len(a) != 32 || strings.ContainsAny(a, "+/=") {
+        t.Errorf("Token() = %q, want 32 URL-safe characters", a)
+    }
+    if a == b {
+        t.Error("Token() returned the same token twice")
+    }
+}
@@ -8,6 +8,8 @@ import (
     "os"
     "path/filepath"
     "time"
+
+    "upscale-service/internal/ids"
 )
 
 // Config holds the configuration settings for the storage manager.
@@ -17,6 +19,8 @@ type Config struct {
     MaxFileSizeMB   int64
     CleanupTTL      time.Duration
     RetentionPolicy string
+    // InUse reports files that must survive cleanup, e.g. inputs of queued jobs.
+    InUse           func(path string) bool
 }
 
 // Manager handles file system operations for uploads and outputs.
@@ -47,7 +51,7 @@ func (m *Manager) SaveUpload(filename string, data []byte) (string, error) {
     }
     
     path := filepath.Join(m.config.UploadDir, 
-        fmt.Sprintf("%d_%s", time.Now().UnixNano(), sanitizeFilename(filename)))
+        fmt.Sprintf("%s_%s", ids.New(), sanitizeFilename(filename)))
     
     if err := os.WriteFile(path, data, 0644); err != nil {
         return "", fmt.Errorf("failed to save file: %w", err)
@@ -67,6 +71,11 @@ func (m *Manager) GetOutputPath(jobID, originalFilename string) string {
         fmt.Sprintf("%s_upscaled%s", jobID, ext))
 }
 
+// MaxFileSize returns the largest accepted upload in bytes.
+func (m *Manager) MaxFileSize() int64 {
+    return m.config.MaxFileSizeMB * 1024 * 1024
+}
+
 // GetOutputDir returns the configured output directory path.
 func (m *Manager) GetOutputDir() string {
     return m.config.OutputDir
@@ -100,6 +109,9 @@ func (m *Manager) cleanupDir(dir string, cutoff time.Time) error {
         
         if info.ModTime().Before(cutoff) {
             path := filepath.Join(dir, entry.Name())
+            if m.config.InUse != nil && m.config.InUse(path) {
+                continue
+            }
             if err := os.Remove(path); err != nil {
                 // Log but continue
                 fmt.Printf("Failed to remove %s: %v\n", path, err)
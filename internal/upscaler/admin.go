@@ -0,0 +1,138 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMaintenance is returned by SubmitJob while maintenance mode is enabled.
+var ErrMaintenance = errors.New("service is in maintenance mode")
+
+// State describes the dispatch state of the service.
+type State struct {
+    // Paused is set while workers do not start queued jobs.
+    Paused       bool `json:"paused"`
+    // Maintenance is set while new jobs are rejected.
+    Maintenance  bool `json:"maintenance"`
+    ShuttingDown bool `json:"shutting_down"`
+    Queued       int  `json:"queued"`
+    Running      int  `json:"running"`
+}
+
+// QueueView is a snapshot of the queued and running jobs.
+type QueueView struct {
+    State   State        `json:"state"`
+    // Queued lists the queued jobs in start order.
+    Queued  []QueuedJob  `json:"queued"`
+    Running []RunningJob `json:"running"`
+}
+
+// QueuedJob describes a job waiting in the queue.
+type QueuedJob struct {
+    ID          string    `json:"job_id"`
+    Position    int       `json:"position"`
+    Priority    Priority  `json:"priority"`
+    Device      string    `json:"device,omitempty"`
+    Model       string    `json:"model"`
+    InputSize   ImageSize `json:"input_size"`
+    SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// RunningJob describes a job being processed.
+type RunningJob struct {
+    ID        string    `json:"job_id"`
+    Device    string    `json:"device"`
+    Model     string    `json:"model"`
+    Progress  int       `json:"progress"`
+    Stage     string    `json:"stage,omitempty"`
+    StartedAt time.Time `json:"started_at"`
+}
+
+// PauseDispatch stops workers from starting queued jobs. Running jobs continue
+// and new jobs are still accepted.
+func (s *Service) PauseDispatch() {
+    s.queue.pause(true)
+}
+
+// ResumeDispatch lets workers start queued jobs again.
+func (s *Service) ResumeDispatch() {
+    s.queue.pause(false)
+}
+
+// SetMaintenance enables or disables maintenance mode, in which SubmitJob
+// rejects new jobs with ErrMaintenance while queued and running jobs finish.
+func (s *Service) SetMaintenance(enabled bool) {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    s.maintenance = enabled
+}
+
+// State returns the dispatch state of the service.
+func (s *Service) State() State {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    return s.state()
+}
+
+// state returns the dispatch state. The caller must hold jobsMu.
+func (s *Service) state() State {
+    running := 0
+    for _, job := range s.store.List() {
+        if job.Status == "processing" {
+            running++
+        }
+    }
+
+    return State{
+        Paused:       s.queue.paused(),
+        Maintenance:  s.maintenance,
+        ShuttingDown: s.shuttingDown,
+        Queued:       s.queue.len(),
+        Running:      running,
+    }
+}
+
+// Queue returns the queued jobs in start order and the running jobs.
+func (s *Service) Queue() QueueView {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    view := QueueView{
+        State:   s.state(),
+        Queued:  make([]QueuedJob, 0),
+        Running: make([]RunningJob, 0),
+    }
+
+    for i, job := range s.queue.ordered() {
+        view.Queued = append(view.Queued, QueuedJob{
+            ID:          job.ID,
+            Position:    i + 1,
+            Priority:    job.Request.Priority,
+            Device:      job.Request.Device,
+            Model:       job.Request.ModelName,
+            InputSize:   job.InputSize,
+            SubmittedAt: job.StartTime,
+        })
+    }
+
+    for _, job := range s.store.List() {
+        if job.Status != "processing" {
+            continue
+        }
+        view.Running = append(view.Running, RunningJob{
+            ID:        job.ID,
+            Device:    job.Device,
+            Model:     job.Request.ModelName,
+            Progress:  job.Progress,
+            Stage:     job.Stage,
+            StartedAt: job.StartedAt,
+        })
+    }
+
+    return view
+}
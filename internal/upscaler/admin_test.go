@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newDelayService starts a service with one worker running the "delay" model.
+func newDelayService(t *testing.T, delay time.Duration) (*Service, func() (string, error)) {
+    t.Helper()
+
+    dir := t.TempDir()
+    s := NewService(Config{WorkDir: filepath.Join(dir, "work")})
+    s.engines = nil
+    s.RegisterEngine(&delayEngine{Engine: NewResampleEngine(), delay: delay})
+    s.StartWorkers(1)
+    writeTestImage(t, filepath.Join(dir, "in.png"), 40, 30)
+
+    n := 0
+    submit := func() (string, error) {
+        n++
+        return s.SubmitJob(Request{
+            ModelName:  "delay",
+            Scale:      2,
+            InputPath:  filepath.Join(dir, "in.png"),
+            OutputPath: filepath.Join(dir, fmt.Sprintf("out-%d.png", n)),
+        })
+    }
+    return s, submit
+}
+
+func TestPauseBlocksDispatch(t *testing.T) {
+    s, submit := newDelayService(t, 200*time.Millisecond)
+
+    running, err := submit()
+    if err != nil {
+        t.Fatal(err)
+    }
+    waitForStatus(t, s, running, "processing")
+
+    // The running job finishes, the queued one waits
+    s.PauseDispatch()
+    queued, err := submit()
+    if err != nil {
+        t.Fatalf("SubmitJob() while paused error = %v", err)
+    }
+    waitForStatus(t, s, running, "completed")
+    time.Sleep(100 * time.Millisecond)
+    if job, _ := s.GetJob(queued); job.Status != "queued" {
+        t.Fatalf("job status while paused = %s, want queued", job.Status)
+    }
+
+    state := s.State()
+    if !state.Paused || state.Queued != 1 || state.Running != 0 {
+        t.Errorf("state = %+v, want paused with one queued job", state)
+    }
+    if view := s.Queue(); len(view.Queued) != 1 || view.Queued[0].ID != queued || view.Queued[0].Position != 1 {
+        t.Errorf("queue = %+v, want %s at position 1", view.Queued, queued)
+    }
+
+    s.ResumeDispatch()
+    waitForStatus(t, s, queued, "completed")
+    if s.State().Paused {
+        t.Error("still paused after ResumeDispatch")
+    }
+}
+
+func TestMaintenanceRejectsNewJobs(t *testing.T) {
+    s, submit := newDelayService(t, 10*time.Millisecond)
+
+    s.PauseDispatch()
+    queued, err := submit()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    s.SetMaintenance(true)
+    if _, err := submit(); !errors.Is(err, ErrMaintenance) {
+        t.Fatalf("SubmitJob() in maintenance error = %v, want ErrMaintenance", err)
+    }
+    if _, err := s.SubmitBatch([]Request{{ModelName: "delay", Scale: 2}}); !errors.Is(err, ErrMaintenance) {
+        t.Fatalf("SubmitBatch() in maintenance error = %v, want ErrMaintenance", err)
+    }
+    if !s.State().Maintenance {
+        t.Error("state does not report maintenance")
+    }
+
+    // Jobs queued before maintenance still run
+    s.ResumeDispatch()
+    waitForStatus(t, s, queued, "completed")
+
+    s.SetMaintenance(false)
+    id, err := submit()
+    if err != nil {
+        t.Fatalf("SubmitJob() after maintenance error = %v", err)
+    }
+    waitForStatus(t, s, id, "completed")
+}
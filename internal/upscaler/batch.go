@@ -0,0 +1,157 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"fmt"
+	"sort"
+
+	"upscale-service/internal/ids"
+)
+
+// Batch is a group of jobs submitted together, with their aggregate state.
+type Batch struct {
+    ID       string
+    // Status is queued, processing, completed, partial (finished with some
+    // items failed or cancelled), failed or cancelled.
+    Status   string
+    // Progress is the average progress of the items in percent.
+    Progress int
+    // Counts holds the number of items per job status.
+    Counts   map[string]int
+    // Jobs are snapshots of the items in submission order.
+    Jobs     []*Job
+}
+
+// SubmitBatch queues one job per request as a batch. The batch is accepted
+// whenever a single job would be, so its items may take the queue past
+// MaxQueueSize. With DownloadTokens, all items share one token.
+func (s *Service) SubmitBatch(reqs []Request) (*Batch, error) {
+    if len(reqs) == 0 {
+        return nil, fmt.Errorf("%w: empty batch", ErrInvalidRequest)
+    }
+    if s.config.MaxBatchSize > 0 && len(reqs) > s.config.MaxBatchSize {
+        return nil, fmt.Errorf("%w: batch of %d images exceeds the maximum of %d",
+            ErrInvalidRequest, len(reqs), s.config.MaxBatchSize)
+    }
+
+    sizes := make([]ImageSize, len(reqs))
+    for i, req := range reqs {
+        if err := s.validateRequest(req); err != nil {
+            return nil, err
+        }
+        // Only used for estimates, the item fails later if it is unreadable
+        sizes[i], _ = s.getImageSize(req.InputPath)
+    }
+
+    batch, err := s.submitBatch(reqs, sizes)
+    if err != nil {
+        return nil, err
+    }
+
+    // Once per model for all items, outside jobsMu
+    s.snapshotModels(reqs...)
+    return batch, nil
+}
+
+// submitBatch queues the validated requests of a batch if submissions are
+// accepted, or none of them.
+func (s *Service) submitBatch(reqs []Request, sizes []ImageSize) (*Batch, error) {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    if err := s.accepting(); err != nil {
+        return nil, err
+    }
+
+    token := ""
+    if s.config.DownloadTokens {
+        token = ids.Token()
+    }
+
+    batchID := ids.New()
+    jobs := make([]*Job, 0, len(reqs))
+    for i, req := range reqs {
+        req.BatchID = batchID
+        req.BatchItem = i
+
+        job, err := s.enqueue(req, sizes[i], token)
+        if err != nil {
+            // Do not leave a partial batch behind
+            for _, j := range jobs {
+                s.queue.remove(j)
+                j.ErrorCode = ErrCodeCancelled
+                s.setStatus(j, "cancelled")
+            }
+            return nil, err
+        }
+        jobs = append(jobs, job)
+    }
+
+    return summarizeBatch(batchID, jobs), nil
+}
+
+// MaxBatchSize returns the largest number of images in a batch (0 = unlimited).
+func (s *Service) MaxBatchSize() int {
+    return s.config.MaxBatchSize
+}
+
+// GetBatch returns a batch with the current state of its items.
+func (s *Service) GetBatch(batchID string) (*Batch, bool) {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    jobs := make([]*Job, 0)
+    for _, job := range s.store.List() {
+        if job.Request.BatchID == batchID {
+            jobs = append(jobs, job)
+        }
+    }
+    if len(jobs) == 0 {
+        return nil, false
+    }
+    sort.Slice(jobs, func(i, j int) bool {
+        return jobs[i].Request.BatchItem < jobs[j].Request.BatchItem
+    })
+
+    return summarizeBatch(batchID, jobs), true
+}
+
+// summarizeBatch aggregates the state of the items. The caller must hold jobsMu.
+func summarizeBatch(batchID string, jobs []*Job) *Batch {
+    b := &Batch{ID: batchID, Counts: make(map[string]int), Jobs: make([]*Job, len(jobs))}
+    for i, job := range jobs {
+        b.Jobs[i] = job.snapshot()
+    }
+
+    finished, progress := 0, 0
+    for _, job := range jobs {
+        b.Counts[job.Status]++
+        if job.Finished() {
+            finished++
+            progress += 100
+        } else {
+            progress += job.Progress
+        }
+    }
+    b.Progress = progress / len(jobs)
+
+    n := len(jobs)
+    switch {
+    case b.Counts["completed"] == n:
+        b.Status = "completed"
+    case finished == n && b.Counts["completed"] > 0:
+        b.Status = "partial"
+    case b.Counts["cancelled"] == n:
+        b.Status = "cancelled"
+    case finished == n:
+        b.Status = "failed"
+    case b.Counts["queued"] == n:
+        b.Status = "queued"
+    default:
+        b.Status = "processing"
+    }
+
+    return b
+}
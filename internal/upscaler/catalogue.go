@@ -0,0 +1,341 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultModelsPollInterval is the interval at which WatchModels looks for
+// changed model files and manifests.
+const defaultModelsPollInterval = 10 * time.Second
+
+// modelCatalogue is a snapshot of the installed models with their manifests
+// applied and their files verified. A catalogue is never modified; a reload
+// builds a new one and swaps it in.
+type modelCatalogue struct {
+    registry    *modelRegistry
+    // models are in resolution order. Retired models were removed from disk
+    // but are kept for the unfinished jobs that use them.
+    models      []catalogueModel
+    // listErr is the last error listing the models of an engine.
+    listErr     error
+    // fingerprint identifies the model files and manifests the catalogue
+    // was built from.
+    fingerprint uint64
+}
+
+// catalogueModel is a model in the catalogue and the engine serving it.
+type catalogueModel struct {
+    engine  Engine
+    info    ModelInfo
+    retired bool
+}
+
+// ModelsChange lists the models added to, removed from or changed in the
+// catalogue by a reload.
+type ModelsChange struct {
+    Added   []string `json:"added,omitempty"`
+    Removed []string `json:"removed,omitempty"`
+    Changed []string `json:"changed,omitempty"`
+}
+
+// empty reports whether nothing changed.
+func (c ModelsChange) empty() bool {
+    return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// String summarises the change for the log.
+func (c ModelsChange) String() string {
+    var parts []string
+    if len(c.Added) > 0 {
+        parts = append(parts, "added "+strings.Join(c.Added, ", "))
+    }
+    if len(c.Removed) > 0 {
+        parts = append(parts, "removed "+strings.Join(c.Removed, ", "))
+    }
+    if len(c.Changed) > 0 {
+        parts = append(parts, "changed "+strings.Join(c.Changed, ", "))
+    }
+    return strings.Join(parts, "; ")
+}
+
+// lookup finds a model, including retired ones.
+func (c *modelCatalogue) lookup(model string) (catalogueModel, bool) {
+    for _, m := range c.models {
+        if m.info.Name == model {
+            return m, true
+        }
+    }
+    return catalogueModel{}, false
+}
+
+// hasRetired reports whether the catalogue keeps removed models.
+func (c *modelCatalogue) hasRetired() bool {
+    return slices.ContainsFunc(c.models, func(m catalogueModel) bool { return m.retired })
+}
+
+// catalogue returns the current model catalogue, building the first one on
+// demand.
+func (s *Service) catalogue() *modelCatalogue {
+    if c := s.models.Load(); c != nil {
+        return c
+    }
+    // Built without pins: there is no earlier catalogue to keep models from
+    c := s.buildCatalogue(nil, nil)
+    if !s.models.CompareAndSwap(nil, c) {
+        return s.models.Load()
+    }
+    return c
+}
+
+// buildCatalogue reads the manifests and lists the models of all engines.
+// Models of prev that are gone but still pinned are kept as retired.
+func (s *Service) buildCatalogue(prev *modelCatalogue, pinned map[string]bool) *modelCatalogue {
+    dirs := s.config.manifestDirs()
+    c := &modelCatalogue{
+        registry:    loadRegistry(dirs),
+        fingerprint: modelsFingerprint(dirs),
+    }
+
+    seen := make(map[string]bool)
+    for _, engine := range s.Engines() {
+        engineModels, err := engine.Models()
+        if err != nil {
+            c.listErr = fmt.Errorf("failed to list %s models: %w", engine.Name(), err)
+            continue
+        }
+
+        for _, info := range engineModels {
+            if seen[info.Name] {
+                continue
+            }
+            seen[info.Name] = true
+            s.describe(c.registry, engine, &info)
+            c.models = append(c.models, catalogueModel{engine: engine, info: info})
+        }
+    }
+
+    if prev != nil {
+        for _, m := range prev.models {
+            if !seen[m.info.Name] && pinned[m.info.Name] {
+                m.retired = true
+                c.models = append(c.models, m)
+            }
+        }
+    }
+
+    // Exactly one model is the default
+    def := defaultModel(c.available(), s.config.DefaultModel)
+    for i := range c.models {
+        c.models[i].info.Default = c.models[i].info.Name == def
+    }
+    return c
+}
+
+// available returns the models offered to new requests.
+func (c *modelCatalogue) available() []ModelInfo {
+    models := make([]ModelInfo, 0, len(c.models))
+    for _, m := range c.models {
+        if !m.retired {
+            models = append(models, m.info)
+        }
+    }
+    return models
+}
+
+// reloadModels builds a new catalogue from the model files, swaps it in and
+// reports the models that changed. Removed models stay resolvable until the
+// queued and running jobs using them have finished.
+func (s *Service) reloadModels() ModelsChange {
+    s.reloadMu.Lock()
+    defer s.reloadMu.Unlock()
+
+    prev := s.models.Load()
+    c := s.buildCatalogue(prev, s.pinModels())
+    s.models.Store(c)
+
+    if prev == nil {
+        return ModelsChange{}
+    }
+    change := diffCatalogues(prev, c)
+
+    var released []string
+    for _, m := range prev.models {
+        if m.retired {
+            if _, ok := c.lookup(m.info.Name); !ok {
+                released = append(released, m.info.Name)
+            }
+        }
+    }
+    if len(released) > 0 {
+        log.Printf("Released removed model(s) no longer used by jobs: %s", strings.Join(released, ", "))
+    }
+
+    if !change.empty() {
+        log.Printf("Model catalogue changed: %s", change)
+        for _, m := range c.models {
+            if m.retired && slices.Contains(change.Removed, m.info.Name) {
+                log.Printf("Model %s runs from its snapshot until the jobs using it have finished", m.info.Name)
+            }
+        }
+        s.events.Publish(Event{
+            Type:   EventModelsChanged,
+            Models: &change,
+            Time:   time.Now(),
+        })
+    }
+    return change
+}
+
+// diffCatalogues compares the models two catalogues offer to new requests.
+func diffCatalogues(prev, next *modelCatalogue) ModelsChange {
+    var change ModelsChange
+
+    old := make(map[string]ModelInfo)
+    for _, m := range prev.available() {
+        old[m.Name] = m
+    }
+    for _, m := range next.available() {
+        o, ok := old[m.Name]
+        switch {
+        case !ok:
+            change.Added = append(change.Added, m.Name)
+        case !reflect.DeepEqual(o, m):
+            change.Changed = append(change.Changed, m.Name)
+        }
+        delete(old, m.Name)
+    }
+    for name := range old {
+        change.Removed = append(change.Removed, name)
+    }
+
+    slices.Sort(change.Added)
+    slices.Sort(change.Removed)
+    slices.Sort(change.Changed)
+    return change
+}
+
+// pinModels returns the models used by queued and running jobs and releases
+// the snapshots of all other models. The snapshots are removed without jobsMu
+// but under snapshotMu, so jobs queued meanwhile take theirs afterwards.
+func (s *Service) pinModels() map[string]bool {
+    s.snapshotMu.Lock()
+    defer s.snapshotMu.Unlock()
+
+    pinned := make(map[string]bool)
+    s.jobsMu.Lock()
+    for _, job := range s.store.List() {
+        if job.Finished() {
+            continue
+        }
+        for _, model := range requestModels(job.Request) {
+            pinned[model] = true
+        }
+    }
+    s.jobsMu.Unlock()
+
+    s.releaseSnapshots(pinned)
+    return pinned
+}
+
+// requestModels returns the models a request runs: its model, or the models
+// of the upscale stages of its pipeline.
+func requestModels(req Request) []string {
+    if len(req.Pipeline) == 0 {
+        return []string{req.ModelName}
+    }
+
+    var models []string
+    for _, st := range req.Pipeline {
+        if st.Type == StageUpscale {
+            models = append(models, stageModel(req, st))
+        }
+    }
+    return models
+}
+
+// validateModels rejects requests for models that have been removed while
+// earlier jobs still use them.
+func (s *Service) validateModels(req Request) error {
+    c := s.catalogue()
+    for _, model := range requestModels(req) {
+        if m, ok := c.lookup(model); ok && m.retired {
+            return fmt.Errorf("%w: %s has been removed", ErrModelNotFound, model)
+        }
+    }
+    return nil
+}
+
+// WatchModels polls the models directories every ModelsPollInterval and
+// reloads the model catalogue when model files or manifests change, until
+// ctx is done. It returns immediately if polling is disabled.
+func (s *Service) WatchModels(ctx context.Context) {
+    interval := s.config.ModelsPollInterval
+    if interval < 0 {
+        return
+    }
+    if interval == 0 {
+        interval = defaultModelsPollInterval
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+
+        // Retired models are released by a reload once their jobs are done
+        c := s.catalogue()
+        if c.hasRetired() || modelsFingerprint(s.config.manifestDirs()) != c.fingerprint {
+            s.reloadModels()
+        }
+    }
+}
+
+// modelsFingerprint hashes the names, sizes and modification times of the
+// files in the models directories and their "models-*" subdirectories.
+func modelsFingerprint(dirs []string) uint64 {
+    h := fnv.New64a()
+
+    var walk func(dir string, depth int)
+    walk = func(dir string, depth int) {
+        entries, err := os.ReadDir(dir)
+        if err != nil {
+            return
+        }
+        for _, entry := range entries {
+            path := filepath.Join(dir, entry.Name())
+            if entry.IsDir() {
+                if depth == 0 && strings.HasPrefix(entry.Name(), "models-") {
+                    walk(path, depth+1)
+                }
+                continue
+            }
+            fi, err := entry.Info()
+            if err != nil {
+                continue
+            }
+            fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, fi.Size(), fi.ModTime().UnixNano())
+        }
+    }
+
+    for _, dir := range dirs {
+        walk(dir, 0)
+    }
+    return h.Sum64()
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeModel creates the .param and .bin files of a realesrgan model.
+func writeModel(t *testing.T, dir, name string) {
+    t.Helper()
+
+    if err := os.WriteFile(filepath.Join(dir, name+".param"), []byte("7767517"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, name+".bin"), make([]byte, 2*minWeightsSize), 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// newModelsService creates a service with a fake realesrgan binary serving
+// the models in the returned directory.
+func newModelsService(t *testing.T, cfg Config) (*Service, string) {
+    t.Helper()
+
+    dir := t.TempDir()
+    bin := filepath.Join(t.TempDir(), "realesrgan-ncnn-vulkan")
+    if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    cfg.ModelsPath = dir
+    cfg.BinaryPath = bin
+    cfg.WorkDir = t.TempDir()
+    return NewService(cfg), dir
+}
+
+func TestRemovedModelRunsFromSnapshot(t *testing.T) {
+    s, dir := newModelsService(t, Config{ResampleFallback: true})
+    writeModel(t, dir, "realesrgan-x4plus")
+    writeModel(t, dir, "custom")
+    if _, err := s.VerifyModels(); err != nil {
+        t.Fatal(err)
+    }
+
+    input := filepath.Join(t.TempDir(), "in.png")
+    if err := os.WriteFile(input, []byte("png"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    job, err := s.submit(Request{InputPath: input, ModelName: "custom", Scale: 4}, ImageSize{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    s.snapshotModels(job.Request)
+
+    for _, ext := range []string{".param", ".bin"} {
+        if err := os.Remove(filepath.Join(dir, "custom"+ext)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    change := s.reloadModels()
+    if !slices.Equal(change.Removed, []string{"custom"}) {
+        t.Fatalf("removed = %v, want [custom]", change.Removed)
+    }
+
+    models, _ := s.GetAvailableModels()
+    for _, m := range models {
+        if m.Name == "custom" {
+            t.Fatal("removed model is still listed")
+        }
+    }
+    if err := s.validateRequest(Request{InputPath: input, ModelName: "custom", Scale: 4}); !errors.Is(err, ErrModelNotFound) {
+        t.Fatalf("new request for removed model: err = %v, want ErrModelNotFound", err)
+    }
+
+    // The queued job keeps its engine and model instead of falling back
+    engine, model, err := s.resolveEngine("custom")
+    if err != nil {
+        t.Fatalf("resolveEngine: %v", err)
+    }
+    if engine.Name() != EngineRealESRGAN || model != "custom" {
+        t.Fatalf("resolved %s/%s, want %s/custom", engine.Name(), model, EngineRealESRGAN)
+    }
+    snap, ok := engine.(*snapshotEngine)
+    if !ok {
+        t.Fatalf("engine is %T, want *snapshotEngine", engine)
+    }
+    for _, ext := range []string{".param", ".bin"} {
+        if _, err := os.Stat(filepath.Join(snap.dir, "custom"+ext)); err != nil {
+            t.Errorf("snapshot file missing: %v", err)
+        }
+    }
+    if scales := s.supportedScales(engine, model); !slices.Equal(scales, []int{2, 3, 4}) {
+        t.Errorf("supported scales = %v, want [2 3 4]", scales)
+    }
+
+    // Released once the job has finished
+    s.jobsMu.Lock()
+    s.setStatus(job, "completed")
+    s.jobsMu.Unlock()
+    s.reloadModels()
+
+    if _, _, err := s.lookupModel("custom"); !errors.Is(err, ErrModelNotFound) {
+        t.Fatalf("lookup after release: err = %v, want ErrModelNotFound", err)
+    }
+    if _, err := os.Stat(snap.dir); !os.IsNotExist(err) {
+        t.Fatalf("snapshot not released: %v", err)
+    }
+}
+
+func TestResumedJobRunsFromSnapshot(t *testing.T) {
+    s, dir := newModelsService(t, Config{ResampleFallback: true})
+    writeModel(t, dir, "realesrgan-x4plus")
+    writeModel(t, dir, "custom")
+    if _, err := s.VerifyModels(); err != nil {
+        t.Fatal(err)
+    }
+
+    // A job of the previous run, queued before the restart without a snapshot
+    job := &Job{ID: "resumed", Status: "processing", Request: Request{ModelName: "custom", Scale: 4}}
+    if err := s.store.Put(job); err != nil {
+        t.Fatal(err)
+    }
+    if resumed, err := s.ResumeJobs(); err != nil || resumed != 1 {
+        t.Fatalf("ResumeJobs() = %d, %v, want 1", resumed, err)
+    }
+
+    for _, ext := range []string{".param", ".bin"} {
+        if err := os.Remove(filepath.Join(dir, "custom"+ext)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if change := s.reloadModels(); !slices.Equal(change.Removed, []string{"custom"}) {
+        t.Fatalf("removed = %v, want [custom]", change.Removed)
+    }
+
+    engine, _, err := s.resolveEngine("custom")
+    if err != nil {
+        t.Fatalf("resolveEngine: %v", err)
+    }
+    snap, ok := engine.(*snapshotEngine)
+    if !ok {
+        t.Fatalf("engine is %T, want *snapshotEngine", engine)
+    }
+    for _, ext := range []string{".param", ".bin"} {
+        if _, err := os.Stat(filepath.Join(snap.dir, "custom"+ext)); err != nil {
+            t.Errorf("snapshot file missing: %v", err)
+        }
+    }
+}
+
+func TestReloadReportsChanges(t *testing.T) {
+    s, dir := newModelsService(t, Config{})
+    writeModel(t, dir, "realesrgan-x4plus")
+    writeModel(t, dir, "old")
+    s.reloadModels()
+
+    writeModel(t, dir, "new")
+    if err := os.Remove(filepath.Join(dir, "old.param")); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Remove(filepath.Join(dir, "old.bin")); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "realesrgan-x4plus.yaml"), []byte("display_name: Real-ESRGAN\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    events, unsubscribe := s.Subscribe(4)
+    defer unsubscribe()
+
+    change := s.reloadModels()
+    want := ModelsChange{Added: []string{"new"}, Removed: []string{"old"}, Changed: []string{"realesrgan-x4plus"}}
+    if !slices.Equal(change.Added, want.Added) || !slices.Equal(change.Removed, want.Removed) || !slices.Equal(change.Changed, want.Changed) {
+        t.Fatalf("change = %+v, want %+v", change, want)
+    }
+
+    select {
+    case e := <-events:
+        if e.Type != EventModelsChanged || e.Models == nil {
+            t.Fatalf("event = %+v, want %s", e, EventModelsChanged)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("no event published")
+    }
+
+    if change := s.reloadModels(); !change.empty() {
+        t.Fatalf("reload without changes reported %+v", change)
+    }
+}
+
+func TestModelDirOverridesModelsPath(t *testing.T) {
+    snap := t.TempDir()
+    for _, name := range []string{"scale2.0x_model.param", "up2x-conservative.param"} {
+        if err := os.WriteFile(filepath.Join(snap, name), []byte("7767517"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    cfg := EngineConfig{BinaryPath: "/nonexistent", ModelsPath: "/models"}
+    task := Task{InputPath: "in.png", OutputPath: "out.png", Scale: 2, ModelDir: snap}
+
+    tests := []struct {
+        name string
+        args func() ([]string, error)
+    }{
+        {"realesrgan", func() ([]string, error) {
+            e := &realesrganEngine{config: RealESRGANConfig{ModelsPath: cfg.ModelsPath}}
+            return e.buildArgs(Task{ModelName: "custom", ModelDir: snap}), nil
+        }},
+        {"realcugan", func() ([]string, error) {
+            task := task
+            task.ModelName = "realcugan-se"
+            return NewRealCUGANEngine(cfg).(*realcuganEngine).buildArgs(task)
+        }},
+        {"waifu2x", func() ([]string, error) {
+            task := task
+            task.ModelName = "waifu2x-cunet"
+            return NewWaifu2xEngine(cfg).(*waifu2xEngine).buildArgs(task)
+        }},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            args, err := tt.args()
+            if err != nil {
+                t.Fatal(err)
+            }
+            i := slices.Index(args, "-m")
+            if i < 0 || args[i+1] != snap {
+                t.Fatalf("args = %v, want -m %s", args, snap)
+            }
+        })
+    }
+}
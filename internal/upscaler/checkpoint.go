@@ -0,0 +1,210 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+    manifestFile   = "manifest.json"
+    checkpointFile = "checkpoint.json"
+)
+
+// jobManifest is written to the job directory when processing starts, so that a
+// job interrupted by a crash or restart can be discovered and resumed.
+type jobManifest struct {
+    ID            string    `json:"id"`
+    Request       Request   `json:"request"`
+    StartTime     time.Time `json:"start_time"`
+    DownloadToken string    `json:"download_token,omitempty"`
+    // Queued is set for jobs that had not started when the service shut down.
+    Queued        bool      `json:"queued,omitempty"`
+}
+
+// tileCheckpoint records which tiles of a split-and-stitch run are complete.
+type tileCheckpoint struct {
+    // Key identifies the tile plan; a checkpoint with a different key is discarded.
+    Key  string `json:"key"`
+    Done []int  `json:"done"`
+}
+
+// jobDir returns the directory holding the working files of a job.
+func (s *Service) jobDir(jobID string) string {
+    return filepath.Join(s.config.WorkDir, "jobs", jobID)
+}
+
+// writeManifest records a job in its directory.
+func writeManifest(dir string, job *Job) error {
+    return writeJSONAtomic(filepath.Join(dir, manifestFile), jobManifest{
+        ID:            job.ID,
+        Request:       job.Request,
+        StartTime:     job.StartTime,
+        DownloadToken: job.DownloadToken,
+        Queued:        job.Status == "queued",
+    })
+}
+
+// checkpointKey identifies a tile plan for the given task.
+func checkpointKey(task Task, plan tilePlan) string {
+    return fmt.Sprintf("%s/%d/%dx%d/%d/%d",
+        task.ModelName, task.Scale, plan.Input.Width, plan.Input.Height, plan.TileSize, plan.Overlap)
+}
+
+// loadCheckpoint returns the set of completed tiles stored in dir for the given key.
+// Tiles whose output file is missing are treated as not done.
+func loadCheckpoint(dir, key string, outputs []string) map[int]bool {
+    done := make(map[int]bool)
+
+    data, err := os.ReadFile(filepath.Join(dir, checkpointFile))
+    if err != nil {
+        return done
+    }
+
+    var cp tileCheckpoint
+    if err := json.Unmarshal(data, &cp); err != nil || cp.Key != key {
+        return done
+    }
+
+    for _, i := range cp.Done {
+        if i < 0 || i >= len(outputs) {
+            continue
+        }
+        if _, err := os.Stat(outputs[i]); err == nil {
+            done[i] = true
+        }
+    }
+
+    return done
+}
+
+// saveCheckpoint persists the set of completed tiles.
+func saveCheckpoint(dir, key string, done map[int]bool) error {
+    cp := tileCheckpoint{Key: key, Done: make([]int, 0, len(done))}
+    for i := range done {
+        cp.Done = append(cp.Done, i)
+    }
+    return writeJSONAtomic(filepath.Join(dir, checkpointFile), cp)
+}
+
+// ResumeJobs re-queues jobs that were queued or processing when the service
+// stopped. Jobs are taken from the job store and, for stores that do not
+// survive a restart, from the manifests in the work directory. Split-and-stitch
+// jobs continue from their last completed tile. It returns the number of
+// re-queued jobs.
+func (s *Service) ResumeJobs() (int, error) {
+    stored := s.store.List()
+    sort.Slice(stored, func(i, j int) bool {
+        return stored[i].StartTime.Before(stored[j].StartTime)
+    })
+
+    // The models of the resumed jobs are snapshotted once, at the end
+    var reqs []Request
+    defer func() {
+        s.snapshotModels(reqs...)
+    }()
+
+    resumed := 0
+    for _, job := range stored {
+        if job.Status != "queued" && job.Status != "processing" {
+            continue
+        }
+        s.requeue(job, job.Status == "processing")
+        reqs = append(reqs, job.Request)
+        resumed++
+    }
+
+    root := filepath.Join(s.config.WorkDir, "jobs")
+    entries, err := os.ReadDir(root)
+    if errors.Is(err, os.ErrNotExist) {
+        return resumed, nil
+    }
+    if err != nil {
+        return resumed, fmt.Errorf("failed to read job dir: %w", err)
+    }
+
+    for _, entry := range entries {
+        if !entry.IsDir() {
+            continue
+        }
+
+        dir := filepath.Join(root, entry.Name())
+        data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+        if err != nil {
+            continue
+        }
+
+        var m jobManifest
+        if err := json.Unmarshal(data, &m); err != nil || m.ID != entry.Name() {
+            log.Printf("Skipping invalid job manifest in %s", dir)
+            continue
+        }
+
+        if _, exists := s.store.Get(m.ID); exists {
+            continue
+        }
+
+        s.requeue(&Job{
+            ID:            m.ID,
+            Request:       m.Request,
+            StartTime:     m.StartTime,
+            DownloadToken: m.DownloadToken,
+        }, !m.Queued)
+        reqs = append(reqs, m.Request)
+        resumed++
+    }
+
+    return resumed, nil
+}
+
+// requeue puts an interrupted job back into the queue. Jobs that were already
+// processing are marked as resumed. The caller snapshots the job's models.
+func (s *Service) requeue(job *Job, interrupted bool) {
+    if err := s.validateDevice(job.Request.Device); err != nil {
+        log.Printf("Job %s: %v, running on any device", job.ID, err)
+        job.Request.Device = ""
+    }
+
+    if job.InputSize.Width == 0 {
+        job.InputSize, _ = s.getImageSize(job.Request.InputPath)
+    }
+
+    s.jobsMu.Lock()
+    job.Progress = 0
+    job.TilesDone = 0
+    job.TilesTotal = 0
+    job.Pipeline = nil
+    job.Device = ""
+    job.Plan = nil
+    job.Attempts = nil
+    if interrupted {
+        job.Resumed = true
+        log.Printf("Resuming interrupted job %s", job.ID)
+    }
+    s.setStatus(job, "queued")
+    s.jobsMu.Unlock()
+
+    s.queue.push(job)
+}
+
+// writeJSONAtomic marshals v and replaces path with it atomically.
+func writeJSONAtomic(path string, v interface{}) error {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
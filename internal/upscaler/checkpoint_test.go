@@ -0,0 +1,160 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"upscale-service/internal/ids"
+)
+
+func TestLoadCheckpoint(t *testing.T) {
+    tests := []struct {
+        name    string
+        key     string
+        data    string
+        missing []int
+        want    []int
+    }{
+        {"complete", "k", "", nil, []int{0, 2}},
+        {"other plan", "other", "", nil, nil},
+        {"missing output", "k", "", []int{2}, []int{0}},
+        {"out of range", "k", `{"key":"k","done":[-1,1,7]}`, nil, []int{1}},
+        {"corrupt", "k", `{"key":`, nil, nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            outputs := make([]string, 3)
+            for i := range outputs {
+                outputs[i] = filepath.Join(dir, "tile_out_"+string(rune('a'+i))+".png")
+                if !slices.Contains(tt.missing, i) {
+                    if err := os.WriteFile(outputs[i], nil, 0644); err != nil {
+                        t.Fatal(err)
+                    }
+                }
+            }
+
+            if tt.data == "" {
+                if err := saveCheckpoint(dir, "k", map[int]bool{0: true, 2: true}); err != nil {
+                    t.Fatal(err)
+                }
+            } else if err := os.WriteFile(filepath.Join(dir, checkpointFile), []byte(tt.data), 0644); err != nil {
+                t.Fatal(err)
+            }
+
+            var got []int
+            for i := range loadCheckpoint(dir, tt.key, outputs) {
+                got = append(got, i)
+            }
+            slices.Sort(got)
+            if !slices.Equal(got, tt.want) {
+                t.Errorf("loadCheckpoint() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// failingEngine resamples but fails the run with the given number.
+type failingEngine struct {
+    Engine
+    failRun int
+    runs    int
+}
+
+func (e *failingEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    e.runs++
+    if e.runs == e.failRun {
+        return errors.New("engine crashed")
+    }
+    return e.Engine.Run(ctx, task, onProgress)
+}
+
+func TestUpscaleTiledResumesFromCheckpoint(t *testing.T) {
+    dir := t.TempDir()
+    s := NewService(Config{WorkDir: dir, SplitTileSize: 32, SplitOverlap: 4})
+
+    input := filepath.Join(dir, "in.png")
+    writeTestImage(t, input, 80, 60)
+    size := ImageSize{Width: 80, Height: 60}
+    task := Task{InputPath: input, OutputPath: filepath.Join(dir, "out.png"), Scale: 2, ModelName: "resample-lanczos", Format: "png"}
+    tiles := len(planTiles(size, 32, 4).Tiles)
+
+    var resumed int
+    exec := execution{
+        dir:     filepath.Join(dir, "job"),
+        onTiles: func(done, total, r int) { resumed = r },
+    }
+
+    engine := &failingEngine{Engine: NewResampleEngine(), failRun: 4}
+    if err := s.upscaleTiled(context.Background(), engine, task, size, exec); err == nil {
+        t.Fatal("upscaleTiled() succeeded, want the fourth tile to fail")
+    }
+
+    engine = &failingEngine{Engine: NewResampleEngine()}
+    if err := s.upscaleTiled(context.Background(), engine, task, size, exec); err != nil {
+        t.Fatalf("resumed upscaleTiled() error = %v", err)
+    }
+    if engine.runs != tiles-3 || resumed != 3 {
+        t.Errorf("resumed run ran %d tiles and skipped %d, want %d and 3", engine.runs, resumed, tiles-3)
+    }
+
+    // A different tile plan starts over
+    s.config.SplitTileSize = 48
+    engine = &failingEngine{Engine: NewResampleEngine()}
+    if err := s.upscaleTiled(context.Background(), engine, task, size, exec); err != nil {
+        t.Fatal(err)
+    }
+    if want := len(planTiles(size, 48, 4).Tiles); engine.runs != want || resumed != 0 {
+        t.Errorf("run with a new plan ran %d tiles and skipped %d, want %d and 0", engine.runs, resumed, want)
+    }
+}
+
+func TestResumeJobsFromManifests(t *testing.T) {
+    dir := t.TempDir()
+    s := NewService(Config{WorkDir: dir})
+
+    manifests := []jobManifest{
+        {ID: ids.New(), StartTime: time.Now().Add(-time.Minute)},
+        {ID: ids.New(), StartTime: time.Now(), Queued: true},
+    }
+    for _, m := range manifests {
+        m.Request = Request{InputPath: filepath.Join(dir, "missing.png"), Scale: 2}
+        if err := os.MkdirAll(s.jobDir(m.ID), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := writeJSONAtomic(filepath.Join(s.jobDir(m.ID), manifestFile), m); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // Manifests not matching their directory are skipped
+    other := s.jobDir(ids.New())
+    if err := os.MkdirAll(other, 0755); err != nil {
+        t.Fatal(err)
+    }
+    data, _ := json.Marshal(jobManifest{ID: "elsewhere"})
+    if err := os.WriteFile(filepath.Join(other, manifestFile), data, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    n, err := s.ResumeJobs()
+    if err != nil || n != 2 {
+        t.Fatalf("ResumeJobs() = %d, %v, want 2", n, err)
+    }
+    for i, m := range manifests {
+        job, ok := s.GetJob(m.ID)
+        if !ok || job.Status != "queued" || job.Resumed != !m.Queued {
+            t.Errorf("job %d = %+v, want queued with resumed %v", i, job, !m.Queued)
+        }
+    }
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"fmt"
+)
+
+// Device kinds.
+const (
+    DeviceGPU = "gpu"
+    DeviceCPU = "cpu"
+)
+
+// Device is a compute device jobs can be bound to. Every device gets its own
+// workers, so jobs on different GPUs never share a device.
+type Device struct {
+    // Name identifies the device in requests and status (e.g. "gpu0", "cpu").
+    Name    string `json:"name"`
+    // Kind is DeviceGPU or DeviceCPU.
+    Kind    string `json:"kind"`
+    // GPUID is the Vulkan device index; -1 lets the engine pick a GPU.
+    GPUID   int    `json:"gpu_id"`
+    // Workers is the number of jobs run concurrently on the device.
+    Workers int    `json:"workers"`
+}
+
+// Matches reports whether the device satisfies a request's device preference:
+// "" or "auto" (any device), "gpu", "cpu" or a device name.
+func (d Device) Matches(pref string) bool {
+    switch pref {
+    case "", "auto":
+        return true
+    case DeviceGPU, DeviceCPU:
+        return d.Kind == pref
+    default:
+        return d.Name == pref
+    }
+}
+
+// normalizeDevices fills in names and kinds and derives a single device from the
+// legacy EnableGPU/GPUID settings if no devices are configured.
+func normalizeDevices(cfg Config) []Device {
+    devices := make([]Device, 0, len(cfg.Devices))
+    for _, d := range cfg.Devices {
+        if d.Kind == "" {
+            d.Kind = DeviceGPU
+        }
+        if d.Kind == DeviceCPU {
+            d.GPUID = -1
+        }
+        if d.Name == "" {
+            d.Name = deviceName(d)
+        }
+        devices = append(devices, d)
+    }
+
+    if len(devices) > 0 {
+        return devices
+    }
+
+    legacy := Device{Kind: DeviceCPU, GPUID: -1}
+    if cfg.EnableGPU {
+        legacy = Device{Kind: DeviceGPU, GPUID: cfg.GPUID}
+    }
+    legacy.Name = deviceName(legacy)
+    return []Device{legacy}
+}
+
+// deviceName returns the default name of a device.
+func deviceName(d Device) string {
+    switch {
+    case d.Kind == DeviceCPU:
+        return "cpu"
+    case d.GPUID < 0:
+        return "gpu"
+    default:
+        return fmt.Sprintf("gpu%d", d.GPUID)
+    }
+}
+
+// Devices returns the configured devices.
+func (s *Service) Devices() []Device {
+    return append([]Device(nil), s.devices...)
+}
+
+// validateDevice checks that at least one device can run jobs with the given preference.
+func (s *Service) validateDevice(pref string) error {
+    for _, d := range s.devices {
+        if d.Matches(pref) {
+            return nil
+        }
+    }
+    return fmt.Errorf("no device matches %q", pref)
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+)
+
+// Engine is an upscaling backend. Every model is served by exactly one engine,
+// so new backends can be added without touching the queue or the HTTP layer.
+type Engine interface {
+    // Name returns the unique identifier of the engine (e.g. "realesrgan").
+    Name() string
+
+    // Capabilities describes the optional features the engine supports.
+    Capabilities() Capabilities
+
+    // Available returns an error explaining why the engine cannot run, or nil.
+    Available() error
+
+    // Models lists the models this engine is able to run.
+    Models() ([]ModelInfo, error)
+
+    // SupportedScales returns the scale factors a model can produce in one run.
+    SupportedScales(model string) []int
+
+    // Run upscales a single image and reports progress in percent (0-100).
+    Run(ctx context.Context, task Task, onProgress func(int)) error
+}
+
+// Capabilities describes the optional features of an engine.
+type Capabilities struct {
+    // GPU is true if the engine can run on a GPU device.
+    GPU      bool     `json:"gpu"`
+    // TileSize is true if the engine honours Task.TileSize.
+    TileSize bool     `json:"tile_size"`
+    // Formats lists the output formats the engine can write.
+    Formats  []string `json:"formats"`
+}
+
+// Task is a single engine invocation derived from a Request.
+type Task struct {
+    InputPath  string
+    OutputPath string
+    Scale      int
+    ModelName  string
+    TileSize   int
+    Format     string
+    // Device is the device the task runs on; engines without GPU support ignore it.
+    Device     Device
+    // Options are the engine-specific settings of the request.
+    Options    EngineOptions
+    // ModelDir holds the model files instead of the engine's models
+    // directory, e.g. the snapshot of a removed model.
+    ModelDir   string
+}
+
+// EngineOptions are settings only some engines and models support. Unset
+// options use the defaults of the engine.
+type EngineOptions struct {
+    // Denoise is the denoise level (-1 to 3) of Real-CUGAN and waifu2x models.
+    Denoise *int `json:"denoise,omitempty"`
+    // TTA enables test-time augmentation: 8 runs per image, slower but cleaner.
+    TTA     bool `json:"tta,omitempty"`
+    // SyncGap is the Real-CUGAN sync gap mode (0 to 3); lower modes are faster.
+    SyncGap *int `json:"syncgap,omitempty"`
+}
+
+// ModelOptions lists the engine-specific options a model accepts.
+type ModelOptions struct {
+    DenoiseLevels  []int `json:"denoise_levels,omitempty"`
+    DefaultDenoise *int  `json:"default_denoise,omitempty"`
+    TTA            bool  `json:"tta,omitempty"`
+    SyncGapModes   []int `json:"syncgap_modes,omitempty"`
+}
+
+// isZero reports whether no option is set.
+func (o EngineOptions) isZero() bool {
+    return o.Denoise == nil && !o.TTA && o.SyncGap == nil
+}
+
+// RegisterEngine adds an engine to the service. Engines are consulted in
+// registration order when resolving a model, so earlier engines win on name clashes.
+// It must be called before StartWorkers.
+func (s *Service) RegisterEngine(engine Engine) {
+    s.enginesMu.Lock()
+    defer s.enginesMu.Unlock()
+
+    s.engines = append(s.engines, engine)
+    // Rebuilt with the new engine on the next lookup
+    s.models.Store(nil)
+}
+
+// Engines returns the registered engines in resolution order.
+func (s *Service) Engines() []Engine {
+    s.enginesMu.RLock()
+    defer s.enginesMu.RUnlock()
+
+    return append([]Engine(nil), s.engines...)
+}
+
+// engineFor resolves the engine responsible for the given model.
+func (s *Service) engineFor(model string) (Engine, error) {
+    engine, _, err := s.lookupModel(model)
+    return engine, err
+}
+
+// lookupModel finds the engine serving a model and the model's description
+// in the catalogue.
+func (s *Service) lookupModel(model string) (Engine, ModelInfo, error) {
+    if m, ok := s.catalogue().lookup(model); ok {
+        return m.engine, m.info, nil
+    }
+    return nil, ModelInfo{}, fmt.Errorf("%w: %s", ErrModelNotFound, model)
+}
+
+// modelInfo returns the description of a model with its manifest applied
+// and its files verified when the catalogue was built.
+func (s *Service) modelInfo(model string) (ModelInfo, error) {
+    _, info, err := s.lookupModel(model)
+    return info, err
+}
+
+// describe applies the manifest of a model listed by engine and verifies
+// its files.
+func (s *Service) describe(registry *modelRegistry, engine Engine, info *ModelInfo) {
+    manifest, ok := registry.manifest(info.Name, engine.Name())
+    if ok {
+        manifest.apply(info)
+    }
+    info.Problem = s.verifyFiles(info.files, manifest)
+    info.Available = info.Problem == ""
+    info.ChecksumVerified = info.Available && checksummed(info.files, manifest)
+}
+
+// validateOptions checks the engine options of a request against the models
+// it runs. Unknown models are reported when the job runs.
+func (s *Service) validateOptions(req Request) error {
+    if req.Options.isZero() {
+        return nil
+    }
+
+    for _, model := range requestModels(req) {
+        info, err := s.modelInfo(model)
+        if err != nil {
+            continue
+        }
+        if err := checkOptions(req.Options, info); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// checkOptions returns an error if the model does not accept an option.
+func checkOptions(opts EngineOptions, info ModelInfo) error {
+    var supported ModelOptions
+    if info.Options != nil {
+        supported = *info.Options
+    }
+
+    if opts.Denoise != nil && !slices.Contains(supported.DenoiseLevels, *opts.Denoise) {
+        if len(supported.DenoiseLevels) == 0 {
+            return fmt.Errorf("model %s does not support denoise", info.Name)
+        }
+        return fmt.Errorf("invalid denoise level %d for model %s (supported: %v)", *opts.Denoise, info.Name, supported.DenoiseLevels)
+    }
+    if opts.TTA && !supported.TTA {
+        return fmt.Errorf("model %s does not support tta", info.Name)
+    }
+    if opts.SyncGap != nil && !slices.Contains(supported.SyncGapModes, *opts.SyncGap) {
+        if len(supported.SyncGapModes) == 0 {
+            return fmt.Errorf("model %s does not support syncgap", info.Name)
+        }
+        return fmt.Errorf("invalid syncgap mode %d for model %s (supported: %v)", *opts.SyncGap, info.Name, supported.SyncGapModes)
+    }
+    return nil
+}
+
+// resolveEngine returns a runnable engine for the model. The model files are
+// verified again as they may have changed since the catalogue was built;
+// models removed since their jobs were queued run from their snapshot. If the engine serving the
+// model or the model files are unavailable and ResampleFallback is enabled, the built-in resample engine
+// is returned together with the fallback model instead.
+func (s *Service) resolveEngine(model string) (Engine, string, error) {
+    c := s.catalogue()
+    m, ok := c.lookup(model)
+    engine, info := m.engine, m.info
+    err := fmt.Errorf("%w: %s", ErrModelNotFound, model)
+    if ok {
+        err = engine.Available()
+        if err == nil && m.retired {
+            engine, err = s.snapshotEngineFor(m)
+        } else if err == nil {
+            s.describe(c.registry, engine, &info)
+            if !info.Available {
+                err = fmt.Errorf("%w: %s: %s", ErrModelUnavailable, model, info.Problem)
+            }
+        }
+        if err == nil {
+            return engine, model, nil
+        }
+    }
+
+    if !s.config.ResampleFallback {
+        return nil, "", err
+    }
+
+    fallback, fbErr := s.engineFor(DefaultResampleModel)
+    if fbErr != nil {
+        return nil, "", err
+    }
+
+    log.Printf("Falling back to %s for model %s: %v", DefaultResampleModel, model, err)
+    return fallback, DefaultResampleModel, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"errors"
+	"image"
+	"strings"
+)
+
+// ErrorCode is a stable, machine-readable classification of a job failure.
+type ErrorCode string
+
+// Error codes reported for failed, timed out and cancelled jobs.
+const (
+    ErrCodeOutOfMemory       ErrorCode = "out_of_memory"
+    ErrCodeUnsupportedImage  ErrorCode = "unsupported_image"
+    ErrCodeModelMissing      ErrorCode = "model_missing"
+    ErrCodeVulkanUnavailable ErrorCode = "vulkan_unavailable"
+    ErrCodeDeviceLost        ErrorCode = "device_lost"
+    ErrCodeInvalidRequest    ErrorCode = "invalid_request"
+    ErrCodeTimeout           ErrorCode = "timeout"
+    ErrCodeCancelled         ErrorCode = "cancelled"
+    ErrCodeEngineFailed      ErrorCode = "engine_failed"
+    ErrCodeInternal          ErrorCode = "internal"
+)
+
+var (
+    // ErrInvalidRequest wraps errors caused by invalid request parameters.
+    ErrInvalidRequest = errors.New("validation failed")
+    // ErrModelNotFound is returned when no engine serves the requested model.
+    ErrModelNotFound = errors.New("model not found")
+    // ErrModelUnavailable is returned when the files of a model are missing,
+    // truncated or do not match its manifest.
+    ErrModelUnavailable = errors.New("model unavailable")
+)
+
+// errorMessages are the human readable descriptions of the error codes.
+var errorMessages = map[ErrorCode]string{
+    ErrCodeOutOfMemory:       "The device ran out of memory. Retry with a smaller tile_size.",
+    ErrCodeUnsupportedImage:  "The image could not be decoded. Use a valid PNG, JPEG or WebP file.",
+    ErrCodeModelMissing:      "The model files are missing or incomplete.",
+    ErrCodeVulkanUnavailable: "No usable Vulkan device was found.",
+    ErrCodeDeviceLost:        "The GPU device was lost while processing.",
+    ErrCodeInvalidRequest:    "The request parameters are invalid.",
+    ErrCodeTimeout:           "The job exceeded its timeout.",
+    ErrCodeCancelled:         "The job was cancelled.",
+    ErrCodeEngineFailed:      "The upscaling engine failed.",
+    ErrCodeInternal:          "An internal error occurred.",
+}
+
+// outputPatterns map fragments of lower-cased engine output to error codes.
+// Vulkan initialisation failures are detected by isGPUInitFailure.
+var outputPatterns = []struct {
+    fragment string
+    code     ErrorCode
+}{
+    {"out_of_device_memory", ErrCodeOutOfMemory},
+    {"out_of_host_memory", ErrCodeOutOfMemory},
+    {"vkallocatememory failed", ErrCodeOutOfMemory},
+    {"out of memory", ErrCodeOutOfMemory},
+    {"device_lost", ErrCodeDeviceLost},
+    {"decode image", ErrCodeUnsupportedImage},
+    {"fopen", ErrCodeModelMissing},
+    {"network graph not ready", ErrCodeModelMissing},
+    {"load_param", ErrCodeModelMissing},
+    {"load_model", ErrCodeModelMissing},
+}
+
+// Message returns the human readable description of the code.
+func (c ErrorCode) Message() string {
+    if msg, ok := errorMessages[c]; ok {
+        return msg
+    }
+    return errorMessages[ErrCodeInternal]
+}
+
+// classifyError maps a job error to an error code.
+func classifyError(err error) ErrorCode {
+    var runErr *RunError
+    switch {
+    case err == nil:
+        return ""
+    case errors.Is(err, ErrModelNotFound), errors.Is(err, ErrModelUnavailable):
+        return ErrCodeModelMissing
+    case errors.Is(err, image.ErrFormat):
+        return ErrCodeUnsupportedImage
+    case errors.Is(err, ErrInvalidRequest):
+        return ErrCodeInvalidRequest
+    case errors.As(err, &runErr):
+        if isGPUInitFailure(err) {
+            return ErrCodeVulkanUnavailable
+        }
+        for _, line := range runErr.Output {
+            line = strings.ToLower(line)
+            for _, p := range outputPatterns {
+                if strings.Contains(line, p.fragment) {
+                    return p.code
+                }
+            }
+        }
+        return ErrCodeEngineFailed
+    default:
+        return ErrCodeInternal
+    }
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"testing"
+)
+
+// runErr returns a failed engine run with the given stderr output.
+func runErr(output ...string) error {
+    return &RunError{Err: errors.New("upscale failed: exit status 255"), Output: output}
+}
+
+func TestClassifyError(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want ErrorCode
+    }{
+        {"nil", nil, ""},
+        {"model not found", fmt.Errorf("%w: custom", ErrModelNotFound), ErrCodeModelMissing},
+        {"model unavailable", fmt.Errorf("%w: custom: missing file custom.bin", ErrModelUnavailable), ErrCodeModelMissing},
+        {"unknown image format", fmt.Errorf("failed to decode image: %w", image.ErrFormat), ErrCodeUnsupportedImage},
+        {"invalid request", fmt.Errorf("%w: invalid scale", ErrInvalidRequest), ErrCodeInvalidRequest},
+        {"internal", errors.New("failed to create output directory"), ErrCodeInternal},
+
+        // stderr of realesrgan-ncnn-vulkan, realcugan-ncnn-vulkan and waifu2x-ncnn-vulkan
+        {"vkAllocateMemory", runErr(
+            "[0 NVIDIA GeForce GTX 1050]  queueC=2[8]  queueG=0[16]  queueT=1[2]",
+            "[0 NVIDIA GeForce GTX 1050]  bugsbn1=0  bugbilz=0  bugcopc=0  bugihfa=0",
+            "vkAllocateMemory failed -2",
+        ), ErrCodeOutOfMemory},
+        {"out of device memory", runErr("VK_ERROR_OUT_OF_DEVICE_MEMORY"), ErrCodeOutOfMemory},
+        {"out of host memory", runErr("vkQueueSubmit failed VK_ERROR_OUT_OF_HOST_MEMORY"), ErrCodeOutOfMemory},
+        {"device lost", runErr("0.00%", "vkQueueSubmit failed VK_ERROR_DEVICE_LOST"), ErrCodeDeviceLost},
+        {"no vulkan instance", runErr("vkCreateInstance failed -9"), ErrCodeVulkanUnavailable},
+        {"invalid gpu device", runErr("invalid gpu device"), ErrCodeVulkanUnavailable},
+        {"no vulkan device", runErr("[vkEnumeratePhysicalDevices failed -3]"), ErrCodeVulkanUnavailable},
+        {"missing param", runErr("fopen realesrgan-x4plus.param failed"), ErrCodeModelMissing},
+        {"missing bin", runErr("fopen models/up2x-conservative.bin failed", "network graph not ready"), ErrCodeModelMissing},
+        {"bad param", runErr("param is too old, please regenerate", "load_param failed"), ErrCodeModelMissing},
+        {"undecodable input", runErr("decode image in.png failed"), ErrCodeUnsupportedImage},
+        {"unknown output", runErr("Segmentation fault (core dumped)"), ErrCodeEngineFailed},
+        {"no output", runErr(), ErrCodeEngineFailed},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := classifyError(tt.err); got != tt.want {
+                t.Errorf("classifyError(%v) = %q, want %q", tt.err, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestIsTransient(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want bool
+    }{
+        {"engine failure", runErr("Segmentation fault"), true},
+        {"device lost", runErr("VK_ERROR_DEVICE_LOST"), true},
+        {"out of memory", runErr("vkAllocateMemory failed -2"), false},
+        {"missing model", runErr("fopen x.param failed"), false},
+        {"invalid request", ErrInvalidRequest, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isTransient(tt.err); got != tt.want {
+                t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRunErrorMessage(t *testing.T) {
+    var tail outputTail
+    for i := 0; i < outputTailLines+5; i++ {
+        tail.add(fmt.Sprintf("line %d", i))
+    }
+    if len(tail.lines) != outputTailLines || tail.lines[0] != "line 5" {
+        t.Fatalf("tail = %v, want the last %d lines", tail.lines, outputTailLines)
+    }
+
+    err := &RunError{Err: errors.New("upscale failed"), Output: tail.lines}
+    if got, want := err.Error(), fmt.Sprintf("upscale failed: line %d", outputTailLines+4); got != want {
+        t.Errorf("Error() = %q, want %q", got, want)
+    }
+}
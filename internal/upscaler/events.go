@@ -0,0 +1,216 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventType identifies a job lifecycle event or a model catalogue change.
+type EventType string
+
+// Job lifecycle events.
+const (
+    EventQueued    EventType = "queued"
+    EventStarted   EventType = "started"
+    EventProgress  EventType = "progress"
+    EventStage     EventType = "stage"
+    EventCompleted EventType = "completed"
+    EventFailed    EventType = "failed"
+    EventTimedOut  EventType = "timed_out"
+    EventCancelled EventType = "cancelled"
+    // EventExpired is published when a finished job is removed from the history.
+    EventExpired   EventType = "expired"
+    // EventModelsChanged is published when a reload changes the model
+    // catalogue; it belongs to no job.
+    EventModelsChanged EventType = "models_changed"
+)
+
+// statusEvents maps job statuses to the event published on the transition.
+var statusEvents = map[string]EventType{
+    "queued":     EventQueued,
+    "processing": EventStarted,
+    "completed":  EventCompleted,
+    "failed":     EventFailed,
+    "timed_out":  EventTimedOut,
+    "cancelled":  EventCancelled,
+}
+
+// Event describes a change of a job, or of the model catalogue.
+type Event struct {
+    Type      EventType `json:"type"`
+    JobID     string    `json:"job_id"`
+    Status    string    `json:"status"`
+    Progress  int       `json:"progress"`
+    Stage     string    `json:"stage,omitempty"`
+    Device    string    `json:"device,omitempty"`
+    ErrorCode ErrorCode `json:"error_code,omitempty"`
+    Error     string    `json:"error,omitempty"`
+    // Models lists the changed models of an EventModelsChanged.
+    Models    *ModelsChange `json:"models,omitempty"`
+    Time      time.Time `json:"time"`
+}
+
+// Final reports whether no further events follow for the job.
+func (e Event) Final() bool {
+    switch e.Type {
+    case EventCompleted, EventFailed, EventTimedOut, EventCancelled, EventExpired:
+        return true
+    default:
+        return false
+    }
+}
+
+// EventBus distributes job events to subscribers. Publishing never blocks:
+// each subscriber has a queue that a goroutine hands to its channel. When a
+// queue is full the oldest progress event is dropped to make room; the other
+// events, in particular the final ones, are always delivered.
+type EventBus struct {
+    mu   sync.RWMutex
+    subs map[*subscriber]struct{}
+}
+
+// subscriber is a registered subscriber and its queue of undelivered events.
+type subscriber struct {
+    // jobID restricts the subscriber to the events of one job, if set.
+    jobID string
+    limit int
+    ch    chan Event
+    // wake signals queued events; done is closed on unsubscribe.
+    wake  chan struct{}
+    done  chan struct{}
+
+    mu    sync.Mutex
+    queue []Event
+}
+
+// NewEventBus creates an event bus without subscribers.
+func NewEventBus() *EventBus {
+    return &EventBus{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe registers a subscriber for the events of the job jobID, or of all
+// jobs and the model catalogue if jobID is empty. buffer is the number of
+// events queued before progress events are dropped. The returned function
+// unsubscribes and closes the channel.
+func (b *EventBus) Subscribe(jobID string, buffer int) (<-chan Event, func()) {
+    sub := &subscriber{
+        jobID: jobID,
+        limit: max(buffer, 1),
+        ch:    make(chan Event),
+        wake:  make(chan struct{}, 1),
+        done:  make(chan struct{}),
+    }
+    go sub.run()
+
+    b.mu.Lock()
+    b.subs[sub] = struct{}{}
+    b.mu.Unlock()
+
+    var once sync.Once
+    return sub.ch, func() {
+        once.Do(func() {
+            b.mu.Lock()
+            delete(b.subs, sub)
+            b.mu.Unlock()
+            close(sub.done)
+        })
+    }
+}
+
+// Publish sends an event to all subscribers interested in it.
+func (b *EventBus) Publish(e Event) {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+
+    for sub := range b.subs {
+        if sub.jobID == "" || sub.jobID == e.JobID {
+            sub.push(e)
+        }
+    }
+}
+
+// push queues an event. A full queue drops its oldest progress event, or the
+// new event if it is a progress event and there is none; other events are
+// queued beyond the limit.
+func (sub *subscriber) push(e Event) {
+    sub.mu.Lock()
+    if len(sub.queue) >= sub.limit {
+        i := slices.IndexFunc(sub.queue, func(q Event) bool { return q.Type == EventProgress })
+        switch {
+        case i >= 0:
+            sub.queue = slices.Delete(sub.queue, i, i+1)
+        case e.Type == EventProgress:
+            sub.mu.Unlock()
+            return
+        }
+    }
+    sub.queue = append(sub.queue, e)
+    sub.mu.Unlock()
+
+    select {
+    case sub.wake <- struct{}{}:
+    default:
+    }
+}
+
+// run hands the queued events to the channel in order until the subscriber
+// unsubscribes, then closes the channel.
+func (sub *subscriber) run() {
+    defer close(sub.ch)
+
+    for {
+        sub.mu.Lock()
+        if len(sub.queue) == 0 {
+            sub.mu.Unlock()
+            select {
+            case <-sub.wake:
+                continue
+            case <-sub.done:
+                return
+            }
+        }
+        e := sub.queue[0]
+        sub.queue = slices.Delete(sub.queue, 0, 1)
+        sub.mu.Unlock()
+
+        select {
+        case sub.ch <- e:
+        case <-sub.done:
+            return
+        }
+    }
+}
+
+// Subscribe registers a subscriber for the events of all jobs and the model
+// catalogue. See EventBus.Subscribe.
+func (s *Service) Subscribe(buffer int) (<-chan Event, func()) {
+    return s.events.Subscribe("", buffer)
+}
+
+// SubscribeJob registers a subscriber for the events of one job. See
+// EventBus.Subscribe.
+func (s *Service) SubscribeJob(jobID string, buffer int) (<-chan Event, func()) {
+    return s.events.Subscribe(jobID, buffer)
+}
+
+// publish sends an event of the given type for a job. The caller must hold jobsMu.
+func (s *Service) publish(job *Job, t EventType) {
+    e := Event{
+        Type:      t,
+        JobID:     job.ID,
+        Status:    job.Status,
+        Progress:  job.Progress,
+        Stage:     job.Stage,
+        Device:    job.Device,
+        ErrorCode: job.ErrorCode,
+        Time:      time.Now(),
+    }
+    if job.Error != nil {
+        e.Error = job.Error.Error()
+    }
+    s.events.Publish(e)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"testing"
+	"time"
+)
+
+// collect reads events until the channel blocks for a while or closes.
+func collect(events <-chan Event) []Event {
+    var got []Event
+    for {
+        select {
+        case e, ok := <-events:
+            if !ok {
+                return got
+            }
+            got = append(got, e)
+        case <-time.After(100 * time.Millisecond):
+            return got
+        }
+    }
+}
+
+func TestEventBusKeepsFinalEvents(t *testing.T) {
+    tests := []struct {
+        name     string
+        progress int
+        final    EventType
+    }{
+        {"buffer not full", 2, EventCompleted},
+        {"buffer full of progress", 50, EventFailed},
+        {"buffer overflowing", 500, EventTimedOut},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bus := NewEventBus()
+            events, unsubscribe := bus.Subscribe("a", 4)
+            defer unsubscribe()
+
+            // Nobody reads while the job publishes
+            bus.Publish(Event{Type: EventStarted, JobID: "a"})
+            for i := 1; i <= tt.progress; i++ {
+                bus.Publish(Event{Type: EventProgress, JobID: "a", Progress: i})
+                bus.Publish(Event{Type: EventProgress, JobID: "b", Progress: i})
+            }
+            bus.Publish(Event{Type: EventStage, JobID: "a", Stage: "encode"})
+            bus.Publish(Event{Type: tt.final, JobID: "a"})
+
+            got := collect(events)
+            if len(got) == 0 || got[0].Type != EventStarted {
+                t.Fatalf("events = %+v, want %s first", got, EventStarted)
+            }
+            last := got[len(got)-1]
+            if last.Type != tt.final {
+                t.Fatalf("last event = %+v, want %s", last, tt.final)
+            }
+            if got[len(got)-2].Type != EventStage {
+                t.Errorf("stage event lost: %+v", got)
+            }
+
+            progress := 0
+            for _, e := range got {
+                if e.JobID != "a" {
+                    t.Fatalf("received event of job %s", e.JobID)
+                }
+                if e.Type == EventProgress {
+                    if e.Progress <= progress {
+                        t.Errorf("progress %d after %d", e.Progress, progress)
+                    }
+                    progress = e.Progress
+                }
+            }
+            if progress != tt.progress {
+                t.Errorf("last progress = %d, want %d", progress, tt.progress)
+            }
+        })
+    }
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+    bus := NewEventBus()
+    all, unsubscribeAll := bus.Subscribe("", 4)
+    job, unsubscribeJob := bus.Subscribe("a", 4)
+
+    bus.Publish(Event{Type: EventModelsChanged})
+    if got := collect(all); len(got) != 1 || got[0].Type != EventModelsChanged {
+        t.Errorf("all events = %+v, want %s", got, EventModelsChanged)
+    }
+    if got := collect(job); len(got) != 0 {
+        t.Errorf("job events = %+v, want none", got)
+    }
+
+    unsubscribeJob()
+    unsubscribeJob()
+    if _, ok := <-job; ok {
+        t.Error("channel open after unsubscribe")
+    }
+    unsubscribeAll()
+    bus.Publish(Event{Type: EventQueued, JobID: "a"})
+    if _, ok := <-all; ok {
+        t.Error("channel open after unsubscribe")
+    }
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// exifOrientationTag is the TIFF tag holding the orientation of an image.
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns the EXIF orientation (1 to 8) of a JPEG file. Files
+// that are not JPEGs or have no orientation return 1 (upright).
+func jpegOrientation(path string) int {
+    f, err := os.Open(path)
+    if err != nil {
+        return 1
+    }
+    defer f.Close()
+
+    r := bufio.NewReader(f)
+    var soi [2]byte
+    if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+        return 1
+    }
+
+    // The metadata segments precede the image data
+    for {
+        var hdr [4]byte
+        if _, err := io.ReadFull(r, hdr[:]); err != nil || hdr[0] != 0xFF {
+            return 1
+        }
+        marker := hdr[1]
+        if marker == 0xDA || marker == 0xD9 {
+            return 1
+        }
+
+        length := int(binary.BigEndian.Uint16(hdr[2:])) - 2
+        if length < 0 {
+            return 1
+        }
+        if marker != 0xE1 {
+            if _, err := r.Discard(length); err != nil {
+                return 1
+            }
+            continue
+        }
+
+        seg := make([]byte, length)
+        if _, err := io.ReadFull(r, seg); err != nil {
+            return 1
+        }
+        if o, ok := exifOrientation(seg); ok {
+            return o
+        }
+    }
+}
+
+// exifOrientation reads the orientation from the first image directory of an
+// APP1 Exif segment.
+func exifOrientation(seg []byte) (int, bool) {
+    if len(seg) < 14 || string(seg[:6]) != "Exif\x00\x00" {
+        return 0, false
+    }
+    tiff := seg[6:]
+
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 0, false
+    }
+
+    ifd := int(order.Uint32(tiff[4:8]))
+    if ifd < 8 || ifd+2 > len(tiff) {
+        return 0, false
+    }
+
+    entries := int(order.Uint16(tiff[ifd:]))
+    for i := 0; i < entries; i++ {
+        e := ifd + 2 + i*12
+        if e+12 > len(tiff) {
+            break
+        }
+        if order.Uint16(tiff[e:]) != exifOrientationTag {
+            continue
+        }
+        o := int(order.Uint16(tiff[e+8:]))
+        return o, o >= 1 && o <= 8
+    }
+    return 0, false
+}
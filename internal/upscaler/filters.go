@@ -0,0 +1,251 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"runtime"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// filterRowsPerChunk is the number of rows a filter goroutine processes
+// before it checks for cancellation.
+const filterRowsPerChunk = 64
+
+// toNRGBA returns img as an NRGBA image with its origin at 0,0, converting it
+// if needed.
+func toNRGBA(img image.Image) *image.NRGBA {
+    if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+        return n
+    }
+
+    b := img.Bounds()
+    dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+    draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+    return dst
+}
+
+// parallelRows calls fn for chunks of the rows 0 to height on all CPUs. It
+// stops early and returns the context's error if ctx is cancelled.
+func parallelRows(ctx context.Context, height int, fn func(y0, y1 int)) error {
+    chunks := make(chan int)
+    var wg sync.WaitGroup
+    for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for y0 := range chunks {
+                fn(y0, min(y0+filterRowsPerChunk, height))
+            }
+        }()
+    }
+
+    var err error
+    for y0 := 0; y0 < height; y0 += filterRowsPerChunk {
+        if err = ctx.Err(); err != nil {
+            break
+        }
+        chunks <- y0
+    }
+    close(chunks)
+    wg.Wait()
+
+    return err
+}
+
+// cropImage returns the part of img inside r.
+func cropImage(img *image.NRGBA, r image.Rectangle) (*image.NRGBA, error) {
+    if !r.In(img.Rect) {
+        return nil, fmt.Errorf("crop rectangle %v exceeds the %dx%d image", r, img.Rect.Dx(), img.Rect.Dy())
+    }
+    return toNRGBA(img.SubImage(r)), nil
+}
+
+// orientationTransform returns the clockwise rotation and horizontal flip
+// that display an image with the given EXIF orientation upright.
+func orientationTransform(orientation int) (int, bool) {
+    switch orientation {
+    case 2:
+        return 0, true
+    case 3:
+        return 180, false
+    case 4:
+        return 180, true
+    case 5:
+        return 90, true
+    case 6:
+        return 90, false
+    case 7:
+        return 270, true
+    case 8:
+        return 270, false
+    default:
+        return 0, false
+    }
+}
+
+// orientImage rotates img clockwise by angle (0, 90, 180 or 270) and then
+// flips it.
+func orientImage(img *image.NRGBA, angle int, flipH, flipV bool) *image.NRGBA {
+    if angle == 0 && !flipH && !flipV {
+        return img
+    }
+
+    w, h := img.Rect.Dx(), img.Rect.Dy()
+    dw, dh := w, h
+    if angle == 90 || angle == 270 {
+        dw, dh = h, w
+    }
+    dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            var dx, dy int
+            switch angle {
+            case 90:
+                dx, dy = h-1-y, x
+            case 180:
+                dx, dy = w-1-x, h-1-y
+            case 270:
+                dx, dy = y, w-1-x
+            default:
+                dx, dy = x, y
+            }
+            if flipH {
+                dx = dw - 1 - dx
+            }
+            if flipV {
+                dy = dh - 1 - dy
+            }
+            copy(dst.Pix[dst.PixOffset(dx, dy):][:4], img.Pix[img.PixOffset(x, y):][:4])
+        }
+    }
+
+    return dst
+}
+
+// gaussianKernel returns the normalized weights of a Gaussian with the given
+// standard deviation.
+func gaussianKernel(sigma float64) []float64 {
+    r := int(math.Ceil(3 * sigma))
+    k := make([]float64, 2*r+1)
+    sum := 0.0
+    for i := range k {
+        x := float64(i - r)
+        k[i] = math.Exp(-x * x / (2 * sigma * sigma))
+        sum += k[i]
+    }
+    for i := range k {
+        k[i] /= sum
+    }
+    return k
+}
+
+// sharpenImage applies an unsharp mask to the color channels of img in place:
+// every pixel moves away from its Gaussian blur of the given radius by amount,
+// unless the difference is at most threshold. Zero radius and amount default to 1.
+func sharpenImage(ctx context.Context, img *image.NRGBA, radius, amount float64, threshold int) error {
+    if radius == 0 {
+        radius = 1
+    }
+    if amount == 0 {
+        amount = 1
+    }
+
+    k := gaussianKernel(radius)
+    r := len(k) / 2
+    w, h := img.Rect.Dx(), img.Rect.Dy()
+
+    // Horizontal pass into a temporary image
+    tmp := image.NewNRGBA(img.Rect)
+    err := parallelRows(ctx, h, func(y0, y1 int) {
+        for y := y0; y < y1; y++ {
+            row := img.Pix[y*img.Stride:]
+            out := tmp.Pix[y*tmp.Stride:]
+            for x := 0; x < w; x++ {
+                var sum [3]float64
+                for i, kv := range k {
+                    sx := min(max(x+i-r, 0), w-1) * 4
+                    sum[0] += kv * float64(row[sx])
+                    sum[1] += kv * float64(row[sx+1])
+                    sum[2] += kv * float64(row[sx+2])
+                }
+                for c := 0; c < 3; c++ {
+                    out[x*4+c] = clampByte(sum[c])
+                }
+            }
+        }
+    })
+    if err != nil {
+        return err
+    }
+
+    // The vertical pass only reads tmp, so img can be updated in place
+    return parallelRows(ctx, h, func(y0, y1 int) {
+        for y := y0; y < y1; y++ {
+            row := img.Pix[y*img.Stride:]
+            for x := 0; x < w; x++ {
+                var sum [3]float64
+                for i, kv := range k {
+                    sy := min(max(y+i-r, 0), h-1)
+                    p := sy*tmp.Stride + x*4
+                    sum[0] += kv * float64(tmp.Pix[p])
+                    sum[1] += kv * float64(tmp.Pix[p+1])
+                    sum[2] += kv * float64(tmp.Pix[p+2])
+                }
+                for c := 0; c < 3; c++ {
+                    v := float64(row[x*4+c])
+                    diff := v - sum[c]
+                    if math.Abs(diff) > float64(threshold) {
+                        row[x*4+c] = clampByte(v + amount*diff)
+                    }
+                }
+            }
+        }
+    })
+}
+
+// adjustColor changes brightness, contrast and saturation (-1 to 1, 0 keeps
+// the image) and gamma (0 or 1 keeps the image) of img in place.
+func adjustColor(ctx context.Context, img *image.NRGBA, brightness, contrast, saturation, gamma float64) error {
+    if gamma == 0 {
+        gamma = 1
+    }
+
+    var lut [256]uint8
+    for i := range lut {
+        v := float64(i) + brightness*255
+        v = (v-128)*(1+contrast) + 128
+        v = 255 * math.Pow(math.Max(v, 0)/255, 1/gamma)
+        lut[i] = clampByte(v)
+    }
+
+    w := img.Rect.Dx()
+    return parallelRows(ctx, img.Rect.Dy(), func(y0, y1 int) {
+        for y := y0; y < y1; y++ {
+            row := img.Pix[y*img.Stride:]
+            for x := 0; x < w; x++ {
+                p := row[x*4 : x*4+3]
+                r, g, b := float64(lut[p[0]]), float64(lut[p[1]]), float64(lut[p[2]])
+                if saturation != 0 {
+                    luma := 0.299*r + 0.587*g + 0.114*b
+                    r = luma + (r-luma)*(1+saturation)
+                    g = luma + (g-luma)*(1+saturation)
+                    b = luma + (b-luma)*(1+saturation)
+                }
+                p[0], p[1], p[2] = clampByte(r), clampByte(g), clampByte(b)
+            }
+        }
+    })
+}
+
+// clampByte rounds v to the nearest value from 0 to 255.
+func clampByte(v float64) uint8 {
+    return uint8(min(max(math.Round(v), 0), 255))
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+    // defaultHistoryMaxJobs is the default number of finished jobs kept.
+    defaultHistoryMaxJobs = 1000
+    // defaultHistoryMaxAge is the default time finished jobs are kept.
+    defaultHistoryMaxAge = 24 * time.Hour
+)
+
+// Finished reports whether the job reached a final status.
+func (j *Job) Finished() bool {
+    switch j.Status {
+    case "completed", "failed", "timed_out", "cancelled":
+        return true
+    default:
+        return false
+    }
+}
+
+// Tombstone returns what remains of a job that was evicted from the history.
+func (s *Service) Tombstone(jobID string) (Tombstone, bool) {
+    return s.store.Tombstone(jobID)
+}
+
+// BatchTombstones returns the tombstones of a batch whose jobs were evicted
+// from the history.
+func (s *Service) BatchTombstones(batchID string) []Tombstone {
+    return s.store.BatchTombstones(batchID)
+}
+
+// PruneHistory evicts finished jobs that are older than HistoryMaxAge or
+// exceed HistoryMaxJobs, newest kept first. The jobs of a batch are evicted
+// together once all of them have finished. Evicted jobs leave a tombstone and
+// publish an expired event. It returns the number of evicted jobs and is meant
+// to be called periodically.
+func (s *Service) PruneHistory() int {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    // Group the jobs into units that are evicted together
+    groups := make(map[string][]*Job)
+    for _, job := range s.store.List() {
+        key := job.ID
+        if job.Request.BatchID != "" {
+            key = job.Request.BatchID
+        }
+        groups[key] = append(groups[key], job)
+    }
+
+    type unit struct {
+        jobs     []*Job
+        finished time.Time
+    }
+    units := make([]unit, 0, len(groups))
+    for _, jobs := range groups {
+        u := unit{jobs: jobs}
+        done := true
+        for _, job := range jobs {
+            if !job.Finished() {
+                done = false
+                break
+            }
+            if t := finishedAt(job); t.After(u.finished) {
+                u.finished = t
+            }
+        }
+        if done {
+            units = append(units, u)
+        }
+    }
+    sort.Slice(units, func(i, j int) bool {
+        return units[i].finished.After(units[j].finished)
+    })
+
+    cutoff := time.Now().Add(-s.config.HistoryMaxAge)
+    kept, evicted := 0, 0
+    for _, u := range units {
+        if kept < s.config.HistoryMaxJobs && u.finished.After(cutoff) {
+            kept += len(u.jobs)
+            continue
+        }
+        for _, job := range u.jobs {
+            if err := s.store.Delete(job.ID); err != nil {
+                log.Printf("Failed to evict job %s: %v", job.ID, err)
+                continue
+            }
+            s.publish(job, EventExpired)
+            evicted++
+        }
+    }
+    return evicted
+}
+
+// finishedAt returns the time a finished job ended. Jobs stored before the
+// finish time was recorded fall back to their submission time.
+func finishedAt(job *Job) time.Time {
+    if job.FinishedAt.IsZero() {
+        return job.StartTime
+    }
+    return job.FinishedAt
+}
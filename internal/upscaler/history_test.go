@@ -0,0 +1,91 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPruneHistory(t *testing.T) {
+    now := time.Now()
+    ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+    jobs := []*Job{
+        {ID: "new", Status: "completed", FinishedAt: ago(time.Minute)},
+        {ID: "recent", Status: "failed", FinishedAt: ago(time.Hour)},
+        {ID: "old", Status: "completed", FinishedAt: ago(48 * time.Hour)},
+        {ID: "legacy", Status: "cancelled", StartTime: ago(72 * time.Hour)},
+        {ID: "running", Status: "processing", StartTime: ago(72 * time.Hour)},
+        {ID: "queued", Status: "queued", StartTime: ago(72 * time.Hour)},
+        // A batch is evicted once all of its items have finished
+        {ID: "done-1", Status: "completed", FinishedAt: ago(48 * time.Hour), Request: Request{BatchID: "done"}},
+        {ID: "done-2", Status: "failed", FinishedAt: ago(30 * time.Minute), Request: Request{BatchID: "done", BatchItem: 1}},
+        {ID: "busy-1", Status: "completed", FinishedAt: ago(48 * time.Hour), Request: Request{BatchID: "busy"}},
+        {ID: "busy-2", Status: "processing", Request: Request{BatchID: "busy", BatchItem: 1}},
+    }
+
+    tests := []struct {
+        name    string
+        maxJobs int
+        maxAge  time.Duration
+        evicted []string
+    }{
+        {"by age", 100, 24 * time.Hour, []string{"legacy", "old"}},
+        // The batch is the second newest unit and kept as a whole
+        {"by count", 3, 7 * 24 * time.Hour, []string{"legacy", "old", "recent"}},
+        {"batch by count", 1, 7 * 24 * time.Hour, []string{"done-1", "done-2", "legacy", "old", "recent"}},
+        {"batch by age", 100, 20 * time.Minute, []string{"done-1", "done-2", "legacy", "old", "recent"}},
+        {"nothing to evict", 100, 7 * 24 * time.Hour, nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := NewService(Config{WorkDir: t.TempDir(), HistoryMaxJobs: tt.maxJobs, HistoryMaxAge: tt.maxAge})
+            for _, job := range jobs {
+                copied := *job
+                if err := s.store.Put(&copied); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            events, unsubscribe := s.Subscribe(len(jobs))
+            defer unsubscribe()
+
+            if n := s.PruneHistory(); n != len(tt.evicted) {
+                t.Errorf("PruneHistory() = %d, want %d", n, len(tt.evicted))
+            }
+
+            var evicted []string
+            for _, job := range jobs {
+                _, found := s.store.Get(job.ID)
+                tomb, buried := s.Tombstone(job.ID)
+                if found == buried {
+                    t.Errorf("job %s: found = %v, tombstone = %v", job.ID, found, buried)
+                }
+                if buried {
+                    evicted = append(evicted, job.ID)
+                    if tomb.Status != job.Status || tomb.BatchID != job.Request.BatchID || tomb.ExpiredAt.IsZero() {
+                        t.Errorf("tombstone of %s = %+v", job.ID, tomb)
+                    }
+                }
+            }
+            slices.Sort(evicted)
+            if !slices.Equal(evicted, tt.evicted) {
+                t.Errorf("evicted %v, want %v", evicted, tt.evicted)
+            }
+
+            var expired []string
+            for _, e := range collect(events) {
+                if e.Type == EventExpired {
+                    expired = append(expired, e.JobID)
+                }
+            }
+            slices.Sort(expired)
+            if !slices.Equal(expired, tt.evicted) {
+                t.Errorf("expired events for %v, want %v", expired, tt.evicted)
+            }
+        })
+    }
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jpegQuality is the quality used when the service encodes JPEG output itself.
+const jpegQuality = 95
+
+// decodeImage reads and decodes an image file.
+func decodeImage(path string) (image.Image, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open image: %w", err)
+    }
+    defer file.Close()
+
+    img, _, err := image.Decode(file)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode image: %w", err)
+    }
+
+    return img, nil
+}
+
+// encodeImage writes img to path in the given format ("png" or "jpg"). JPEGs
+// are written with the given quality, or jpegQuality if it is 0.
+func encodeImage(path string, img image.Image, format string, quality int) error {
+    if quality == 0 {
+        quality = jpegQuality
+    }
+
+    out, err := os.Create(path)
+    if err != nil {
+        return fmt.Errorf("failed to create output: %w", err)
+    }
+
+    switch format {
+    case "png":
+        err = png.Encode(out, img)
+    case "jpg":
+        err = jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
+    default:
+        err = fmt.Errorf("unsupported output format: %s", format)
+    }
+
+    if closeErr := out.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        _ = os.Remove(path)
+        return fmt.Errorf("failed to encode image: %w", err)
+    }
+
+    return nil
+}
+
+// outputFormat returns the normalized output format for a task, falling back
+// to the extension of the output path and finally to png.
+func outputFormat(path, format string) string {
+    if format == "" {
+        format = strings.TrimPrefix(filepath.Ext(path), ".")
+    }
+
+    switch strings.ToLower(format) {
+    case "jpg", "jpeg":
+        return "jpg"
+    case "webp":
+        return "webp"
+    default:
+        return "png"
+    }
+}
+
+// canEncode reports whether the service can encode the format itself.
+func canEncode(format string) bool {
+    return format == "png" || format == "jpg"
+}
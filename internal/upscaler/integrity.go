@@ -0,0 +1,180 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minWeightsSize is the smallest plausible size of a .bin weights file;
+// smaller files are truncated downloads.
+const minWeightsSize = 1024
+
+// fileHashes caches the SHA-256 of model files. An entry is reused while the
+// size and modification time of the file are unchanged.
+type fileHashes struct {
+    mu      sync.Mutex
+    entries map[string]fileHash
+}
+
+// fileHash is a cached checksum.
+type fileHash struct {
+    size    int64
+    modTime time.Time
+    sum     string
+}
+
+// newFileHashes creates an empty checksum cache.
+func newFileHashes() *fileHashes {
+    return &fileHashes{entries: make(map[string]fileHash)}
+}
+
+// sum returns the hex encoded SHA-256 of the file at path, which fi describes.
+func (h *fileHashes) sum(path string, fi os.FileInfo) (string, error) {
+    h.mu.Lock()
+    e, ok := h.entries[path]
+    h.mu.Unlock()
+    if ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+        return e.sum, nil
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+
+    hash := sha256.New()
+    if _, err := io.Copy(hash, f); err != nil {
+        return "", err
+    }
+    sum := hex.EncodeToString(hash.Sum(nil))
+
+    h.mu.Lock()
+    h.entries[path] = fileHash{size: fi.Size(), modTime: fi.ModTime(), sum: sum}
+    h.mu.Unlock()
+    return sum, nil
+}
+
+// reset forgets all checksums.
+func (h *fileHashes) reset() {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.entries = make(map[string]fileHash)
+}
+
+// verifyFiles checks the files a model needs and those its manifest lists,
+// and returns why the model cannot be used, or "" if it can.
+func (s *Service) verifyFiles(files []string, manifest ModelManifest) string {
+    for _, path := range files {
+        fi, err := os.Stat(path)
+        if err != nil {
+            return fmt.Sprintf("missing file %s", filepath.Base(path))
+        }
+        if fi.Size() == 0 {
+            return fmt.Sprintf("empty file %s", filepath.Base(path))
+        }
+        if filepath.Ext(path) == ".bin" && fi.Size() < minWeightsSize {
+            return fmt.Sprintf("truncated file %s (%d bytes)", filepath.Base(path), fi.Size())
+        }
+    }
+
+    for _, f := range manifest.Files {
+        path := filepath.Join(manifest.dir, f.Name)
+        fi, err := os.Stat(path)
+        if err != nil {
+            return fmt.Sprintf("missing file %s", f.Name)
+        }
+        if f.Size > 0 && fi.Size() != f.Size {
+            return fmt.Sprintf("file %s has %d bytes, expected %d", f.Name, fi.Size(), f.Size)
+        }
+        if f.SHA256 == "" {
+            continue
+        }
+        sum, err := s.hashes.sum(path, fi)
+        if err != nil {
+            return fmt.Sprintf("cannot read %s: %v", f.Name, err)
+        }
+        if !strings.EqualFold(sum, f.SHA256) {
+            return fmt.Sprintf("checksum mismatch for %s", f.Name)
+        }
+    }
+
+    return ""
+}
+
+// checksummed reports whether the manifest lists the SHA-256 of every file a
+// model needs.
+func checksummed(files []string, manifest ModelManifest) bool {
+    if len(files) == 0 {
+        return false
+    }
+
+    sums := make(map[string]bool)
+    for _, f := range manifest.Files {
+        if f.SHA256 != "" {
+            sums[filepath.Join(manifest.dir, f.Name)] = true
+        }
+    }
+    for _, path := range files {
+        if !sums[filepath.Clean(path)] {
+            return false
+        }
+    }
+    return true
+}
+
+// VerifyModels checks the files of every model again, recomputing all
+// checksums, reloads the model catalogue and logs the models that cannot be
+// used.
+func (s *Service) VerifyModels() ([]ModelInfo, error) {
+    s.hashes.reset()
+    s.reloadModels()
+
+    models, err := s.GetAvailableModels()
+    if err != nil {
+        return nil, err
+    }
+    for _, m := range models {
+        if !m.Available {
+            log.Printf("Model %s is unavailable: %s", m.Name, m.Problem)
+        }
+    }
+    return models, nil
+}
+
+// pairFiles returns the .param and .bin files of the ncnn models in dir,
+// including the missing halves of incomplete pairs.
+func pairFiles(dir string) []string {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil
+    }
+
+    var files []string
+    seen := make(map[string]bool)
+    for _, entry := range entries {
+        ext := filepath.Ext(entry.Name())
+        if entry.IsDir() || (ext != ".param" && ext != ".bin") {
+            continue
+        }
+        base := strings.TrimSuffix(entry.Name(), ext)
+        if seen[base] {
+            continue
+        }
+        seen[base] = true
+        files = append(files, filepath.Join(dir, base+".param"), filepath.Join(dir, base+".bin"))
+    }
+    return files
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sha256Hex returns the hex encoded SHA-256 of data.
+func sha256Hex(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyFiles(t *testing.T) {
+    weights := make([]byte, 2*minWeightsSize)
+    weights[0] = 1
+    sum := sha256Hex(weights)
+
+    tests := []struct {
+        name  string
+        files map[string][]byte
+        need  []string
+        list  []ManifestFile
+        want  string
+    }{
+        {
+            name:  "complete",
+            files: map[string][]byte{"m.param": []byte("7767517"), "m.bin": weights},
+            need:  []string{"m.param", "m.bin"},
+            list:  []ManifestFile{{Name: "m.bin", Size: int64(len(weights)), SHA256: sum}},
+        },
+        {
+            name:  "checksum in upper case",
+            files: map[string][]byte{"m.bin": weights},
+            list:  []ManifestFile{{Name: "m.bin", SHA256: strings.ToUpper(sum)}},
+        },
+        {
+            name:  "missing file",
+            files: map[string][]byte{"m.param": []byte("7767517")},
+            need:  []string{"m.param", "m.bin"},
+            want:  "missing file m.bin",
+        },
+        {
+            name:  "empty file",
+            files: map[string][]byte{"m.param": nil, "m.bin": weights},
+            need:  []string{"m.param", "m.bin"},
+            want:  "empty file m.param",
+        },
+        {
+            name:  "truncated weights",
+            files: map[string][]byte{"m.param": []byte("7767517"), "m.bin": weights[:minWeightsSize-1]},
+            need:  []string{"m.param", "m.bin"},
+            want:  "truncated file m.bin (1023 bytes)",
+        },
+        {
+            name:  "missing manifest file",
+            files: map[string][]byte{},
+            list:  []ManifestFile{{Name: "m.bin"}},
+            want:  "missing file m.bin",
+        },
+        {
+            name:  "size mismatch",
+            files: map[string][]byte{"m.bin": weights[:minWeightsSize]},
+            list:  []ManifestFile{{Name: "m.bin", Size: int64(len(weights)), SHA256: sum}},
+            want:  "file m.bin has 1024 bytes, expected 2048",
+        },
+        {
+            name:  "checksum mismatch",
+            files: map[string][]byte{"m.bin": make([]byte, len(weights))},
+            list:  []ManifestFile{{Name: "m.bin", Size: int64(len(weights)), SHA256: sum}},
+            want:  "checksum mismatch for m.bin",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            for name, data := range tt.files {
+                if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            var need []string
+            for _, name := range tt.need {
+                need = append(need, filepath.Join(dir, name))
+            }
+
+            s := &Service{hashes: newFileHashes()}
+            got := s.verifyFiles(need, ModelManifest{Files: tt.list, dir: dir})
+            if got != tt.want {
+                t.Errorf("verifyFiles() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestVerifyFilesRehashesChangedFile(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "m.bin")
+    weights := make([]byte, 2*minWeightsSize)
+    if err := os.WriteFile(path, weights, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    s := &Service{hashes: newFileHashes()}
+    manifest := ModelManifest{Files: []ManifestFile{{Name: "m.bin", SHA256: sha256Hex(weights)}}, dir: dir}
+    if got := s.verifyFiles(nil, manifest); got != "" {
+        t.Fatalf("verifyFiles() = %q, want no problem", got)
+    }
+
+    // Same size, new content: the cached checksum must not be reused
+    weights[0] = 1
+    if err := os.WriteFile(path, weights, 0644); err != nil {
+        t.Fatal(err)
+    }
+    later := time.Now().Add(time.Minute)
+    if err := os.Chtimes(path, later, later); err != nil {
+        t.Fatal(err)
+    }
+    if got := s.verifyFiles(nil, manifest); got != "checksum mismatch for m.bin" {
+        t.Errorf("verifyFiles() = %q, want checksum mismatch", got)
+    }
+}
+
+func TestPairFiles(t *testing.T) {
+    dir := t.TempDir()
+    for _, name := range []string{"a.param", "a.bin", "b.bin", "notes.txt"} {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.Mkdir(filepath.Join(dir, "c.param"), 0755); err != nil {
+        t.Fatal(err)
+    }
+
+    got := pairFiles(dir)
+    want := []string{
+        filepath.Join(dir, "a.param"), filepath.Join(dir, "a.bin"),
+        filepath.Join(dir, "b.param"), filepath.Join(dir, "b.bin"),
+    }
+    if !slices.Equal(got, want) {
+        t.Errorf("pairFiles() = %v, want %v", got, want)
+    }
+}
+
+func TestChecksummed(t *testing.T) {
+    dir := t.TempDir()
+    files := []string{filepath.Join(dir, "m.param"), filepath.Join(dir, "m.bin")}
+    sha := strings.Repeat("ab", 32)
+
+    tests := []struct {
+        name  string
+        files []string
+        list  []ManifestFile
+        want  bool
+    }{
+        {"no manifest files", files, nil, false},
+        {"sizes only", files, []ManifestFile{{Name: "m.param", Size: 7}, {Name: "m.bin", Size: 2048}}, false},
+        {"one file missing", files, []ManifestFile{{Name: "m.bin", SHA256: sha}}, false},
+        {"all files", files, []ManifestFile{{Name: "m.param", SHA256: sha}, {Name: "m.bin", SHA256: sha}}, true},
+        {"model without files", nil, []ManifestFile{{Name: "m.bin", SHA256: sha}}, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := checksummed(tt.files, ModelManifest{Files: tt.list, dir: dir}); got != tt.want {
+                t.Errorf("checksummed() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
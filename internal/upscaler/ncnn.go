@@ -0,0 +1,150 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Engine types of EngineConfig.
+const (
+    EngineRealESRGAN = "realesrgan"
+    EngineRealCUGAN  = "realcugan"
+    EngineWaifu2x    = "waifu2x"
+)
+
+// EngineConfig configures an additional ncnn-vulkan binary.
+type EngineConfig struct {
+    // Type is the binary family: realesrgan, realcugan or waifu2x.
+    Type       string
+    // Name identifies the engine; it defaults to Type.
+    Name       string
+    BinaryPath string
+    ModelsPath string
+    // Threads is the load:proc:save thread count (default Config.Threads).
+    Threads    string
+}
+
+// NewEngine creates the engine for a configured ncnn-vulkan binary.
+func NewEngine(cfg EngineConfig) (Engine, error) {
+    if cfg.Name == "" {
+        cfg.Name = cfg.Type
+    }
+
+    switch cfg.Type {
+    case EngineRealESRGAN:
+        return &realesrganEngine{name: cfg.Name, config: RealESRGANConfig{
+            BinaryPath: cfg.BinaryPath,
+            ModelsPath: cfg.ModelsPath,
+            Threads:    cfg.Threads,
+        }}, nil
+    case EngineRealCUGAN:
+        return NewRealCUGANEngine(cfg), nil
+    case EngineWaifu2x:
+        return NewWaifu2xEngine(cfg), nil
+    default:
+        return nil, fmt.Errorf("unknown engine type: %q", cfg.Type)
+    }
+}
+
+// binaryAvailable checks that an engine binary exists.
+func binaryAvailable(path string) error {
+    if _, err := os.Stat(path); os.IsNotExist(err) {
+        return fmt.Errorf("upscaler binary not found: %s", path)
+    }
+    return nil
+}
+
+// deviceArgs returns the ncnn flags selecting the GPU or the CPU. All
+// ncnn-vulkan binaries share them.
+func deviceArgs(device Device) []string {
+    if device.Kind == DeviceCPU {
+        return []string{"-g", "-1"}
+    }
+    if device.GPUID >= 0 {
+        return []string{"-g", fmt.Sprintf("%d", device.GPUID)}
+    }
+    return nil
+}
+
+// runBinary runs an ncnn-vulkan binary and reports the progress parse finds
+// in its stderr output. The remaining output is attached to the error if the
+// binary fails.
+func runBinary(ctx context.Context, binary string, args []string, parse func(string) (int, bool), onProgress func(int)) error {
+    cmd := exec.CommandContext(ctx, binary, args...)
+    // Ask the binary to stop when the job is cancelled, kill it if it does not
+    cmd.Cancel = func() error {
+        return cmd.Process.Signal(os.Interrupt)
+    }
+    cmd.WaitDelay = stopGracePeriod
+
+    // Capture stderr for progress
+    stderr, err := cmd.StderrPipe()
+    if err != nil {
+        return fmt.Errorf("failed to get stderr pipe: %w", err)
+    }
+
+    if err := cmd.Start(); err != nil {
+        return fmt.Errorf("failed to start command: %w", err)
+    }
+
+    // Parse progress in a goroutine, keeping the other output for errors
+    var tail outputTail
+    var wg sync.WaitGroup
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+
+        scanner := bufio.NewScanner(stderr)
+        scanner.Split(bufio.ScanLines)
+
+        for scanner.Scan() {
+            line := scanner.Text()
+            if percent, ok := parse(line); ok {
+                if onProgress != nil {
+                    onProgress(percent)
+                }
+            } else if strings.TrimSpace(line) != "" {
+                tail.add(line)
+            }
+        }
+    }()
+
+    // Drain stderr before Wait closes the pipe
+    wg.Wait()
+
+    if err := cmd.Wait(); err != nil {
+        return &RunError{Err: fmt.Errorf("upscale failed: %w", err), Output: tail.lines}
+    }
+
+    return nil
+}
+
+// modelDirs returns the names of the model directories ("models-*") below
+// path without the prefix.
+func modelDirs(path string) ([]string, error) {
+    entries, err := os.ReadDir(path)
+    if err != nil {
+        return nil, err
+    }
+
+    dirs := make([]string, 0)
+    for _, entry := range entries {
+        if entry.IsDir() && strings.HasPrefix(entry.Name(), "models-") {
+            dirs = append(dirs, strings.TrimPrefix(entry.Name(), "models-"))
+        }
+    }
+    return dirs, nil
+}
+
+// intPtr returns a pointer to v.
+func intPtr(v int) *int {
+    return &v
+}
@@ -0,0 +1,519 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+    // maxPipelineStages limits the number of stages in a pipeline.
+    maxPipelineStages = 20
+    // upscaleStageWeight is the share of progress of an upscale stage relative
+    // to the other stages, which are much faster.
+    upscaleStageWeight = 10
+    // maxSharpenRadius, maxSharpenAmount and maxGamma bound the filter parameters.
+    maxSharpenRadius = 50.0
+    maxSharpenAmount = 10.0
+    maxGamma         = 10.0
+)
+
+// Pipeline stage types.
+const (
+    StageCrop    = "crop"
+    StageRotate  = "rotate"
+    StageResize  = "resize"
+    StageSharpen = "sharpen"
+    StageColor   = "color"
+    StageUpscale = "upscale"
+    StageEncode  = "encode"
+)
+
+// Flip directions of a rotate stage.
+const (
+    FlipHorizontal = "horizontal"
+    FlipVertical   = "vertical"
+)
+
+// PipelineStage is a single processing step of a pipeline. Which fields apply
+// depends on Type:
+//
+//   - crop: X, Y, Width and Height of the kept rectangle.
+//   - rotate: Angle clockwise in multiples of 90 and/or Flip; or Auto to apply
+//     the EXIF orientation of a JPEG input (first stage only).
+//   - resize, upscale: Scale, or Width and/or Height with Fit, as in Request.
+//     Upscale runs Model (default Request.ModelName) and without a size uses
+//     the model's largest native scale.
+//   - sharpen: unsharp mask with Radius (default 1), Amount (default 1) and
+//     Threshold.
+//   - color: Brightness, Contrast and Saturation from -1 to 1, and Gamma
+//     (default 1).
+//   - encode: Format (png or jpg) and Quality of the output; last stage only.
+type PipelineStage struct {
+    Type       string  `json:"type"`
+    X          int     `json:"x,omitempty"`
+    Y          int     `json:"y,omitempty"`
+    Width      int     `json:"width,omitempty"`
+    Height     int     `json:"height,omitempty"`
+    Scale      float64 `json:"scale,omitempty"`
+    Fit        string  `json:"fit,omitempty"`
+    Angle      int     `json:"angle,omitempty"`
+    Flip       string  `json:"flip,omitempty"`
+    Auto       bool    `json:"auto,omitempty"`
+    Model      string  `json:"model,omitempty"`
+    Radius     float64 `json:"radius,omitempty"`
+    Amount     float64 `json:"amount,omitempty"`
+    Threshold  int     `json:"threshold,omitempty"`
+    Brightness float64 `json:"brightness,omitempty"`
+    Contrast   float64 `json:"contrast,omitempty"`
+    Saturation float64 `json:"saturation,omitempty"`
+    Gamma      float64 `json:"gamma,omitempty"`
+    Format     string  `json:"format,omitempty"`
+    Quality    int     `json:"quality,omitempty"`
+}
+
+// StageProgress is the progress of a pipeline stage of a running job.
+type StageProgress struct {
+    Type     string `json:"type"`
+    Progress int    `json:"progress"`
+}
+
+// newStageProgress returns the initial progress of the stages of a pipeline.
+func newStageProgress(stages []PipelineStage) []StageProgress {
+    progress := make([]StageProgress, len(stages))
+    for i, st := range stages {
+        progress[i].Type = st.Type
+    }
+    return progress
+}
+
+// sizeRequest returns the size parameters of a resize or upscale stage as a
+// request, so they can be planned like one.
+func (st PipelineStage) sizeRequest() Request {
+    return Request{Scale: st.Scale, TargetWidth: st.Width, TargetHeight: st.Height, Fit: st.Fit}
+}
+
+// hasSize reports whether a resize or upscale stage has size parameters.
+func (st PipelineStage) hasSize() bool {
+    return st.Scale != 0 || st.Width != 0 || st.Height != 0
+}
+
+// angle returns the rotation of a rotate stage normalized to 0, 90, 180 or 270.
+func (st PipelineStage) angle() int {
+    return (st.Angle%360 + 360) % 360
+}
+
+// stageModel returns the model an upscale stage runs.
+func stageModel(req Request, st PipelineStage) string {
+    if st.Model != "" {
+        return st.Model
+    }
+    return req.ModelName
+}
+
+// outputOptions returns the output format of a request and the JPEG quality
+// (0 for the default).
+func outputOptions(req Request) (string, int) {
+    if n := len(req.Pipeline); n > 0 && req.Pipeline[n-1].Type == StageEncode {
+        return outputFormat("", req.Pipeline[n-1].Format), req.Pipeline[n-1].Quality
+    }
+    return outputFormat(req.OutputPath, req.Format), 0
+}
+
+// validatePipeline checks the stages of a request before the job is queued.
+// Checks that depend on the image size are repeated when the job runs.
+func (s *Service) validatePipeline(req Request) error {
+    n := len(req.Pipeline)
+    if n == 0 {
+        return nil
+    }
+    if n > maxPipelineStages {
+        return fmt.Errorf("pipeline has %d stages, the maximum is %d", n, maxPipelineStages)
+    }
+
+    for i, st := range req.Pipeline {
+        if err := validateStage(st, i, n); err != nil {
+            return fmt.Errorf("stage %d (%s): %w", i+1, st.Type, err)
+        }
+    }
+
+    if format, _ := outputOptions(req); !canEncode(format) && req.Pipeline[n-1].Type != StageUpscale {
+        return fmt.Errorf("%s output must be written by a final upscale stage, encode to png or jpg instead", format)
+    }
+    return nil
+}
+
+// validateStage checks the parameters of the stage at index i of n.
+func validateStage(st PipelineStage, i, n int) error {
+    switch st.Type {
+    case StageCrop:
+        if st.X < 0 || st.Y < 0 || st.Width <= 0 || st.Height <= 0 {
+            return fmt.Errorf("invalid crop rectangle %dx%d at %d,%d", st.Width, st.Height, st.X, st.Y)
+        }
+    case StageRotate:
+        if st.Angle%90 != 0 {
+            return fmt.Errorf("invalid angle %d (must be a multiple of 90)", st.Angle)
+        }
+        switch st.Flip {
+        case "", FlipHorizontal, FlipVertical:
+        default:
+            return fmt.Errorf("invalid flip: %s (must be %s or %s)", st.Flip, FlipHorizontal, FlipVertical)
+        }
+        if st.Auto && (i > 0 || st.angle() != 0 || st.Flip != "") {
+            return errors.New("auto rotation must be the first stage and cannot be combined with angle or flip")
+        }
+    case StageResize:
+        if !st.hasSize() {
+            return errors.New("resize needs a scale, width or height")
+        }
+        return validateScale(st.sizeRequest())
+    case StageUpscale:
+        if st.hasSize() {
+            return validateScale(st.sizeRequest())
+        }
+    case StageSharpen:
+        if st.Radius < 0 || st.Radius > maxSharpenRadius {
+            return fmt.Errorf("invalid radius: %g (must be 0 to %g)", st.Radius, maxSharpenRadius)
+        }
+        if st.Amount < 0 || st.Amount > maxSharpenAmount {
+            return fmt.Errorf("invalid amount: %g (must be 0 to %g)", st.Amount, maxSharpenAmount)
+        }
+        if st.Threshold < 0 || st.Threshold > 255 {
+            return fmt.Errorf("invalid threshold: %d (must be 0 to 255)", st.Threshold)
+        }
+    case StageColor:
+        for _, v := range []struct {
+            name  string
+            value float64
+        }{{"brightness", st.Brightness}, {"contrast", st.Contrast}, {"saturation", st.Saturation}} {
+            if v.value < -1 || v.value > 1 {
+                return fmt.Errorf("invalid %s: %g (must be -1 to 1)", v.name, v.value)
+            }
+        }
+        if st.Gamma < 0 || st.Gamma > maxGamma {
+            return fmt.Errorf("invalid gamma: %g (must be 0 to %g)", st.Gamma, maxGamma)
+        }
+    case StageEncode:
+        if i != n-1 {
+            return errors.New("encode must be the last stage")
+        }
+        switch strings.ToLower(st.Format) {
+        case "png", "jpg", "jpeg":
+        default:
+            return fmt.Errorf("invalid format: %q (must be png or jpg)", st.Format)
+        }
+        if st.Quality < 0 || st.Quality > 100 {
+            return fmt.Errorf("invalid quality: %d (must be 1 to 100)", st.Quality)
+        }
+    default:
+        return errors.New("unknown stage type")
+    }
+    return nil
+}
+
+// planJob plans a request for an input of the given size.
+func (s *Service) planJob(input ImageSize, req Request) (Plan, error) {
+    if len(req.Pipeline) > 0 {
+        return s.planPipeline(input, req, 1)
+    }
+
+    engine, model, err := s.resolveEngine(req.ModelName)
+    if err != nil {
+        return Plan{}, err
+    }
+    return planRequest(input, req, model, s.supportedScales(engine, model))
+}
+
+// planPipeline follows the image size through the stages of a pipeline for an
+// input with the given EXIF orientation. The plan holds the model passes of
+// all upscale stages and the final output size.
+func (s *Service) planPipeline(input ImageSize, req Request, orientation int) (Plan, error) {
+    var plan Plan
+
+    size := input
+    for i, st := range req.Pipeline {
+        switch st.Type {
+        case StageCrop:
+            if st.X+st.Width > size.Width || st.Y+st.Height > size.Height {
+                return Plan{}, fmt.Errorf("stage %d (crop): rectangle %dx%d at %d,%d exceeds the %dx%d image",
+                    i+1, st.Width, st.Height, st.X, st.Y, size.Width, size.Height)
+            }
+            size = ImageSize{Width: st.Width, Height: st.Height}
+        case StageRotate:
+            angle := st.angle()
+            if st.Auto {
+                angle, _ = orientationTransform(orientation)
+            }
+            if angle%180 != 0 {
+                size = ImageSize{Width: size.Height, Height: size.Width}
+            }
+        case StageResize:
+            size = targetSize(size, st.sizeRequest())
+        case StageUpscale:
+            engine, model, err := s.resolveEngine(stageModel(req, st))
+            if err != nil {
+                return Plan{}, fmt.Errorf("stage %d (upscale): %w", i+1, err)
+            }
+            scales := s.supportedScales(engine, model)
+            p, err := planRequest(size, upscaleRequest(st, scales), model, scales)
+            if err != nil {
+                return Plan{}, fmt.Errorf("stage %d (upscale): %w", i+1, err)
+            }
+            plan.Passes = append(plan.Passes, p.Passes...)
+            size = p.OutputSize
+        }
+
+        if size.Width > maxDimension || size.Height > maxDimension {
+            return Plan{}, fmt.Errorf("stage %d (%s): size %dx%d exceeds %d pixels",
+                i+1, st.Type, size.Width, size.Height, maxDimension)
+        }
+    }
+
+    plan.OutputSize = size
+    return plan, nil
+}
+
+// upscaleRequest returns the size parameters of an upscale stage, defaulting
+// to the largest of the model's native scales.
+func upscaleRequest(st PipelineStage, scales []int) Request {
+    req := st.sizeRequest()
+    if !st.hasSize() && len(scales) > 0 {
+        req.Scale = float64(slices.Max(scales))
+    }
+    return req
+}
+
+// runPipeline executes the stages of a pipeline request in order and writes
+// the result to req.OutputPath. Every stage but the last keeps its result in
+// the job directory (or a temporary directory), so completed stages are
+// skipped when a job is retried or resumed.
+func (s *Service) runPipeline(ctx context.Context, req Request, exec execution) (*Result, error) {
+    start := time.Now()
+
+    if err := s.validatePipeline(req); err != nil {
+        return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if _, err := os.Stat(req.InputPath); os.IsNotExist(err) {
+        return nil, fmt.Errorf("%w: input file not found: %s", ErrInvalidRequest, req.InputPath)
+    }
+
+    inputSize, err := s.getImageSize(req.InputPath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get input size: %w", err)
+    }
+
+    orientation := jpegOrientation(req.InputPath)
+    plan, err := s.planPipeline(inputSize, req, orientation)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    exec.plan(plan)
+
+    dir := exec.dir
+    if dir == "" {
+        tmp, err := s.tempDir("pipeline-")
+        if err != nil {
+            return nil, fmt.Errorf("failed to create pipeline dir: %w", err)
+        }
+        defer os.RemoveAll(tmp)
+        dir = tmp
+    }
+
+    weights := make([]float64, len(req.Pipeline))
+    total := 0.0
+    for i, st := range req.Pipeline {
+        weights[i] = 1
+        if st.Type == StageUpscale {
+            weights[i] = upscaleStageWeight
+        }
+        total += weights[i]
+    }
+
+    format, quality := outputOptions(req)
+    engineName := "pipeline"
+
+    current := req.InputPath
+    size := inputSize
+    done := 0.0
+    for i, st := range req.Pipeline {
+        last := i == len(req.Pipeline)-1
+
+        out := req.OutputPath
+        stageFormat := format
+        if !last {
+            out = filepath.Join(dir, fmt.Sprintf("stage%d.png", i+1))
+            stageFormat = "png"
+        }
+
+        offset, weight := done, weights[i]
+        onProgress := func(pct int) {
+            exec.step(i, pct)
+            exec.progress(int((offset + weight*float64(pct)/100) / total * 100))
+        }
+
+        // Completed intermediate stages survive a restart
+        if _, statErr := os.Stat(out); statErr != nil || last {
+            // Intermediate results are written to a temporary name first, so
+            // an existing file always represents a completed stage
+            target := out
+            if !last {
+                target = filepath.Join(dir, fmt.Sprintf("part_stage%d.png", i+1))
+            }
+
+            if st.Type == StageUpscale {
+                stageExec := exec
+                stageExec.onProgress = onProgress
+                stageExec.dir = ""
+                if exec.dir != "" {
+                    stageExec.dir = filepath.Join(exec.dir, fmt.Sprintf("stage%d", i+1))
+                }
+                var name string
+                name, err = s.runUpscaleStage(ctx, req, st, current, target, stageFormat, size, stageExec)
+                if err == nil {
+                    engineName = name
+                }
+            } else {
+                exec.stage(st.Type)
+                err = runImageStage(ctx, st, current, target, stageFormat, quality, orientation)
+            }
+            if err == nil && !last {
+                err = os.Rename(target, out)
+            }
+            if err != nil {
+                _ = os.Remove(target)
+                stageErr := &stageError{err: fmt.Errorf("stage %d/%d (%s) failed: %w", i+1, len(req.Pipeline), st.Type, err)}
+                if st.Type == StageUpscale {
+                    stageErr.model = stageModel(req, st)
+                }
+                return nil, stageErr
+            }
+        }
+
+        if size, err = s.getImageSize(out); err != nil {
+            return nil, fmt.Errorf("failed to get size of stage %d: %w", i+1, err)
+        }
+        done += weights[i]
+        onProgress(100)
+        current = out
+    }
+
+    stat, err := os.Stat(req.OutputPath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to stat output: %w", err)
+    }
+
+    return &Result{
+        OutputPath:    req.OutputPath,
+        Duration:      time.Since(start),
+        InputSize:     inputSize,
+        OutputSize:    size,
+        FileSizeBytes: stat.Size(),
+        Engine:        engineName,
+        Plan:          plan,
+    }, nil
+}
+
+// stageError is the error of a failed pipeline stage. model is set for
+// upscale stages, so that retries can adjust the tile size of that model.
+type stageError struct {
+    model string
+    err   error
+}
+
+// Error returns the error message.
+func (e *stageError) Error() string {
+    return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *stageError) Unwrap() error {
+    return e.err
+}
+
+// runUpscaleStage runs the model passes of an upscale stage and returns the
+// name of the engine that ran them.
+func (s *Service) runUpscaleStage(ctx context.Context, req Request, st PipelineStage, input, output, format string, size ImageSize, exec execution) (string, error) {
+    engine, model, err := s.resolveEngine(stageModel(req, st))
+    if err != nil {
+        return "", err
+    }
+
+    scales := s.supportedScales(engine, model)
+    plan, err := planRequest(size, upscaleRequest(st, scales), model, scales)
+    if err != nil {
+        return "", fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if plan.ResizeTo != nil && !canEncode(format) {
+        return "", fmt.Errorf("%w: %s output cannot be combined with resizing, use png or jpg", ErrInvalidRequest, format)
+    }
+
+    if exec.dir != "" {
+        if err := os.MkdirAll(exec.dir, 0755); err != nil {
+            return "", fmt.Errorf("failed to create stage dir: %w", err)
+        }
+    }
+
+    task := Task{
+        InputPath:  input,
+        OutputPath: output,
+        ModelName:  model,
+        TileSize:   exec.tileSize(req, stageModel(req, st)),
+        Format:     format,
+        Device:     exec.device,
+        Options:    req.Options,
+    }
+    if err := s.runPlan(ctx, engine, task, size, plan, exec); err != nil {
+        return "", err
+    }
+
+    if exec.dir != "" {
+        _ = os.RemoveAll(exec.dir)
+    }
+    return engine.Name(), nil
+}
+
+// runImageStage applies a stage other than upscale to the image at input and
+// writes the result to output.
+func runImageStage(ctx context.Context, st PipelineStage, input, output, format string, quality, orientation int) error {
+    src, err := decodeImage(input)
+    if err != nil {
+        return err
+    }
+    img := toNRGBA(src)
+
+    switch st.Type {
+    case StageCrop:
+        img, err = cropImage(img, image.Rect(st.X, st.Y, st.X+st.Width, st.Y+st.Height))
+    case StageRotate:
+        angle, flipH, flipV := st.angle(), st.Flip == FlipHorizontal, st.Flip == FlipVertical
+        if st.Auto {
+            angle, flipH = orientationTransform(orientation)
+        }
+        img = orientImage(img, angle, flipH, flipV)
+    case StageResize:
+        img = resizeImage(img, targetSize(ImageSize{Width: img.Rect.Dx(), Height: img.Rect.Dy()}, st.sizeRequest()))
+    case StageSharpen:
+        err = sharpenImage(ctx, img, st.Radius, st.Amount, st.Threshold)
+    case StageColor:
+        err = adjustColor(ctx, img, st.Brightness, st.Contrast, st.Saturation, st.Gamma)
+    case StageEncode:
+        // Only the format changes
+    }
+    if err != nil {
+        return err
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    return encodeImage(output, img, format, quality)
+}
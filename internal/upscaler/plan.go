@@ -0,0 +1,292 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+    // maxScale is the largest scale factor accepted in a request.
+    maxScale = 16.0
+    // maxDimension is the largest output edge the encoders can handle.
+    maxDimension = 65535
+    // maxPasses limits the number of model passes in a plan.
+    maxPasses = 3
+    // resizeProgressShare is the share of progress reserved for the final resize.
+    resizeProgressShare = 5
+)
+
+// Fit modes for requests with both a target width and height.
+const (
+    FitContain = "contain"
+    FitStretch = "stretch"
+)
+
+// Pass is a single model run within a plan.
+type Pass struct {
+    Model string `json:"model"`
+    Scale int    `json:"scale"`
+}
+
+// Plan describes how a request is executed: zero or more model passes at native
+// scale followed by an optional high-quality resize to the exact target size.
+type Plan struct {
+    Passes     []Pass     `json:"passes"`
+    ResizeTo   *ImageSize `json:"resize_to,omitempty"`
+    OutputSize ImageSize  `json:"output_size"`
+}
+
+// validateScale checks the scale and target parameters of a request.
+func validateScale(req Request) error {
+    if req.TargetWidth < 0 || req.TargetHeight < 0 {
+        return fmt.Errorf("invalid target size: %dx%d", req.TargetWidth, req.TargetHeight)
+    }
+    if req.TargetWidth > maxDimension || req.TargetHeight > maxDimension {
+        return fmt.Errorf("target size exceeds %d pixels", maxDimension)
+    }
+
+    if req.TargetWidth == 0 && req.TargetHeight == 0 {
+        if req.Scale <= 0 || req.Scale > maxScale {
+            return fmt.Errorf("invalid scale: %g (must be greater than 0 and at most %g)", req.Scale, maxScale)
+        }
+    }
+
+    switch req.Fit {
+    case "", FitContain, FitStretch:
+    default:
+        return fmt.Errorf("invalid fit: %s (must be %s or %s)", req.Fit, FitContain, FitStretch)
+    }
+
+    return nil
+}
+
+// targetSize computes the exact output size for a request.
+func targetSize(input ImageSize, req Request) ImageSize {
+    w, h := float64(input.Width), float64(input.Height)
+
+    var out ImageSize
+    switch {
+    case req.TargetWidth > 0 && req.TargetHeight > 0:
+        if req.Fit == FitStretch {
+            return ImageSize{Width: req.TargetWidth, Height: req.TargetHeight}
+        }
+        f := math.Min(float64(req.TargetWidth)/w, float64(req.TargetHeight)/h)
+        out = ImageSize{Width: int(math.Round(w * f)), Height: int(math.Round(h * f))}
+    case req.TargetWidth > 0:
+        f := float64(req.TargetWidth) / w
+        out = ImageSize{Width: req.TargetWidth, Height: int(math.Round(h * f))}
+    case req.TargetHeight > 0:
+        f := float64(req.TargetHeight) / h
+        out = ImageSize{Width: int(math.Round(w * f)), Height: req.TargetHeight}
+    default:
+        out = ImageSize{Width: int(math.Round(w * req.Scale)), Height: int(math.Round(h * req.Scale))}
+    }
+
+    out.Width = max(out.Width, 1)
+    out.Height = max(out.Height, 1)
+    return out
+}
+
+// planRequest plans the passes needed to turn an input of the given size into
+// the requested output using a model with the given native scales.
+func planRequest(input ImageSize, req Request, model string, scales []int) (Plan, error) {
+    target := targetSize(input, req)
+    if target.Width > maxDimension || target.Height > maxDimension {
+        return Plan{}, fmt.Errorf("output size %dx%d exceeds %d pixels", target.Width, target.Height, maxDimension)
+    }
+
+    factor := math.Max(float64(target.Width)/float64(input.Width), float64(target.Height)/float64(input.Height))
+
+    plan := Plan{OutputSize: target}
+
+    product := 1
+    if factor > 1 {
+        passes, ok := choosePasses(factor, scales)
+        if !ok {
+            return Plan{}, fmt.Errorf("model %s cannot reach scale %.2f in %d passes", model, factor, maxPasses)
+        }
+        for _, p := range passes {
+            plan.Passes = append(plan.Passes, Pass{Model: model, Scale: p})
+            product *= p
+        }
+    }
+
+    if input.Width*product != target.Width || input.Height*product != target.Height {
+        plan.ResizeTo = &ImageSize{Width: target.Width, Height: target.Height}
+    }
+
+    return plan, nil
+}
+
+// choosePasses picks the shortest sequence of native scales whose product reaches
+// factor, preferring the smallest overshoot. Smaller scales run first so that
+// early passes work on smaller images.
+func choosePasses(factor float64, scales []int) ([]int, bool) {
+    var best []int
+    bestProduct := 0
+
+    var search func(prefix []int, product int)
+    search = func(prefix []int, product int) {
+        if len(prefix) > 0 && float64(product) >= factor-1e-9 {
+            if best == nil || len(prefix) < len(best) || (len(prefix) == len(best) && product < bestProduct) {
+                best = append([]int(nil), prefix...)
+                bestProduct = product
+            }
+            return
+        }
+        if len(prefix) == maxPasses {
+            return
+        }
+        for _, s := range scales {
+            if s < 2 {
+                continue
+            }
+            search(append(prefix, s), product*s)
+        }
+    }
+    search(nil, 1)
+
+    if best == nil {
+        return nil, false
+    }
+    sort.Ints(best)
+    return best, true
+}
+
+// runPlan executes the passes of a plan and writes the final image to task.OutputPath.
+// Intermediate results are kept in the job directory (or a temporary directory),
+// so completed passes are skipped when a job is resumed.
+func (s *Service) runPlan(ctx context.Context, engine Engine, task Task, input ImageSize, plan Plan, exec execution) error {
+    dir := exec.dir
+    if dir == "" {
+        tmp, err := s.tempDir("plan-")
+        if err != nil {
+            return fmt.Errorf("failed to create plan dir: %w", err)
+        }
+        defer os.RemoveAll(tmp)
+        dir = tmp
+    }
+
+    // Weight every step by the number of pixels it produces
+    weights := make([]float64, len(plan.Passes))
+    total := 0.0
+    size := input
+    for i, p := range plan.Passes {
+        size = ImageSize{Width: size.Width * p.Scale, Height: size.Height * p.Scale}
+        weights[i] = float64(size.Width) * float64(size.Height)
+        total += weights[i]
+    }
+    share := 100
+    if plan.ResizeTo != nil {
+        share = 100 - resizeProgressShare
+    }
+
+    current := task.InputPath
+    size = input
+    done := 0.0
+    for i, p := range plan.Passes {
+        last := i == len(plan.Passes)-1 && plan.ResizeTo == nil
+
+        passTask := task
+        passTask.InputPath = current
+        passTask.Scale = p.Scale
+        passTask.ModelName = p.Model
+        if last {
+            passTask.OutputPath = task.OutputPath
+        } else {
+            passTask.OutputPath = filepath.Join(dir, fmt.Sprintf("pass%d.png", i+1))
+            passTask.Format = "png"
+        }
+
+        passExec := exec
+        passExec.dir = ""
+        if exec.dir != "" {
+            passExec.dir = filepath.Join(exec.dir, fmt.Sprintf("pass%d", i+1))
+        }
+        offset, weight := done, weights[i]
+        passExec.onProgress = func(pct int) {
+            exec.progress(int((offset + weight*float64(pct)/100) / total * float64(share)))
+        }
+
+        // Completed intermediate passes survive a restart
+        if _, err := os.Stat(passTask.OutputPath); err != nil || last {
+            if len(plan.Passes) > 1 {
+                exec.stage(fmt.Sprintf("upscale %d/%d", i+1, len(plan.Passes)))
+            } else {
+                exec.stage("upscale")
+            }
+            if err := s.runPass(ctx, engine, passTask, size, passExec); err != nil {
+                return fmt.Errorf("pass %d/%d failed: %w", i+1, len(plan.Passes), err)
+            }
+        }
+        if passExec.dir != "" {
+            _ = os.RemoveAll(passExec.dir)
+        }
+
+        done += weights[i]
+        exec.progress(int(done / total * float64(share)))
+        size = ImageSize{Width: size.Width * p.Scale, Height: size.Height * p.Scale}
+        current = passTask.OutputPath
+    }
+
+    if plan.ResizeTo == nil {
+        return nil
+    }
+
+    exec.stage("resize")
+    src, err := decodeImage(current)
+    if err != nil {
+        return err
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    dst := resizeImage(src, *plan.ResizeTo)
+    if err := encodeImage(task.OutputPath, dst, outputFormat(task.OutputPath, task.Format), 0); err != nil {
+        return err
+    }
+
+    exec.progress(100)
+    return nil
+}
+
+// runPass runs a single model pass, splitting the input into tiles if it is large.
+// Intermediate outputs are written to a temporary name first, so an existing
+// output file always represents a completed pass.
+func (s *Service) runPass(ctx context.Context, engine Engine, task Task, size ImageSize, exec execution) error {
+    final := task.OutputPath
+    task.OutputPath = filepath.Join(filepath.Dir(final), "part_"+filepath.Base(final))
+
+    var err error
+    if s.shouldSplit(size, outputFormat(final, task.Format)) {
+        err = s.upscaleTiled(ctx, engine, task, size, exec)
+    } else {
+        err = engine.Run(ctx, task, exec.onProgress)
+    }
+    if err != nil {
+        _ = os.Remove(task.OutputPath)
+        return err
+    }
+
+    return os.Rename(task.OutputPath, final)
+}
+
+// resizeImage scales src to the given size with a Lanczos filter. Downscaling
+// widens the filter automatically, so large reductions do not alias.
+func resizeImage(src image.Image, size ImageSize) *image.NRGBA {
+    dst := image.NewNRGBA(image.Rect(0, 0, size.Width, size.Height))
+    kernel := &draw.Kernel{Support: 3, At: lanczos3}
+    kernel.Scale(dst, dst.Rect, src, src.Bounds(), draw.Src, nil)
+    return dst
+}
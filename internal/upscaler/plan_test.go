@@ -0,0 +1,129 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateScale(t *testing.T) {
+    tests := []struct {
+        name    string
+        req     Request
+        wantErr bool
+    }{
+        {"scale", Request{Scale: 4}, false},
+        {"fractional scale", Request{Scale: 1.5}, false},
+        {"downscale", Request{Scale: 0.5}, false},
+        {"maximum scale", Request{Scale: maxScale}, false},
+        {"zero scale", Request{}, true},
+        {"negative scale", Request{Scale: -2}, true},
+        {"scale too large", Request{Scale: maxScale + 0.1}, true},
+        {"target width without scale", Request{TargetWidth: 1920}, false},
+        {"target box", Request{TargetWidth: 1920, TargetHeight: 1080, Fit: FitStretch}, false},
+        {"negative target", Request{TargetWidth: -1, Scale: 2}, true},
+        {"target too large", Request{TargetHeight: maxDimension + 1}, true},
+        {"unknown fit", Request{Scale: 2, Fit: "cover"}, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := validateScale(tt.req); (err != nil) != tt.wantErr {
+                t.Errorf("validateScale() error = %v, wantErr %v", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestTargetSize(t *testing.T) {
+    input := ImageSize{Width: 400, Height: 300}
+    tests := []struct {
+        name string
+        req  Request
+        want ImageSize
+    }{
+        {"scale", Request{Scale: 2.5}, ImageSize{Width: 1000, Height: 750}},
+        {"width", Request{TargetWidth: 1000}, ImageSize{Width: 1000, Height: 750}},
+        {"height", Request{TargetHeight: 600}, ImageSize{Width: 800, Height: 600}},
+        {"contain", Request{TargetWidth: 1000, TargetHeight: 1000}, ImageSize{Width: 1000, Height: 750}},
+        {"stretch", Request{TargetWidth: 1000, TargetHeight: 1000, Fit: FitStretch}, ImageSize{Width: 1000, Height: 1000}},
+        {"at least one pixel", Request{Scale: 0.001}, ImageSize{Width: 1, Height: 1}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := targetSize(input, tt.req); got != tt.want {
+                t.Errorf("targetSize() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestChoosePasses(t *testing.T) {
+    tests := []struct {
+        name   string
+        factor float64
+        scales []int
+        want   []int
+        ok     bool
+    }{
+        {"native", 4, []int{2, 3, 4}, []int{4}, true},
+        {"smallest overshoot", 2.5, []int{2, 3, 4}, []int{3}, true},
+        {"fewest passes", 6, []int{2, 3, 4}, []int{2, 3}, true},
+        {"smaller scales first", 12, []int{4, 3}, []int{3, 4}, true},
+        {"single scale", 8, []int{4}, []int{4, 4}, true},
+        {"fractional", 1.2, []int{4}, []int{4}, true},
+        {"too many passes", 100, []int{4}, nil, false},
+        {"unusable scales", 2, []int{0, 1}, nil, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, ok := choosePasses(tt.factor, tt.scales)
+            if ok != tt.ok || !slices.Equal(got, tt.want) {
+                t.Errorf("choosePasses(%g, %v) = %v, %v, want %v, %v", tt.factor, tt.scales, got, ok, tt.want, tt.ok)
+            }
+        })
+    }
+}
+
+func TestPlanRequest(t *testing.T) {
+    input := ImageSize{Width: 100, Height: 80}
+    tests := []struct {
+        name   string
+        req    Request
+        passes []int
+        resize bool
+    }{
+        {"native scale", Request{Scale: 4}, []int{4}, false},
+        {"fractional scale", Request{Scale: 1.5}, []int{2}, true},
+        {"downscale", Request{Scale: 0.5}, nil, true},
+        {"two passes", Request{Scale: 8}, []int{2, 4}, false},
+        {"target width", Request{TargetWidth: 300}, []int{4}, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            plan, err := planRequest(input, tt.req, "m", []int{2, 4})
+            if err != nil {
+                t.Fatalf("planRequest() error = %v", err)
+            }
+            var passes []int
+            for _, p := range plan.Passes {
+                passes = append(passes, p.Scale)
+            }
+            if !slices.Equal(passes, tt.passes) || (plan.ResizeTo != nil) != tt.resize {
+                t.Errorf("planRequest() = passes %v, resize %v, want %v, %v", passes, plan.ResizeTo, tt.passes, tt.resize)
+            }
+            if want := targetSize(input, tt.req); plan.OutputSize != want {
+                t.Errorf("output size = %v, want %v", plan.OutputSize, want)
+            }
+        })
+    }
+
+    if _, err := planRequest(ImageSize{Width: 20000, Height: 100}, Request{Scale: 4}, "m", []int{4}); err == nil {
+        t.Error("planRequest() accepted an output wider than the maximum dimension")
+    }
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"fmt"
+	"time"
+)
+
+// Priority orders queued jobs; higher priorities are started first. The zero
+// value is PriorityNormal.
+type Priority int
+
+// Priority levels.
+const (
+    PriorityLow    Priority = -1
+    PriorityNormal Priority = 0
+    PriorityHigh   Priority = 1
+)
+
+// defaultPriorityAging is the time after which a waiting job is treated as one
+// priority level higher.
+const defaultPriorityAging = 10 * time.Minute
+
+// ParsePriority parses a priority name. An empty name is PriorityNormal.
+func ParsePriority(name string) (Priority, error) {
+    switch name {
+    case "low":
+        return PriorityLow, nil
+    case "", "normal":
+        return PriorityNormal, nil
+    case "high":
+        return PriorityHigh, nil
+    default:
+        return PriorityNormal, fmt.Errorf("invalid priority: %s (must be low, normal or high)", name)
+    }
+}
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+    switch p {
+    case PriorityLow:
+        return "low"
+    case PriorityHigh:
+        return "high"
+    default:
+        return "normal"
+    }
+}
+
+// MarshalText encodes the priority by name.
+func (p Priority) MarshalText() ([]byte, error) {
+    return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority name.
+func (p *Priority) UnmarshalText(text []byte) error {
+    parsed, err := ParsePriority(string(text))
+    if err != nil {
+        return err
+    }
+    *p = parsed
+    return nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// queueEntry is a job waiting in the queue.
+type queueEntry struct {
+    job      *Job
+    priority Priority
+    enqueued time.Time
+}
+
+// jobQueue holds queued jobs until a worker of a matching device picks them up.
+// Jobs are started by priority; every aging interval a job waits counts as one
+// additional priority level, so low priority jobs are never starved.
+type jobQueue struct {
+    mu      sync.Mutex
+    cond    *sync.Cond
+    entries []*queueEntry
+    aging   time.Duration
+    // halted is set while dispatch is paused; pop keeps waiting.
+    halted  bool
+    closed  bool
+}
+
+// newJobQueue creates an empty queue with the given aging interval.
+func newJobQueue(aging time.Duration) *jobQueue {
+    if aging <= 0 {
+        aging = defaultPriorityAging
+    }
+    q := &jobQueue{aging: aging}
+    q.cond = sync.NewCond(&q.mu)
+    return q
+}
+
+// push adds a job with its requested priority and wakes up waiting workers.
+func (q *jobQueue) push(job *Job) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    q.entries = append(q.entries, &queueEntry{
+        job:      job,
+        priority: job.Request.Priority,
+        enqueued: time.Now(),
+    })
+    q.cond.Broadcast()
+}
+
+// pop blocks until a job that may run on the device is available and removes
+// the one with the highest effective priority from the queue. It returns nil
+// once the queue is closed.
+func (q *jobQueue) pop(device Device) *Job {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    for {
+        if q.closed {
+            return nil
+        }
+        if q.halted {
+            q.cond.Wait()
+            continue
+        }
+
+        now := time.Now()
+        best := -1
+        bestScore := 0.0
+        for i, e := range q.entries {
+            if !device.Matches(e.job.Request.Device) {
+                continue
+            }
+            // Entries are in arrival order, so ties go to the older job
+            if score := q.score(e, now); best < 0 || score > bestScore {
+                best, bestScore = i, score
+            }
+        }
+
+        if best >= 0 {
+            job := q.entries[best].job
+            q.entries = append(q.entries[:best], q.entries[best+1:]...)
+            return job
+        }
+
+        q.cond.Wait()
+    }
+}
+
+// score returns the effective priority of an entry including aging.
+func (q *jobQueue) score(e *queueEntry, now time.Time) float64 {
+    return float64(e.priority) + float64(now.Sub(e.enqueued))/float64(q.aging)
+}
+
+// len returns the number of queued jobs.
+func (q *jobQueue) len() int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    return len(q.entries)
+}
+
+// ordered returns the queued jobs in start order. The order reflects
+// priorities and aging at this moment.
+func (q *jobQueue) ordered() []*Job {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    now := time.Now()
+    entries := append([]*queueEntry(nil), q.entries...)
+    // Entries are in arrival order, so a stable sort keeps ties first-come first-served
+    sort.SliceStable(entries, func(i, j int) bool {
+        return q.score(entries[i], now) > q.score(entries[j], now)
+    })
+
+    jobs := make([]*Job, len(entries))
+    for i, e := range entries {
+        jobs[i] = e.job
+    }
+    return jobs
+}
+
+// position returns the 1-based position of a job in start order, or 0 if the
+// job is not queued.
+func (q *jobQueue) position(job *Job) int {
+    for i, j := range q.ordered() {
+        if j == job {
+            return i + 1
+        }
+    }
+    return 0
+}
+
+// setPriority changes the priority of a queued job. It returns false if the job
+// is not in the queue.
+func (q *jobQueue) setPriority(job *Job, priority Priority) bool {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    for _, e := range q.entries {
+        if e.job == job {
+            e.priority = priority
+            return true
+        }
+    }
+    return false
+}
+
+// pause stops or resumes handing out jobs.
+func (q *jobQueue) pause(halted bool) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    q.halted = halted
+    q.cond.Broadcast()
+}
+
+// paused reports whether handing out jobs is paused.
+func (q *jobQueue) paused() bool {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    return q.halted
+}
+
+// close wakes up all waiting workers and makes pop return nil. The jobs still
+// queued are returned; they stay visible to len, ordered and position.
+func (q *jobQueue) close() []*Job {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    q.closed = true
+    q.cond.Broadcast()
+
+    jobs := make([]*Job, len(q.entries))
+    for i, e := range q.entries {
+        jobs[i] = e.job
+    }
+    return jobs
+}
+
+// remove drops a job from the queue, e.g. when it is cancelled.
+func (q *jobQueue) remove(job *Job) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    for i, e := range q.entries {
+        if e.job == job {
+            q.entries = append(q.entries[:i], q.entries[i+1:]...)
+            return
+        }
+    }
+}
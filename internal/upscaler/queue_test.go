@@ -0,0 +1,155 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// queued describes a queue entry for the tests: its priority, how long it has
+// been waiting and its device preference.
+type queued struct {
+    id       string
+    priority Priority
+    waiting  time.Duration
+    device   string
+}
+
+// newTestQueue creates a queue with a 10 minute aging interval holding the
+// given entries in arrival order.
+func newTestQueue(entries []queued) *jobQueue {
+    q := newJobQueue(10 * time.Minute)
+    now := time.Now()
+    for _, e := range entries {
+        job := &Job{ID: e.id, Request: Request{Priority: e.priority, Device: e.device}}
+        q.entries = append(q.entries, &queueEntry{job: job, priority: e.priority, enqueued: now.Add(-e.waiting)})
+    }
+    return q
+}
+
+// jobIDs returns the IDs of jobs.
+func jobIDs(jobs []*Job) []string {
+    ids := make([]string, len(jobs))
+    for i, job := range jobs {
+        ids[i] = job.ID
+    }
+    return ids
+}
+
+func TestQueueOrder(t *testing.T) {
+    tests := []struct {
+        name    string
+        entries []queued
+        want    []string
+    }{
+        {
+            name:    "by priority",
+            entries: []queued{{id: "low", priority: PriorityLow}, {id: "normal"}, {id: "high", priority: PriorityHigh}},
+            want:    []string{"high", "normal", "low"},
+        },
+        {
+            name:    "first come first served",
+            entries: []queued{{id: "a"}, {id: "b"}, {id: "c"}},
+            want:    []string{"a", "b", "c"},
+        },
+        {
+            name: "aging within a level",
+            entries: []queued{
+                {id: "high", priority: PriorityHigh},
+                {id: "normal", waiting: 5 * time.Minute},
+            },
+            want: []string{"high", "normal"},
+        },
+        {
+            name: "aged low overtakes high",
+            entries: []queued{
+                {id: "high", priority: PriorityHigh, waiting: time.Minute},
+                {id: "low", priority: PriorityLow, waiting: 25 * time.Minute},
+            },
+            want: []string{"low", "high"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            q := newTestQueue(tt.entries)
+            if got := jobIDs(q.ordered()); !slices.Equal(got, tt.want) {
+                t.Errorf("ordered() = %v, want %v", got, tt.want)
+            }
+            for i, job := range q.ordered() {
+                if pos := q.position(job); pos != i+1 {
+                    t.Errorf("position(%s) = %d, want %d", job.ID, pos, i+1)
+                }
+            }
+
+            // Workers start the jobs in the same order
+            var popped []string
+            for range tt.entries {
+                popped = append(popped, q.pop(Device{Name: "gpu0", Kind: DeviceGPU}).ID)
+            }
+            if !slices.Equal(popped, tt.want) {
+                t.Errorf("pop() order = %v, want %v", popped, tt.want)
+            }
+        })
+    }
+}
+
+func TestQueuePopMatchesDevice(t *testing.T) {
+    q := newTestQueue([]queued{
+        {id: "cpu", priority: PriorityHigh, device: DeviceCPU},
+        {id: "gpu1", priority: PriorityHigh, device: "gpu1"},
+        {id: "any"},
+    })
+
+    gpu := Device{Name: "gpu0", Kind: DeviceGPU}
+    if job := q.pop(gpu); job.ID != "any" {
+        t.Errorf("pop(gpu0) = %s, want the job for any device", job.ID)
+    }
+    if job := q.pop(Device{Name: "cpu", Kind: DeviceCPU}); job.ID != "cpu" {
+        t.Errorf("pop(cpu) = %s, want cpu", job.ID)
+    }
+    if q.len() != 1 {
+        t.Errorf("len() = %d, want 1", q.len())
+    }
+}
+
+func TestQueueSetPriority(t *testing.T) {
+    q := newTestQueue([]queued{{id: "a"}, {id: "b"}})
+    jobs := q.ordered()
+
+    if !q.setPriority(jobs[1], PriorityHigh) {
+        t.Fatal("setPriority() = false for a queued job")
+    }
+    if got := jobIDs(q.ordered()); !slices.Equal(got, []string{"b", "a"}) {
+        t.Errorf("ordered() = %v, want [b a]", got)
+    }
+
+    q.remove(jobs[0])
+    if q.setPriority(jobs[0], PriorityHigh) || q.position(jobs[0]) != 0 {
+        t.Error("removed job is still queued")
+    }
+}
+
+func TestParsePriority(t *testing.T) {
+    tests := []struct {
+        name    string
+        want    Priority
+        wantErr bool
+    }{
+        {"", PriorityNormal, false},
+        {"low", PriorityLow, false},
+        {"normal", PriorityNormal, false},
+        {"high", PriorityHigh, false},
+        {"urgent", PriorityNormal, true},
+    }
+
+    for _, tt := range tests {
+        got, err := ParsePriority(tt.name)
+        if got != tt.want || (err != nil) != tt.wantErr {
+            t.Errorf("ParsePriority(%q) = %v, %v, want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+        }
+    }
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// realcuganPrefix is prepended to the model directory names to form the
+// model names.
+const realcuganPrefix = "realcugan-"
+
+// realcuganModelFile matches the model files of a Real-CUGAN model directory,
+// e.g. "up2x-denoise1x.param".
+var realcuganModelFile = regexp.MustCompile(`^up([0-9])x-(conservative|no-denoise|denoise([0-9])x)\.param$`)
+
+// realcuganEngine runs the external realcugan-ncnn-vulkan binary. Each
+// "models-*" directory below the models path is a model, e.g. models-se is
+// served as "realcugan-se".
+type realcuganEngine struct {
+    config EngineConfig
+}
+
+// NewRealCUGANEngine creates an engine that shells out to realcugan-ncnn-vulkan.
+func NewRealCUGANEngine(cfg EngineConfig) Engine {
+    if cfg.Name == "" {
+        cfg.Name = EngineRealCUGAN
+    }
+    return &realcuganEngine{config: cfg}
+}
+
+// Name returns the engine identifier.
+func (e *realcuganEngine) Name() string {
+    return e.config.Name
+}
+
+// Capabilities describes the features of the ncnn binary.
+func (e *realcuganEngine) Capabilities() Capabilities {
+    return Capabilities{
+        GPU:      true,
+        TileSize: true,
+        Formats:  []string{"png", "jpg", "webp"},
+    }
+}
+
+// Available checks that the binary exists.
+func (e *realcuganEngine) Available() error {
+    return binaryAvailable(e.config.BinaryPath)
+}
+
+// Models returns a model for every model directory that contains model files.
+func (e *realcuganEngine) Models() ([]ModelInfo, error) {
+    dirs, err := modelDirs(e.config.ModelsPath)
+    if err != nil {
+        return nil, err
+    }
+
+    models := make([]ModelInfo, 0, len(dirs))
+    for _, dir := range dirs {
+        path := e.modelDir(realcuganPrefix + dir)
+        scales, levels := e.scan(path)
+        if len(scales) == 0 {
+            continue
+        }
+
+        // Manifests describe known models, see registry.go
+        info := ModelInfo{
+            Name:            realcuganPrefix + dir,
+            Description:     "Custom Real-CUGAN model",
+            Engine:          e.Name(),
+            SupportedScales: scales,
+            Options: &ModelOptions{
+                DenoiseLevels:  levels,
+                DefaultDenoise: intPtr(realcuganDefaultDenoise(levels)),
+                TTA:            true,
+                SyncGapModes:   []int{0, 1, 2, 3},
+            },
+            files: pairFiles(path),
+        }
+
+        models = append(models, info)
+    }
+
+    return models, nil
+}
+
+// SupportedScales returns the scales any denoise level of a model supports.
+func (e *realcuganEngine) SupportedScales(model string) []int {
+    scales, _ := e.scan(e.modelDir(model))
+    return scales
+}
+
+// Run executes the binary for a single task and parses its progress output.
+func (e *realcuganEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    if err := e.Available(); err != nil {
+        return err
+    }
+
+    args, err := e.buildArgs(task)
+    if err != nil {
+        return err
+    }
+    return runBinary(ctx, e.config.BinaryPath, args, parsePercent, onProgress)
+}
+
+// buildArgs constructs the command-line arguments for realcugan-ncnn-vulkan.
+// Not every model has every denoise level at every scale, so the model file
+// is checked first.
+func (e *realcuganEngine) buildArgs(task Task) ([]string, error) {
+    dir := e.modelPath(task)
+
+    _, levels := e.scan(dir)
+    noise := realcuganDefaultDenoise(levels)
+    if task.Options.Denoise != nil {
+        noise = *task.Options.Denoise
+    }
+    file := filepath.Join(dir, realcuganFileName(task.Scale, noise))
+    if _, err := os.Stat(file); err != nil {
+        return nil, fmt.Errorf("%w: model %s has no %dx model for denoise level %d", ErrInvalidRequest, task.ModelName, task.Scale, noise)
+    }
+
+    args := []string{
+        "-i", task.InputPath,
+        "-o", task.OutputPath,
+        "-s", fmt.Sprintf("%d", task.Scale),
+        "-n", fmt.Sprintf("%d", noise),
+        "-m", dir,
+    }
+
+    if e.config.Threads != "" {
+        args = append(args, "-j", e.config.Threads)
+    }
+
+    if task.TileSize > 0 {
+        args = append(args, "-t", fmt.Sprintf("%d", task.TileSize))
+    }
+
+    args = append(args, deviceArgs(task.Device)...)
+
+    if task.Options.SyncGap != nil {
+        args = append(args, "-c", fmt.Sprintf("%d", *task.Options.SyncGap))
+    }
+
+    if task.Options.TTA {
+        args = append(args, "-x")
+    }
+
+    if task.Format != "" {
+        args = append(args, "-f", task.Format)
+    }
+
+    return args, nil
+}
+
+// modelDir returns the directory of a model below the models path.
+func (e *realcuganEngine) modelDir(model string) string {
+    return filepath.Join(e.config.ModelsPath, "models-"+strings.TrimPrefix(model, realcuganPrefix))
+}
+
+// modelPath returns the directory holding the model files of a task.
+func (e *realcuganEngine) modelPath(task Task) string {
+    if task.ModelDir != "" {
+        return task.ModelDir
+    }
+    return e.modelDir(task.ModelName)
+}
+
+// scan returns the scales and denoise levels of the model files in a model
+// directory, both sorted.
+func (e *realcuganEngine) scan(dir string) ([]int, []int) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, nil
+    }
+
+    var scales, levels []int
+    for _, entry := range entries {
+        m := realcuganModelFile.FindStringSubmatch(entry.Name())
+        if m == nil {
+            continue
+        }
+        scale, _ := strconv.Atoi(m[1])
+        level := -1
+        switch {
+        case m[2] == "no-denoise":
+            level = 0
+        case m[3] != "":
+            level, _ = strconv.Atoi(m[3])
+        }
+        if scale >= 2 && !slices.Contains(scales, scale) {
+            scales = append(scales, scale)
+        }
+        if !slices.Contains(levels, level) {
+            levels = append(levels, level)
+        }
+    }
+
+    slices.Sort(scales)
+    slices.Sort(levels)
+    return scales, levels
+}
+
+// realcuganDefaultDenoise returns the denoise level used when a request does
+// not set one: -1 (conservative) like the binary, or the lowest level the
+// model has.
+func realcuganDefaultDenoise(levels []int) int {
+    if len(levels) == 0 || slices.Contains(levels, -1) {
+        return -1
+    }
+    return levels[0]
+}
+
+// realcuganFileName returns the name of the model file for a scale and
+// denoise level.
+func realcuganFileName(scale, noise int) string {
+    switch noise {
+    case -1:
+        return fmt.Sprintf("up%dx-conservative.param", scale)
+    case 0:
+        return fmt.Sprintf("up%dx-no-denoise.param", scale)
+    default:
+        return fmt.Sprintf("up%dx-denoise%dx.param", scale, noise)
+    }
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stopGracePeriod is the time the binary gets to exit after an interrupt
+// before it is killed.
+const stopGracePeriod = 5 * time.Second
+
+// RealESRGANConfig holds the settings for the realesrgan-ncnn-vulkan engine.
+type RealESRGANConfig struct {
+    BinaryPath string
+    ModelsPath string
+    Threads    string
+}
+
+// realesrganEngine runs the external realesrgan-ncnn-vulkan binary.
+type realesrganEngine struct {
+    name   string
+    config RealESRGANConfig
+}
+
+// NewRealESRGANEngine creates an engine that shells out to realesrgan-ncnn-vulkan.
+func NewRealESRGANEngine(cfg RealESRGANConfig) Engine {
+    return &realesrganEngine{name: EngineRealESRGAN, config: cfg}
+}
+
+// Name returns the engine identifier.
+func (e *realesrganEngine) Name() string {
+    return e.name
+}
+
+// Capabilities describes the features of the ncnn binary.
+func (e *realesrganEngine) Capabilities() Capabilities {
+    return Capabilities{
+        GPU:      true,
+        TileSize: true,
+        Formats:  []string{"png", "jpg", "webp"},
+    }
+}
+
+// Available checks that the binary exists.
+func (e *realesrganEngine) Available() error {
+    return binaryAvailable(e.config.BinaryPath)
+}
+
+// Models scans the models directory and returns the installed models.
+func (e *realesrganEngine) Models() ([]ModelInfo, error) {
+    entries, err := os.ReadDir(e.config.ModelsPath)
+    if err != nil {
+        return nil, err
+    }
+
+    models := make([]ModelInfo, 0)
+    seen := make(map[string]bool)
+
+    for _, entry := range entries {
+        // Filter for .param or .bin or directories
+        name := entry.Name()
+        modelName := name
+
+        // If file, strip extension to get model name
+        if !entry.IsDir() {
+            ext := filepath.Ext(name)
+            if ext == ".param" || ext == ".bin" {
+                modelName = name[0 : len(name)-len(ext)]
+            } else {
+                continue
+            }
+        }
+
+        if seen[modelName] {
+            continue
+        }
+        seen[modelName] = true
+
+        // Manifests describe known models, see registry.go
+        info := ModelInfo{
+            Name:            modelName,
+            Description:     "Custom model",
+            Engine:          e.Name(),
+            SupportedScales: e.SupportedScales(modelName),
+            Options:         &ModelOptions{TTA: true},
+            files: []string{
+                filepath.Join(e.config.ModelsPath, modelName+".param"),
+                filepath.Join(e.config.ModelsPath, modelName+".bin"),
+            },
+        }
+
+        models = append(models, info)
+    }
+
+    return models, nil
+}
+
+// SupportedScales returns the scales the binary accepts. Models without a
+// manifest are assumed to run at all of them.
+func (e *realesrganEngine) SupportedScales(model string) []int {
+    return []int{2, 3, 4}
+}
+
+// Run executes the binary for a single task and parses its progress output.
+func (e *realesrganEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    if err := e.Available(); err != nil {
+        return err
+    }
+
+    return runBinary(ctx, e.config.BinaryPath, e.buildArgs(task), parsePercent, onProgress)
+}
+
+// buildArgs constructs the command-line arguments for the upscaler binary.
+func (e *realesrganEngine) buildArgs(task Task) []string {
+    modelDir := e.config.ModelsPath
+    if task.ModelDir != "" {
+        modelDir = task.ModelDir
+    }
+
+    args := []string{
+        "-i", task.InputPath,
+        "-o", task.OutputPath,
+        "-s", fmt.Sprintf("%d", task.Scale),
+        "-m", modelDir,
+        "-n", task.ModelName,
+        "-j", e.config.Threads,
+    }
+
+    if task.TileSize > 0 {
+        args = append(args, "-t", fmt.Sprintf("%d", task.TileSize))
+    }
+
+    args = append(args, deviceArgs(task.Device)...)
+
+    if task.Options.TTA {
+        args = append(args, "-x")
+    }
+
+    if task.Format != "" {
+        args = append(args, "-f", task.Format)
+    }
+
+    return args
+}
+
+// parsePercent extracts a progress value from an ncnn output line.
+// The format is typically "23.45%".
+func parsePercent(line string) (int, bool) {
+    if !strings.Contains(line, "%") {
+        return 0, false
+    }
+
+    line = strings.TrimSpace(line)
+    line = strings.TrimSuffix(line, "%")
+
+    var percent float64
+    if _, err := fmt.Sscanf(line, "%f", &percent); err != nil {
+        return 0, false
+    }
+    return int(percent), true
+}
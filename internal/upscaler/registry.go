@@ -0,0 +1,294 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fallbackDefaultModel is the default model if neither the configuration nor
+// a manifest names one.
+const fallbackDefaultModel = "realesrgan-x4plus"
+
+// Content types of a model manifest.
+const (
+    ContentGeneral = "general"
+    ContentPhoto   = "photo"
+    ContentAnime   = "anime"
+    ContentVideo   = "video"
+)
+
+// ModelManifest describes a model. Manifests are YAML or JSON files in a
+// models directory named after the model, e.g. realesrgan-x4plus.yaml, and
+// replace the guesses engines make about the model files they find.
+type ModelManifest struct {
+    // Name is the model name; it defaults to the file name.
+    Name                string `yaml:"name" json:"name"`
+    DisplayName         string `yaml:"display_name" json:"display_name"`
+    Description         string `yaml:"description" json:"description"`
+    // Engine restricts the manifest to the models of one engine.
+    Engine              string `yaml:"engine" json:"engine"`
+    // NativeScale is the scale the model was trained for.
+    NativeScale         int    `yaml:"native_scale" json:"native_scale"`
+    // SupportedScales are the scales the model can run in one pass.
+    SupportedScales     []int  `yaml:"supported_scales" json:"supported_scales"`
+    // ContentType is general, photo, anime or video.
+    ContentType         string `yaml:"content_type" json:"content_type"`
+    License             string `yaml:"license" json:"license"`
+    // RecommendedTileSize is the engine tile size used when a request sets none.
+    RecommendedTileSize int    `yaml:"recommended_tile_size" json:"recommended_tile_size"`
+    // Default marks the model used when a request names none.
+    Default             bool   `yaml:"default" json:"default"`
+    // Files are verified before the model is used.
+    Files               []ManifestFile `yaml:"files" json:"files"`
+    // dir is the directory of the manifest; file names are relative to it.
+    dir                 string
+}
+
+// ManifestFile is a model file listed in a manifest. Size and SHA256 are
+// checked if set.
+type ManifestFile struct {
+    Name   string `yaml:"name" json:"name"`
+    Size   int64  `yaml:"size" json:"size"`
+    SHA256 string `yaml:"sha256" json:"sha256"`
+}
+
+// modelRegistry holds the model manifests by model name.
+type modelRegistry struct {
+    manifests map[string]ModelManifest
+}
+
+// loadRegistry reads the manifests in the given directories. Invalid
+// manifests are logged and skipped; earlier directories win on name clashes.
+func loadRegistry(dirs []string) *modelRegistry {
+    r := &modelRegistry{manifests: make(map[string]ModelManifest)}
+
+    for _, dir := range dirs {
+        entries, err := os.ReadDir(dir)
+        if err != nil {
+            continue
+        }
+        for _, entry := range entries {
+            ext := filepath.Ext(entry.Name())
+            if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+                continue
+            }
+
+            path := filepath.Join(dir, entry.Name())
+            m, err := readManifest(path)
+            if err != nil {
+                log.Printf("Skipping model manifest %s: %v", path, err)
+                continue
+            }
+            if _, ok := r.manifests[m.Name]; ok {
+                log.Printf("Skipping model manifest %s: model %s is already described", path, m.Name)
+                continue
+            }
+            r.manifests[m.Name] = m
+        }
+    }
+
+    return r
+}
+
+// readManifest reads and validates a manifest file.
+func readManifest(path string) (ModelManifest, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return ModelManifest{}, err
+    }
+
+    var m ModelManifest
+    if filepath.Ext(path) == ".json" {
+        dec := json.NewDecoder(bytes.NewReader(data))
+        dec.DisallowUnknownFields()
+        err = dec.Decode(&m)
+    } else {
+        dec := yaml.NewDecoder(bytes.NewReader(data))
+        dec.KnownFields(true)
+        err = dec.Decode(&m)
+    }
+    if err != nil {
+        return ModelManifest{}, fmt.Errorf("failed to parse manifest: %w", err)
+    }
+
+    if m.Name == "" {
+        m.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+    }
+    m.dir = filepath.Dir(path)
+    if err := m.validate(); err != nil {
+        return ModelManifest{}, err
+    }
+    return m, nil
+}
+
+// validate checks the values of a manifest.
+func (m *ModelManifest) validate() error {
+    for _, scale := range append(m.SupportedScales, m.NativeScale) {
+        if scale != 0 && (scale < 2 || scale > maxScale) {
+            return fmt.Errorf("invalid supported scale: %d", scale)
+        }
+    }
+    slices.Sort(m.SupportedScales)
+    m.SupportedScales = slices.Compact(m.SupportedScales)
+
+    if m.NativeScale != 0 {
+        if len(m.SupportedScales) == 0 {
+            m.SupportedScales = []int{m.NativeScale}
+        }
+        if !slices.Contains(m.SupportedScales, m.NativeScale) {
+            return fmt.Errorf("invalid native scale: %d (must be one of the supported scales)", m.NativeScale)
+        }
+    }
+
+    switch m.ContentType {
+    case "", ContentGeneral, ContentPhoto, ContentAnime, ContentVideo:
+    default:
+        return fmt.Errorf("invalid content type: %s", m.ContentType)
+    }
+
+    if m.RecommendedTileSize != 0 && m.RecommendedTileSize < minTileSize {
+        return fmt.Errorf("invalid recommended tile size: %d (must be 0 or at least %d)", m.RecommendedTileSize, minTileSize)
+    }
+
+    for _, f := range m.Files {
+        if f.Name == "" || f.Name != filepath.Base(f.Name) {
+            return fmt.Errorf("invalid file name: %q (must be a file in the manifest directory)", f.Name)
+        }
+        if f.Size < 0 {
+            return fmt.Errorf("invalid size of %s: %d", f.Name, f.Size)
+        }
+        if _, err := hex.DecodeString(f.SHA256); err != nil || (f.SHA256 != "" && len(f.SHA256) != 2*sha256.Size) {
+            return fmt.Errorf("invalid sha256 of %s: %q", f.Name, f.SHA256)
+        }
+    }
+    return nil
+}
+
+// manifest returns the manifest of a model served by the given engine.
+func (r *modelRegistry) manifest(model, engine string) (ModelManifest, bool) {
+    m, ok := r.manifests[model]
+    if !ok || (m.Engine != "" && m.Engine != engine) {
+        return ModelManifest{}, false
+    }
+    return m, true
+}
+
+// apply fills in a model description from its manifest.
+func (m ModelManifest) apply(info *ModelInfo) {
+    info.DisplayName = m.DisplayName
+    if m.Description != "" {
+        info.Description = m.Description
+    }
+    if len(m.SupportedScales) > 0 {
+        info.SupportedScales = m.SupportedScales
+    }
+    info.NativeScale = m.NativeScale
+    info.ContentType = m.ContentType
+    info.License = m.License
+    info.RecommendedTileSize = m.RecommendedTileSize
+    info.Default = m.Default
+}
+
+// manifestDirs returns the directories that hold model manifests: the models
+// directory and those of the additional engines.
+func (cfg Config) manifestDirs() []string {
+    dirs := []string{cfg.ModelsPath}
+    for _, e := range cfg.Engines {
+        if !slices.Contains(dirs, e.ModelsPath) {
+            dirs = append(dirs, e.ModelsPath)
+        }
+    }
+    return dirs
+}
+
+// supportedScales returns the scales a model served by engine can run in one
+// pass as the catalogue describes it, i.e. preferring its manifest. Removed
+// models keep their scales while their jobs run.
+func (s *Service) supportedScales(engine Engine, model string) []int {
+    if info, err := s.modelInfo(model); err == nil && len(info.SupportedScales) > 0 {
+        return info.SupportedScales
+    }
+    return engine.SupportedScales(model)
+}
+
+// recommendedTileSize returns the tile size the manifest of a model
+// recommends, or 0.
+func (s *Service) recommendedTileSize(model string) int {
+    info, err := s.modelInfo(model)
+    if err != nil {
+        return 0
+    }
+    return info.RecommendedTileSize
+}
+
+// DefaultModel returns the model used when a request names none: the
+// configured default model if it is installed and intact, otherwise the model whose
+// manifest is marked as default.
+func (s *Service) DefaultModel() string {
+    models, _ := s.GetAvailableModels()
+    return defaultModel(models, s.config.DefaultModel)
+}
+
+// defaultModel picks the default model from the installed models.
+func defaultModel(models []ModelInfo, configured string) string {
+    for _, m := range models {
+        if m.Name == configured && m.Available {
+            return configured
+        }
+    }
+    for _, m := range models {
+        if m.Default && m.Available {
+            return m.Name
+        }
+    }
+    if configured != "" {
+        return configured
+    }
+    return fallbackDefaultModel
+}
+
+// validateModelScales rejects integer scales below the smallest scale a
+// model supports, e.g. an anime 4x model at 2x. The model would upscale the
+// image only to shrink it again. Fractional scales and target sizes are
+// planned with a final resize instead.
+func (s *Service) validateModelScales(req Request) error {
+    check := func(model string, size Request) error {
+        if size.TargetWidth != 0 || size.TargetHeight != 0 || size.Scale <= 1 || size.Scale != float64(int(size.Scale)) {
+            return nil
+        }
+        info, err := s.modelInfo(model)
+        if err != nil || len(info.SupportedScales) == 0 {
+            return nil
+        }
+        if int(size.Scale) < info.SupportedScales[0] {
+            return fmt.Errorf("model %s does not support scale %d (supported: %v)", model, int(size.Scale), info.SupportedScales)
+        }
+        return nil
+    }
+
+    if len(req.Pipeline) == 0 {
+        return check(req.ModelName, req)
+    }
+    for _, st := range req.Pipeline {
+        if st.Type != StageUpscale {
+            continue
+        }
+        if err := check(stageModel(req, st), st.sizeRequest()); err != nil {
+            return err
+        }
+    }
+    return nil
+}
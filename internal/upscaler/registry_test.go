@@ -0,0 +1,121 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShippedManifests(t *testing.T) {
+    paths, err := filepath.Glob(filepath.Join("..", "..", "models", "*.yaml"))
+    if err != nil || len(paths) == 0 {
+        t.Fatalf("no manifests in models: %v", err)
+    }
+
+    for _, path := range paths {
+        t.Run(filepath.Base(path), func(t *testing.T) {
+            m, err := readManifest(path)
+            if err != nil {
+                t.Fatalf("readManifest() error = %v", err)
+            }
+            if m.Description == "" || m.Engine == "" || m.License == "" {
+                t.Errorf("manifest lacks description, engine or license: %+v", m)
+            }
+            if m.Engine != "realesrgan" && !strings.HasPrefix(m.Name, m.Engine+"-") {
+                t.Errorf("model %s does not belong to engine %s", m.Name, m.Engine)
+            }
+        })
+    }
+
+    // Only one of them marks the default model
+    registry := loadRegistry([]string{filepath.Join("..", "..", "models")})
+    defaults := 0
+    for _, m := range registry.manifests {
+        if m.Default {
+            defaults++
+        }
+    }
+    if defaults != 1 {
+        t.Errorf("%d manifests set default, want 1", defaults)
+    }
+}
+
+func TestManifestValidate(t *testing.T) {
+    sha := strings.Repeat("ab", 32)
+    tests := []struct {
+        name       string
+        manifest   ModelManifest
+        wantErr    string
+        wantScales []int
+    }{
+        {name: "empty", manifest: ModelManifest{}},
+        {name: "scales sorted and deduplicated", manifest: ModelManifest{NativeScale: 4, SupportedScales: []int{4, 2, 4, 3}}, wantScales: []int{2, 3, 4}},
+        {name: "native scale only", manifest: ModelManifest{NativeScale: 4}, wantScales: []int{4}},
+        {name: "scale 1", manifest: ModelManifest{SupportedScales: []int{1, 2}}, wantErr: "invalid supported scale: 1"},
+        {name: "scale too large", manifest: ModelManifest{NativeScale: 32}, wantErr: "invalid supported scale: 32"},
+        {name: "native scale not supported", manifest: ModelManifest{NativeScale: 4, SupportedScales: []int{2}}, wantErr: "invalid native scale"},
+        {name: "content type", manifest: ModelManifest{ContentType: ContentAnime}},
+        {name: "unknown content type", manifest: ModelManifest{ContentType: "cartoon"}, wantErr: "invalid content type"},
+        {name: "tile size", manifest: ModelManifest{RecommendedTileSize: 256}},
+        {name: "tile size too small", manifest: ModelManifest{RecommendedTileSize: minTileSize - 1}, wantErr: "invalid recommended tile size"},
+        {name: "files", manifest: ModelManifest{Files: []ManifestFile{{Name: "m.bin", Size: 10, SHA256: sha}, {Name: "m.param"}}}},
+        {name: "file without name", manifest: ModelManifest{Files: []ManifestFile{{Size: 10}}}, wantErr: "invalid file name"},
+        {name: "file outside the directory", manifest: ModelManifest{Files: []ManifestFile{{Name: "../m.bin"}}}, wantErr: "invalid file name"},
+        {name: "negative size", manifest: ModelManifest{Files: []ManifestFile{{Name: "m.bin", Size: -1}}}, wantErr: "invalid size"},
+        {name: "sha256 not hex", manifest: ModelManifest{Files: []ManifestFile{{Name: "m.bin", SHA256: strings.Repeat("zz", 32)}}}, wantErr: "invalid sha256"},
+        {name: "sha256 too short", manifest: ModelManifest{Files: []ManifestFile{{Name: "m.bin", SHA256: "abcd"}}}, wantErr: "invalid sha256"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            m := tt.manifest
+            err := m.validate()
+            if tt.wantErr == "" && err != nil {
+                t.Fatalf("validate() error = %v", err)
+            }
+            if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+                t.Fatalf("validate() error = %v, want %q", err, tt.wantErr)
+            }
+            if tt.wantScales != nil && !slices.Equal(m.SupportedScales, tt.wantScales) {
+                t.Errorf("supported scales = %v, want %v", m.SupportedScales, tt.wantScales)
+            }
+        })
+    }
+}
+
+func TestReadManifest(t *testing.T) {
+    tests := []struct {
+        file    string
+        data    string
+        want    string
+        wantErr bool
+    }{
+        {"custom.yaml", "description: Custom\nnative_scale: 2\n", "custom", false},
+        {"custom.json", `{"name": "renamed", "native_scale": 2}`, "renamed", false},
+        {"unknown.yaml", "descripton: typo\n", "", true},
+        {"unknown.json", `{"scale": 2}`, "", true},
+        {"invalid.yaml", "native_scale: 5\nsupported_scales: [2]\n", "", true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.file, func(t *testing.T) {
+            path := filepath.Join(t.TempDir(), tt.file)
+            if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+                t.Fatal(err)
+            }
+
+            m, err := readManifest(path)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("readManifest() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if m.Name != tt.want {
+                t.Errorf("name = %q, want %q", m.Name, tt.want)
+            }
+        })
+    }
+}
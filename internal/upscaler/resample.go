@@ -0,0 +1,192 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// resampleBands is the number of horizontal bands the output is rendered in,
+// which sets the granularity of progress reporting and cancellation.
+const resampleBands = 20
+
+// resampleFilter describes a classic interpolation filter exposed as a pseudo-model.
+type resampleFilter struct {
+    model       string
+    description string
+    kernel      *draw.Kernel
+}
+
+// resampleFilters lists the filters offered by the resample engine.
+var resampleFilters = []resampleFilter{
+    {
+        model:       "resample-lanczos",
+        description: "Built-in Lanczos (a=3) resampling, no GPU or external binary required",
+        kernel:      &draw.Kernel{Support: 3, At: lanczos3},
+    },
+    {
+        model:       "resample-catmullrom",
+        description: "Built-in Catmull-Rom resampling, no GPU or external binary required",
+        kernel:      draw.CatmullRom,
+    },
+    {
+        model:       "resample-bicubic",
+        description: "Built-in bicubic (a=-0.75) resampling, no GPU or external binary required",
+        kernel:      &draw.Kernel{Support: 2, At: bicubic},
+    },
+}
+
+// DefaultResampleModel is the pseudo-model used when falling back to the resample engine.
+const DefaultResampleModel = "resample-lanczos"
+
+// resampleEngine upscales images in-process with golang.org/x/image/draw.
+type resampleEngine struct{}
+
+// NewResampleEngine creates the pure-Go resampling engine.
+func NewResampleEngine() Engine {
+    return &resampleEngine{}
+}
+
+// Name returns the engine identifier.
+func (e *resampleEngine) Name() string {
+    return "resample"
+}
+
+// Capabilities describes the features of the resample engine.
+func (e *resampleEngine) Capabilities() Capabilities {
+    return Capabilities{
+        GPU:      false,
+        TileSize: false,
+        Formats:  []string{"png", "jpg"},
+    }
+}
+
+// Available always succeeds, the engine has no external dependencies.
+func (e *resampleEngine) Available() error {
+    return nil
+}
+
+// Models returns the filters as pseudo-models.
+func (e *resampleEngine) Models() ([]ModelInfo, error) {
+    models := make([]ModelInfo, 0, len(resampleFilters))
+    for _, f := range resampleFilters {
+        models = append(models, ModelInfo{
+            Name:            f.model,
+            Description:     f.description,
+            Engine:          e.Name(),
+            SupportedScales: e.SupportedScales(f.model),
+        })
+    }
+    return models, nil
+}
+
+// SupportedScales returns the scales the filters support.
+func (e *resampleEngine) SupportedScales(model string) []int {
+    return []int{2, 3, 4}
+}
+
+// Run decodes the input, scales it with the selected filter and encodes the result.
+func (e *resampleEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    filter, ok := findResampleFilter(task.ModelName)
+    if !ok {
+        return fmt.Errorf("unknown resample model: %s", task.ModelName)
+    }
+
+    format := outputFormat(task.OutputPath, task.Format)
+    if !canEncode(format) {
+        return fmt.Errorf("output format %s is not supported by the %s engine", format, e.Name())
+    }
+
+    src, err := decodeImage(task.InputPath)
+    if err != nil {
+        return err
+    }
+
+    dst, err := scaleImage(ctx, filter.kernel, src, task.Scale, onProgress)
+    if err != nil {
+        return err
+    }
+
+    return encodeImage(task.OutputPath, dst, format, 0)
+}
+
+// findResampleFilter looks up a filter by its pseudo-model name.
+func findResampleFilter(model string) (resampleFilter, bool) {
+    for _, f := range resampleFilters {
+        if f.model == model {
+            return f, true
+        }
+    }
+    return resampleFilter{}, false
+}
+
+// scaleImage enlarges src by an integer factor. The output is rendered band by band;
+// each band only reads the source rows it needs (plus the kernel support), so the
+// horizontal pass is not repeated for the whole image on every band.
+func scaleImage(ctx context.Context, kernel *draw.Kernel, src image.Image, scale int, onProgress func(int)) (*image.NRGBA, error) {
+    sb := src.Bounds()
+    dst := image.NewNRGBA(image.Rect(0, 0, sb.Dx()*scale, sb.Dy()*scale))
+
+    pad := int(math.Ceil(kernel.Support)) + 1
+    rows := sb.Dy()
+
+    for i := 0; i < resampleBands; i++ {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+
+        y0 := rows * i / resampleBands
+        y1 := rows * (i + 1) / resampleBands
+        if y0 == y1 {
+            continue
+        }
+
+        sy0 := max(0, y0-pad)
+        sy1 := min(rows, y1+pad)
+
+        sr := image.Rect(sb.Min.X, sb.Min.Y+sy0, sb.Max.X, sb.Min.Y+sy1)
+        dr := image.Rect(0, sy0*scale, dst.Rect.Dx(), sy1*scale)
+        band := dst.SubImage(image.Rect(0, y0*scale, dst.Rect.Dx(), y1*scale)).(*image.NRGBA)
+
+        kernel.Scale(band, dr, src, sr, draw.Src, nil)
+
+        if onProgress != nil {
+            onProgress((i + 1) * 100 / resampleBands)
+        }
+    }
+
+    return dst, nil
+}
+
+// lanczos3 is the Lanczos windowed sinc with a=3.
+func lanczos3(t float64) float64 {
+    t = math.Abs(t)
+    if t < 1e-9 {
+        return 1
+    }
+    if t >= 3 {
+        return 0
+    }
+    pt := math.Pi * t
+    return 3 * math.Sin(pt) * math.Sin(pt/3) / (pt * pt)
+}
+
+// bicubic is the Keys cubic convolution kernel with a=-0.75.
+func bicubic(t float64) float64 {
+    const a = -0.75
+    t = math.Abs(t)
+    switch {
+    case t <= 1:
+        return ((a+2)*t-(a+3))*t*t + 1
+    case t < 2:
+        return ((a*t-5*a)*t+8*a)*t - 4*a
+    default:
+        return 0
+    }
+}
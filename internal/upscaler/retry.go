@@ -0,0 +1,257 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+    // outputTailLines is the number of process output lines kept for errors.
+    outputTailLines = 20
+    // maxRetryBackoff caps the doubling backoff between attempts.
+    maxRetryBackoff = 2 * time.Minute
+)
+
+// errTimedOut marks the error of an attempt that exceeded the job timeout.
+var errTimedOut = errors.New("timed out")
+
+// gpuInitFailures are output fragments of ncnn/Vulkan when no usable GPU could
+// be initialised. Such runs are repeated on the CPU.
+var gpuInitFailures = []string{
+    "vkcreateinstance failed",
+    "vkcreatedevice failed",
+    "vkenumeratephysicaldevices failed",
+    "invalid gpu device",
+    "no vulkan device",
+    "vk_error_initialization_failed",
+    "vk_error_incompatible_driver",
+    "failed to create gpu instance",
+}
+
+// RunError is returned by engines that run an external process. Output holds
+// the last lines the process printed, which usually explain the failure.
+type RunError struct {
+    Err    error
+    Output []string
+}
+
+// Error returns the error followed by the last line of output.
+func (e *RunError) Error() string {
+    if len(e.Output) == 0 {
+        return e.Err.Error()
+    }
+    return fmt.Sprintf("%v: %s", e.Err, e.Output[len(e.Output)-1])
+}
+
+// Unwrap returns the underlying error.
+func (e *RunError) Unwrap() error {
+    return e.Err
+}
+
+// outputTail keeps the last lines of process output.
+type outputTail struct {
+    lines []string
+}
+
+// add appends a line, dropping the oldest once the tail is full.
+func (t *outputTail) add(line string) {
+    if len(t.lines) == outputTailLines {
+        t.lines = t.lines[1:]
+    }
+    t.lines = append(t.lines, line)
+}
+
+// Attempt records a single run of a job.
+type Attempt struct {
+    Number     int       `json:"number"`
+    Device     string    `json:"device"`
+    // TileSize is the engine tile size used (0 = chosen by the engine). For
+    // pipelines it is that of the failed stage, or of the first upscale stage.
+    TileSize   int       `json:"tile_size,omitempty"`
+    StartedAt  time.Time `json:"started_at"`
+    FinishedAt time.Time `json:"finished_at"`
+    Error      string    `json:"error,omitempty"`
+}
+
+// isGPUInitFailure reports whether err is an engine run that failed because no
+// GPU could be initialised.
+func isGPUInitFailure(err error) bool {
+    var runErr *RunError
+    if !errors.As(err, &runErr) {
+        return false
+    }
+    for _, line := range runErr.Output {
+        line = strings.ToLower(line)
+        for _, fragment := range gpuInitFailures {
+            if strings.Contains(line, fragment) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// isTransient reports whether a failed attempt may succeed when repeated.
+// Unclassified engine failures and lost devices are transient; invalid
+// requests, unreadable inputs and missing models are not.
+func isTransient(err error) bool {
+    code := classifyError(err)
+    return code == ErrCodeEngineFailed || code == ErrCodeDeviceLost
+}
+
+// runAttempts runs a job's request, repeating transient failures with
+// exponential backoff, moving runs that cannot initialise the GPU to the CPU
+// and shrinking the engine tile size after out-of-memory failures. Every
+// attempt is recorded in the job.
+//
+// Each attempt gets the full job timeout rather than sharing one deadline with
+// the earlier attempts, so that retries are not starved by a slow first run.
+// Backoff waits do not count against it, and a zero timeout does not limit
+// the attempts. An attempt that exceeds the timeout
+// ends the job with an error wrapping errTimedOut; it is not retried.
+func (s *Service) runAttempts(ctx context.Context, job *Job, req Request, exec execution) (*Result, error) {
+    backoff := s.config.RetryBackoff
+    retries := 0
+    shrunk := make(map[string]bool)
+
+    s.jobsMu.Lock()
+    timeout := job.Timeout
+    s.jobsMu.Unlock()
+
+    // Start each model with the tile size learned from earlier out-of-memory
+    // failures, or the one its manifest recommends
+    exec.tileSizes = make(map[string]int)
+    for _, model := range requestModels(req) {
+        exec.tileSizes[model] = s.initialTileSize(req, exec.device, model)
+    }
+
+    for attempt := 1; ; attempt++ {
+        started := time.Now()
+        attemptCtx, cancel := attemptContext(ctx, timeout)
+        result, err := s.upscale(attemptCtx, req, exec)
+        timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+        cancel()
+        model, ranModel := failedModel(req, err)
+
+        record := Attempt{
+            Number:     attempt,
+            Device:     exec.device.Name,
+            TileSize:   exec.tileSizes[model],
+            StartedAt:  started,
+            FinishedAt: time.Now(),
+        }
+        if err != nil {
+            record.Error = err.Error()
+        }
+        s.jobsMu.Lock()
+        job.Attempts = append(job.Attempts, record)
+        s.jobsMu.Unlock()
+
+        if err == nil {
+            for model := range shrunk {
+                s.tileSizes.remember(exec.device.Name, model, exec.tileSizes[model])
+            }
+            return result, nil
+        }
+        if ctx.Err() != nil {
+            return nil, err
+        }
+        if timedOut {
+            return nil, fmt.Errorf("%w after %s: %w", errTimedOut, timeout, err)
+        }
+
+        switch {
+        case s.config.CPUFallback && exec.device.Kind == DeviceGPU && isGPUInitFailure(err):
+            // Repeating on the GPU would fail the same way
+            exec.device = s.cpuDevice()
+            log.Printf("Job %s: GPU initialisation failed, retrying on %s: %v", job.ID, exec.device.Name, err)
+
+            s.jobsMu.Lock()
+            job.Device = exec.device.Name
+            s.jobsMu.Unlock()
+        case ranModel && classifyError(err) == ErrCodeOutOfMemory && s.supportsTileSize(model):
+            size := exec.tileSizes[model]
+            next, ok := smallerTileSize(size)
+            if !ok {
+                return nil, err
+            }
+            log.Printf("Job %s: out of memory with tile size %d for %s, retrying with %d", job.ID, size, model, next)
+            exec.tileSizes[model] = next
+            shrunk[model] = true
+        case isTransient(err) && retries < s.config.MaxRetries:
+            retries++
+            log.Printf("Job %s: attempt %d failed, retrying in %s: %v", job.ID, attempt, backoff, err)
+
+            select {
+            case <-ctx.Done():
+                return nil, err
+            case <-time.After(backoff):
+            }
+            backoff = min(backoff*2, maxRetryBackoff)
+        default:
+            return nil, err
+        }
+    }
+}
+
+// attemptContext returns the context of an attempt, limited by the job
+// timeout if one is set.
+func attemptContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+    if timeout > 0 {
+        return context.WithTimeout(ctx, timeout)
+    }
+    return context.WithCancel(ctx)
+}
+
+// initialTileSize returns the tile size a model of a request starts with:
+// the requested one, the one learned on the device, or the recommended one.
+func (s *Service) initialTileSize(req Request, device Device, model string) int {
+    if req.TileSize != 0 {
+        return req.TileSize
+    }
+    if size, ok := s.tileSizes.get(device.Name, model); ok {
+        return size
+    }
+    return s.recommendedTileSize(model)
+}
+
+// failedModel returns the model a run was using when it failed with err: the
+// model of the failed upscale stage of a pipeline, or the request's model.
+// For a successful run it returns the first model the request runs. ok is
+// false if the error is not from running a model.
+func failedModel(req Request, err error) (model string, ok bool) {
+    if len(req.Pipeline) == 0 {
+        return req.ModelName, true
+    }
+    var stageErr *stageError
+    if errors.As(err, &stageErr) {
+        return stageErr.model, stageErr.model != ""
+    }
+    if models := requestModels(req); err == nil && len(models) > 0 {
+        return models[0], true
+    }
+    return "", false
+}
+
+// supportsTileSize reports whether the engine of a model honours Task.TileSize.
+func (s *Service) supportsTileSize(model string) bool {
+    engine, _, err := s.resolveEngine(model)
+    return err == nil && engine.Capabilities().TileSize
+}
+
+// cpuDevice returns the configured CPU device, or an ad-hoc one.
+func (s *Service) cpuDevice() Device {
+    for _, d := range s.devices {
+        if d.Kind == DeviceCPU {
+            return d
+        }
+    }
+    return Device{Name: "cpu", Kind: DeviceCPU, GPUID: -1}
+}
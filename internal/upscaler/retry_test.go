@@ -0,0 +1,287 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeTestImage writes a blank PNG image.
+func writeTestImage(t *testing.T, path string, w, h int) {
+    t.Helper()
+
+    f, err := os.Create(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// tileEngine serves the models "a" and "b" by resampling and runs out of
+// memory for tile sizes above the limit of a model (0 = chosen by the engine).
+type tileEngine struct {
+    Engine
+    limits map[string]int
+    // tiles are the tile sizes each model was run with.
+    tiles  map[string][]int
+}
+
+func (e *tileEngine) Name() string { return "tile" }
+
+func (e *tileEngine) Capabilities() Capabilities {
+    return Capabilities{GPU: true, TileSize: true}
+}
+
+func (e *tileEngine) Models() ([]ModelInfo, error) {
+    return []ModelInfo{{Name: "a"}, {Name: "b"}}, nil
+}
+
+func (e *tileEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    e.tiles[task.ModelName] = append(e.tiles[task.ModelName], task.TileSize)
+    if limit, ok := e.limits[task.ModelName]; ok && (task.TileSize == 0 || task.TileSize > limit) {
+        return &RunError{Err: errors.New("upscale failed: exit status 255"), Output: []string{"vkAllocateMemory failed -2"}}
+    }
+    task.ModelName = "resample-lanczos"
+    return e.Engine.Run(ctx, task, onProgress)
+}
+
+func TestRunAttemptsShrinksTileSizePerModel(t *testing.T) {
+    tests := []struct {
+        name    string
+        req     Request
+        limits  map[string]int
+        // known are tile sizes learned before the run.
+        known   map[string]int
+        tiles   map[string][]int
+        learned map[string]int
+    }{
+        {
+            name:    "model",
+            req:     Request{ModelName: "b", Scale: 2},
+            limits:  map[string]int{"b": 100},
+            tiles:   map[string][]int{"b": {0, 256, 128, 64}},
+            learned: map[string]int{"b": 64},
+        },
+        {
+            name: "pipeline stage",
+            req: Request{ModelName: "a", Pipeline: []PipelineStage{
+                {Type: StageUpscale, Scale: 2},
+                {Type: StageUpscale, Model: "b", Scale: 2},
+            }},
+            limits:  map[string]int{"b": 100},
+            tiles:   map[string][]int{"a": {0, 0, 0, 0}, "b": {0, 256, 128, 64}},
+            learned: map[string]int{"b": 64},
+        },
+        {
+            name: "learned for pipeline stage",
+            req: Request{ModelName: "a", Pipeline: []PipelineStage{
+                {Type: StageUpscale, Scale: 2},
+                {Type: StageUpscale, Model: "b", Scale: 2},
+            }},
+            limits:  map[string]int{"b": 100},
+            known:   map[string]int{"b": 64},
+            tiles:   map[string][]int{"a": {0}, "b": {64}},
+            learned: map[string]int{"b": 64},
+        },
+        {
+            name:    "requested tile size",
+            req:     Request{ModelName: "b", Scale: 2, TileSize: 80},
+            limits:  map[string]int{"b": 100},
+            tiles:   map[string][]int{"b": {80}},
+            learned: map[string]int{},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            s := NewService(Config{WorkDir: dir})
+            engine := &tileEngine{Engine: NewResampleEngine(), limits: tt.limits, tiles: make(map[string][]int)}
+            s.engines = nil
+            s.RegisterEngine(engine)
+
+            device := Device{Name: "gpu0", Kind: DeviceGPU}
+            for model, size := range tt.known {
+                s.tileSizes.remember(device.Name, model, size)
+            }
+
+            req := tt.req
+            req.InputPath = filepath.Join(dir, "in.png")
+            req.OutputPath = filepath.Join(dir, "out.png")
+            writeTestImage(t, req.InputPath, 40, 30)
+
+            if _, err := s.runAttempts(context.Background(), &Job{ID: "job"}, req, execution{device: device}); err != nil {
+                t.Fatalf("runAttempts() error = %v", err)
+            }
+
+            for model, want := range tt.tiles {
+                if got := engine.tiles[model]; !slices.Equal(got, want) {
+                    t.Errorf("tile sizes of %s = %v, want %v", model, got, want)
+                }
+            }
+            for _, model := range []string{"a", "b"} {
+                size, ok := s.tileSizes.get(device.Name, model)
+                if want, learned := tt.learned[model]; ok != learned || size != want {
+                    t.Errorf("learned tile size of %s = %d, %v, want %d, %v", model, size, ok, want, learned)
+                }
+            }
+        })
+    }
+}
+
+// delayEngine takes the given time for each run and fails the first runs with
+// an engine error.
+type delayEngine struct {
+    Engine
+    delay time.Duration
+    fails int
+    runs  int
+}
+
+func (e *delayEngine) Name() string { return "delay" }
+
+func (e *delayEngine) Models() ([]ModelInfo, error) {
+    return []ModelInfo{{Name: "delay"}}, nil
+}
+
+func (e *delayEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    e.runs++
+    select {
+    case <-ctx.Done():
+        return &RunError{Err: errors.New("upscale failed: signal: killed")}
+    case <-time.After(e.delay):
+    }
+    if e.runs <= e.fails {
+        return &RunError{Err: errors.New("upscale failed: exit status 1"), Output: []string{"Segmentation fault"}}
+    }
+    task.ModelName = "resample-lanczos"
+    return e.Engine.Run(ctx, task, onProgress)
+}
+
+func TestRunAttemptsTimeoutPerAttempt(t *testing.T) {
+    tests := []struct {
+        name     string
+        delay    time.Duration
+        fails    int
+        timedOut bool
+        attempts int
+    }{
+        // Together the attempts take longer than the timeout
+        {name: "retries within timeout", delay: 120 * time.Millisecond, fails: 2, attempts: 3},
+        {name: "attempt exceeds timeout", delay: time.Second, fails: 0, timedOut: true, attempts: 1},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            s := NewService(Config{WorkDir: dir, MaxRetries: 3, RetryBackoff: 50 * time.Millisecond})
+            engine := &delayEngine{Engine: NewResampleEngine(), delay: tt.delay, fails: tt.fails}
+            s.engines = nil
+            s.RegisterEngine(engine)
+
+            req := Request{ModelName: "delay", Scale: 2, InputPath: filepath.Join(dir, "in.png"), OutputPath: filepath.Join(dir, "out.png")}
+            writeTestImage(t, req.InputPath, 40, 30)
+
+            job := &Job{ID: "job", Timeout: 250 * time.Millisecond}
+            _, err := s.runAttempts(context.Background(), job, req, execution{device: s.cpuDevice()})
+            if got := errors.Is(err, errTimedOut); got != tt.timedOut || (err != nil && !tt.timedOut) {
+                t.Errorf("runAttempts() error = %v, want timed out %v", err, tt.timedOut)
+            }
+            if len(job.Attempts) != tt.attempts {
+                t.Errorf("attempts = %d, want %d", len(job.Attempts), tt.attempts)
+            }
+        })
+    }
+}
+
+// scriptEngine fails its first runs with the given process output, then
+// resamples. It records the device of every run.
+type scriptEngine struct {
+    Engine
+    failures [][]string
+    devices  []string
+}
+
+func (e *scriptEngine) Name() string { return "script" }
+
+func (e *scriptEngine) Capabilities() Capabilities {
+    return Capabilities{GPU: true}
+}
+
+func (e *scriptEngine) Models() ([]ModelInfo, error) {
+    return []ModelInfo{{Name: "script"}}, nil
+}
+
+func (e *scriptEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    e.devices = append(e.devices, task.Device.Name)
+    if run := len(e.devices); run <= len(e.failures) {
+        return &RunError{Err: errors.New("upscale failed: exit status 1"), Output: e.failures[run-1]}
+    }
+    task.ModelName = "resample-lanczos"
+    return e.Engine.Run(ctx, task, onProgress)
+}
+
+func TestRunAttemptsRetriesAndFallsBackToCPU(t *testing.T) {
+    gpuInit := []string{"vkCreateInstance failed -9"}
+    crash := []string{"Segmentation fault"}
+
+    tests := []struct {
+        name        string
+        cpuFallback bool
+        maxRetries  int
+        failures    [][]string
+        devices     []string
+        wantCode    ErrorCode
+    }{
+        {name: "gpu init failure falls back to cpu", cpuFallback: true, failures: [][]string{gpuInit}, devices: []string{"gpu0", "cpu"}},
+        {name: "gpu init failure without fallback", failures: [][]string{gpuInit}, devices: []string{"gpu0"}, wantCode: ErrCodeVulkanUnavailable},
+        {name: "transient failures are retried", maxRetries: 2, failures: [][]string{crash, crash}, devices: []string{"gpu0", "gpu0", "gpu0"}},
+        {name: "retries exhausted", maxRetries: 1, failures: [][]string{crash, crash, crash}, devices: []string{"gpu0", "gpu0"}, wantCode: ErrCodeEngineFailed},
+        {name: "retried on cpu after fallback", cpuFallback: true, maxRetries: 1, failures: [][]string{gpuInit, crash}, devices: []string{"gpu0", "cpu", "cpu"}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            s := NewService(Config{WorkDir: dir, CPUFallback: tt.cpuFallback, MaxRetries: tt.maxRetries, RetryBackoff: time.Millisecond})
+            engine := &scriptEngine{Engine: NewResampleEngine(), failures: tt.failures}
+            s.engines = nil
+            s.RegisterEngine(engine)
+
+            req := Request{ModelName: "script", Scale: 2, InputPath: filepath.Join(dir, "in.png"), OutputPath: filepath.Join(dir, "out.png")}
+            writeTestImage(t, req.InputPath, 40, 30)
+
+            job := &Job{ID: "job", Device: "gpu0"}
+            _, err := s.runAttempts(context.Background(), job, req, execution{device: Device{Name: "gpu0", Kind: DeviceGPU}})
+            if code := classifyError(err); code != tt.wantCode {
+                t.Fatalf("runAttempts() error = %v (%s), want %q", err, code, tt.wantCode)
+            }
+
+            if !slices.Equal(engine.devices, tt.devices) {
+                t.Errorf("runs on %v, want %v", engine.devices, tt.devices)
+            }
+            var attempts []string
+            for _, a := range job.Attempts {
+                attempts = append(attempts, a.Device)
+            }
+            if !slices.Equal(attempts, tt.devices) {
+                t.Errorf("attempts on %v, want %v", attempts, tt.devices)
+            }
+            if want := tt.devices[len(tt.devices)-1]; job.Device != want {
+                t.Errorf("job device = %s, want %s", job.Device, want)
+            }
+        })
+    }
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// ErrShuttingDown is returned by SubmitJob once Shutdown has been called.
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// errShutdown is the cause of the cancellation of jobs interrupted by Shutdown.
+var errShutdown = errors.New("interrupted by shutdown")
+
+// Shutdown stops accepting jobs and waits until the running jobs have finished
+// or ctx is done. Jobs still running then are interrupted and keep their
+// checkpoints. Interrupted and queued jobs are persisted so that ResumeJobs
+// picks them up on the next start. It returns ctx.Err() if jobs had to be
+// interrupted.
+func (s *Service) Shutdown(ctx context.Context) error {
+    s.jobsMu.Lock()
+    s.shuttingDown = true
+    s.jobsMu.Unlock()
+
+    // Workers exit once their current job is done
+    queued := s.queue.close()
+    for _, job := range queued {
+        if err := s.persistQueued(job); err != nil {
+            log.Printf("Failed to persist queued job %s: %v", job.ID, err)
+        }
+    }
+    if len(queued) > 0 {
+        log.Printf("Persisted %d queued job(s) for the next start", len(queued))
+    }
+
+    done := make(chan struct{})
+    go func() {
+        s.running.Wait()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+    }
+
+    log.Printf("Drain period over, interrupting running jobs")
+    s.interrupt(errShutdown)
+    <-done
+    return ctx.Err()
+}
+
+// persistQueued writes the manifest of a job that never started, so stores that
+// do not survive a restart can still resume it.
+func (s *Service) persistQueued(job *Job) error {
+    dir := s.jobDir(job.ID)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return fmt.Errorf("failed to create job dir: %w", err)
+    }
+
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    return writeManifest(dir, job)
+}
+
+// interrupted reports whether a job context was cancelled by Shutdown.
+func interrupted(ctx context.Context) bool {
+    return errors.Is(context.Cause(ctx), errShutdown)
+}
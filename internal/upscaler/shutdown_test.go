@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForStatus polls a job until it reaches status.
+func waitForStatus(t *testing.T, s *Service, id, status string) {
+    t.Helper()
+
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        if job, ok := s.GetJob(id); ok && job.Status == status {
+            return
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    t.Fatalf("job %s did not reach %s", id, status)
+}
+
+func TestShutdownDrainsAndPersistsQueue(t *testing.T) {
+    tests := []struct {
+        name    string
+        delay   time.Duration
+        drain   time.Duration
+        wantErr error
+        // running is the status of the running job after Shutdown.
+        running string
+        resumed int
+    }{
+        {name: "drained", delay: 200 * time.Millisecond, drain: 5 * time.Second, running: "completed", resumed: 1},
+        {name: "interrupted", delay: 10 * time.Second, drain: 100 * time.Millisecond, wantErr: context.DeadlineExceeded, running: "processing", resumed: 2},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            work := filepath.Join(dir, "work")
+            newService := func() *Service {
+                s := NewService(Config{WorkDir: work})
+                s.engines = nil
+                s.RegisterEngine(&delayEngine{Engine: NewResampleEngine(), delay: tt.delay})
+                return s
+            }
+
+            s := newService()
+            s.StartWorkers(1)
+            submit := func(name string) string {
+                req := Request{ModelName: "delay", Scale: 2, InputPath: filepath.Join(dir, "in.png"), OutputPath: filepath.Join(dir, name)}
+                id, err := s.SubmitJob(req)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                return id
+            }
+            writeTestImage(t, filepath.Join(dir, "in.png"), 40, 30)
+
+            running := submit("running.png")
+            waitForStatus(t, s, running, "processing")
+            queued := submit("queued.png")
+
+            ctx, cancel := context.WithTimeout(context.Background(), tt.drain)
+            defer cancel()
+            if err := s.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+                t.Fatalf("Shutdown() error = %v, want %v", err, tt.wantErr)
+            }
+
+            if job, _ := s.GetJob(running); job.Status != tt.running {
+                t.Errorf("running job status = %s, want %s", job.Status, tt.running)
+            }
+            if job, _ := s.GetJob(queued); job.Status != "queued" {
+                t.Errorf("queued job status = %s, want queued", job.Status)
+            }
+            if _, err := s.SubmitJob(Request{ModelName: "delay", Scale: 2}); !errors.Is(err, ErrShuttingDown) {
+                t.Errorf("SubmitJob() after Shutdown error = %v, want ErrShuttingDown", err)
+            }
+
+            // A memory store forgets the jobs, the manifests bring them back
+            next := newService()
+            if n, err := next.ResumeJobs(); err != nil || n != tt.resumed {
+                t.Fatalf("ResumeJobs() = %d, %v, want %d", n, err, tt.resumed)
+            }
+            if job, ok := next.GetJob(queued); !ok || job.Status != "queued" || job.Resumed {
+                t.Errorf("queued job after restart = %+v, %v", job, ok)
+            }
+            job, ok := next.GetJob(running)
+            if interrupted := tt.running == "processing"; ok != interrupted || (ok && !job.Resumed) {
+                t.Errorf("running job after restart = %+v, %v, want resumed %v", job, ok, interrupted)
+            }
+        })
+    }
+}
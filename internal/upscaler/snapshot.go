@@ -0,0 +1,119 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// snapshotEngine runs a model that was removed from the models directory
+// from the snapshot taken when its jobs were queued.
+type snapshotEngine struct {
+    Engine
+    dir string
+}
+
+// Run runs the task with the model files of the snapshot.
+func (e *snapshotEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    task.ModelDir = e.dir
+    return e.Engine.Run(ctx, task, onProgress)
+}
+
+// snapshotRoot returns the directory holding the model snapshots.
+func (s *Service) snapshotRoot() string {
+    return filepath.Join(s.config.WorkDir, "models")
+}
+
+// snapshotModels links the files of the models the requests run into the work
+// directory, so that their jobs can still run them after they have been
+// removed from the models directory. Each model is snapshotted once. The jobs
+// must already be queued, which pins their models; the caller must not hold
+// jobsMu.
+func (s *Service) snapshotModels(reqs ...Request) {
+    s.snapshotMu.Lock()
+    defer s.snapshotMu.Unlock()
+
+    c := s.catalogue()
+    seen := make(map[string]bool)
+    for _, req := range reqs {
+        for _, model := range requestModels(req) {
+            if seen[model] {
+                continue
+            }
+            seen[model] = true
+
+            m, ok := c.lookup(model)
+            if !ok || m.retired || len(m.info.files) == 0 {
+                continue
+            }
+            if err := snapshotFiles(filepath.Join(s.snapshotRoot(), model), m.info.files); err != nil {
+                log.Printf("Failed to snapshot model %s: %v", model, err)
+            }
+        }
+    }
+}
+
+// releaseSnapshots removes the snapshots of all models that are not pinned.
+// The caller must hold snapshotMu.
+func (s *Service) releaseSnapshots(pinned map[string]bool) {
+    entries, err := os.ReadDir(s.snapshotRoot())
+    if err != nil {
+        return
+    }
+    for _, entry := range entries {
+        if !pinned[entry.Name()] {
+            _ = os.RemoveAll(filepath.Join(s.snapshotRoot(), entry.Name()))
+        }
+    }
+}
+
+// snapshotEngineFor returns the engine running a retired model from its
+// snapshot.
+func (s *Service) snapshotEngineFor(m catalogueModel) (Engine, error) {
+    dir := filepath.Join(s.snapshotRoot(), m.info.Name)
+    if _, err := os.Stat(dir); err != nil {
+        return nil, fmt.Errorf("%w: %s: removed without a snapshot", ErrModelUnavailable, m.info.Name)
+    }
+    return &snapshotEngine{Engine: m.engine, dir: dir}, nil
+}
+
+// snapshotFiles hard-links files into dir, copying them if linking fails
+// (e.g. across file systems). Files already in the snapshot are kept unless
+// the source has changed; missing files are skipped.
+func snapshotFiles(dir string, files []string) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+
+    for _, src := range files {
+        fi, err := os.Stat(src)
+        if err != nil {
+            continue
+        }
+        dst := filepath.Join(dir, filepath.Base(src))
+        if dfi, err := os.Stat(dst); err == nil {
+            if os.SameFile(fi, dfi) || (dfi.Size() == fi.Size() && dfi.ModTime().Equal(fi.ModTime())) {
+                continue
+            }
+            if err := os.Remove(dst); err != nil {
+                return err
+            }
+        }
+
+        if err := os.Link(src, dst); err == nil {
+            continue
+        }
+        if err := copyFile(src, dst); err != nil {
+            return err
+        }
+        if err := os.Chtimes(dst, fi.ModTime(), fi.ModTime()); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,394 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+    // throughputFile holds the throughput statistics in the work directory.
+    throughputFile = "throughput.json"
+    // statsSmoothing is the weight of a new sample in the moving averages.
+    statsSmoothing = 0.2
+)
+
+// defaultBytesPerPixel is the assumed output file size per pixel of a format
+// until completed jobs have been measured.
+var defaultBytesPerPixel = map[string]float64{
+    "png":  1.2,
+    "jpg":  0.25,
+    "webp": 0.15,
+}
+
+// rate is an exponentially weighted moving average.
+type rate struct {
+    Value   float64 `json:"value"`
+    Samples int     `json:"samples"`
+}
+
+// add records a sample.
+func (r *rate) add(v float64) {
+    if r.Samples == 0 {
+        r.Value = v
+    } else {
+        r.Value += statsSmoothing * (v - r.Value)
+    }
+    r.Samples++
+}
+
+// throughputStats records how fast completed jobs ran and how large their
+// output files were, and persists both in the work directory.
+type throughputStats struct {
+    mu     sync.Mutex
+    // saveMu serialises writes of the file.
+    saveMu sync.Mutex
+    path   string
+    // Speed holds input pixels per second by model, native scale and device.
+    Speed map[string]*rate `json:"pixels_per_second"`
+    // Size holds output bytes per pixel by format.
+    Size  map[string]*rate `json:"bytes_per_pixel"`
+}
+
+// loadThroughputStats reads the statistics stored at path. Missing or broken
+// files start empty.
+func loadThroughputStats(path string) *throughputStats {
+    stats := &throughputStats{
+        path:  path,
+        Speed: make(map[string]*rate),
+        Size:  make(map[string]*rate),
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return stats
+    }
+    if err := json.Unmarshal(data, stats); err != nil {
+        log.Printf("Ignoring invalid throughput stats in %s: %v", path, err)
+        stats.Speed = make(map[string]*rate)
+        stats.Size = make(map[string]*rate)
+    }
+    if stats.Speed == nil {
+        stats.Speed = make(map[string]*rate)
+    }
+    if stats.Size == nil {
+        stats.Size = make(map[string]*rate)
+    }
+    return stats
+}
+
+// speedKey identifies a throughput measurement.
+func speedKey(model string, scale int, device string) string {
+    return fmt.Sprintf("%s/x%d/%s", model, scale, device)
+}
+
+// record adds the measurements of a completed job and reports whether it
+// changed the statistics. It does not save them, see save.
+func (t *throughputStats) record(model string, scale int, device string, result *Result, format string) bool {
+    if result.Duration <= 0 {
+        return false
+    }
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    pixels := float64(result.InputSize.Width) * float64(result.InputSize.Height)
+    key := speedKey(model, scale, device)
+    if t.Speed[key] == nil {
+        t.Speed[key] = &rate{}
+    }
+    t.Speed[key].add(pixels / result.Duration.Seconds())
+
+    outPixels := float64(result.OutputSize.Width) * float64(result.OutputSize.Height)
+    if outPixels > 0 && result.FileSizeBytes > 0 {
+        if t.Size[format] == nil {
+            t.Size[format] = &rate{}
+        }
+        t.Size[format].add(float64(result.FileSizeBytes) / outPixels)
+    }
+    return true
+}
+
+// save writes the statistics to the work directory. Only the copy is taken
+// under mu, so recording and estimates do not wait for the disk.
+func (t *throughputStats) save() {
+    t.saveMu.Lock()
+    defer t.saveMu.Unlock()
+
+    t.mu.Lock()
+    data, err := json.Marshal(t)
+    t.mu.Unlock()
+    if err != nil {
+        log.Printf("Failed to save throughput stats: %v", err)
+        return
+    }
+
+    if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+        log.Printf("Failed to save throughput stats: %v", err)
+        return
+    }
+    if err := writeJSONAtomic(t.path, json.RawMessage(data)); err != nil {
+        log.Printf("Failed to save throughput stats: %v", err)
+    }
+}
+
+// speed returns the average throughput in input pixels per second of a model
+// at a native scale over the given devices.
+func (t *throughputStats) speed(model string, scale int, devices []Device) (float64, bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    sum, n := 0.0, 0
+    for _, d := range devices {
+        if r := t.Speed[speedKey(model, scale, d.Name)]; r != nil && r.Value > 0 {
+            sum += r.Value
+            n++
+        }
+    }
+    if n == 0 {
+        return 0, false
+    }
+    return sum / float64(n), true
+}
+
+// bytesPerPixel returns the expected output file size per pixel of a format.
+func (t *throughputStats) bytesPerPixel(format string) float64 {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if r := t.Size[format]; r != nil && r.Value > 0 {
+        return r.Value
+    }
+    return defaultBytesPerPixel[format]
+}
+
+// Estimate is the predicted outcome of a request.
+type Estimate struct {
+    Plan          Plan
+    FileSizeBytes int64
+    // Duration is the predicted processing time. DurationKnown is false if
+    // there is no data yet for the model, scale and device.
+    Duration      time.Duration
+    DurationKnown bool
+    // StartIn is the predicted wait before a worker is free for a new job.
+    StartIn       time.Duration
+    StartKnown    bool
+}
+
+// Estimate predicts the duration and output file size of a request for an
+// input of the given size, without needing the input file.
+func (s *Service) Estimate(req Request, input ImageSize) (*Estimate, error) {
+    if input.Width <= 0 || input.Height <= 0 {
+        return nil, fmt.Errorf("invalid input size: %dx%d", input.Width, input.Height)
+    }
+    if len(req.Pipeline) > 0 {
+        if err := s.validatePipeline(req); err != nil {
+            return nil, err
+        }
+    } else if err := validateScale(req); err != nil {
+        return nil, err
+    }
+    if err := s.validateDevice(req.Device); err != nil {
+        return nil, err
+    }
+    if err := s.validateModelScales(req); err != nil {
+        return nil, err
+    }
+
+    plan, err := s.planJob(input, req)
+    if err != nil {
+        return nil, err
+    }
+
+    format, _ := outputOptions(req)
+    if plan.ResizeTo != nil && !canEncode(format) {
+        return nil, fmt.Errorf("%s output cannot be combined with resizing, use png or jpg", format)
+    }
+    pixels := float64(plan.OutputSize.Width) * float64(plan.OutputSize.Height)
+    est := &Estimate{
+        Plan:          plan,
+        FileSizeBytes: int64(pixels * s.stats.bytesPerPixel(format)),
+    }
+
+    est.Duration, est.DurationKnown = s.predict(plan, input, s.matchingDevices(req.Device))
+
+    s.jobsMu.Lock()
+    est.StartIn, est.StartKnown = s.waitFor(nil)
+    s.jobsMu.Unlock()
+
+    return est, nil
+}
+
+// EstimateJob predicts when a queued job starts and when a queued or running
+// job finishes. ok is false if there is not enough data for a prediction.
+func (s *Service) EstimateJob(jobID string) (start, finish time.Time, ok bool) {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    job, ok := s.store.Get(jobID)
+    if !ok {
+        return time.Time{}, time.Time{}, false
+    }
+
+    now := time.Now()
+    switch job.Status {
+    case "processing":
+        remaining, ok := s.remaining(job, now)
+        if !ok {
+            return time.Time{}, time.Time{}, false
+        }
+        return job.StartedAt, now.Add(remaining), true
+    case "queued":
+        wait, ok := s.waitFor(job)
+        if !ok {
+            return time.Time{}, time.Time{}, false
+        }
+        duration, ok := s.predictJob(job)
+        if !ok {
+            return time.Time{}, time.Time{}, false
+        }
+        return now.Add(wait), now.Add(wait + duration), true
+    default:
+        return time.Time{}, time.Time{}, false
+    }
+}
+
+// waitFor simulates the workers to predict how long a queued job (or, with a
+// nil job, a newly submitted one) waits before it starts. Device affinity is
+// ignored. The caller must hold jobsMu.
+func (s *Service) waitFor(job *Job) (time.Duration, bool) {
+    now := time.Now()
+
+    // Time until each worker is free
+    free := make([]time.Duration, 0, s.workerCount())
+    for _, j := range s.store.List() {
+        if j.Status != "processing" {
+            continue
+        }
+        remaining, ok := s.remaining(j, now)
+        if !ok {
+            return 0, false
+        }
+        free = append(free, remaining)
+    }
+    for len(free) < s.workerCount() {
+        free = append(free, 0)
+    }
+
+    earliest := func() int {
+        best := 0
+        for i := range free {
+            if free[i] < free[best] {
+                best = i
+            }
+        }
+        return best
+    }
+
+    for _, ahead := range s.queue.ordered() {
+        if ahead == job {
+            break
+        }
+        duration, ok := s.predictJob(ahead)
+        if !ok {
+            return 0, false
+        }
+        free[earliest()] += duration
+    }
+
+    return free[earliest()], true
+}
+
+// remaining predicts the remaining time of a running job, extrapolating from
+// its progress once that is meaningful. The caller must hold jobsMu.
+func (s *Service) remaining(job *Job, now time.Time) (time.Duration, bool) {
+    elapsed := now.Sub(job.StartedAt)
+    if job.Progress >= 10 && job.Progress < 100 {
+        total := time.Duration(float64(elapsed) * 100 / float64(job.Progress))
+        return total - elapsed, true
+    }
+
+    duration, ok := s.predictJob(job)
+    if !ok {
+        return 0, false
+    }
+    return max(duration-elapsed, 0), true
+}
+
+// predictJob predicts the processing time of a job. The caller must hold jobsMu.
+func (s *Service) predictJob(job *Job) (time.Duration, bool) {
+    if job.InputSize.Width == 0 || job.InputSize.Height == 0 {
+        return 0, false
+    }
+
+    plan := job.Plan
+    if plan == nil {
+        p, err := s.planJob(job.InputSize, job.Request)
+        if err != nil {
+            return 0, false
+        }
+        plan = &p
+    }
+
+    devices := s.matchingDevices(job.Request.Device)
+    if job.Device != "" {
+        devices = s.matchingDevices(job.Device)
+    }
+    return s.predict(*plan, job.InputSize, devices)
+}
+
+// predict returns the expected duration of a plan on the given devices. A plan
+// without passes (pure resize) is treated as instantaneous.
+func (s *Service) predict(plan Plan, input ImageSize, devices []Device) (time.Duration, bool) {
+    if len(plan.Passes) == 0 {
+        return 0, true
+    }
+
+    scale := 1
+    for _, p := range plan.Passes {
+        scale *= p.Scale
+    }
+
+    speed, ok := s.stats.speed(plan.Passes[0].Model, scale, devices)
+    if !ok {
+        return 0, false
+    }
+
+    pixels := float64(input.Width) * float64(input.Height)
+    return time.Duration(pixels / speed * float64(time.Second)), true
+}
+
+// recordThroughput adds a completed job to the throughput statistics and
+// reports whether they changed and need saving. Pipelines are skipped, they
+// spend part of their time outside the model. It reads only what the job's
+// worker sets, so it may be called by the worker without jobsMu.
+func (s *Service) recordThroughput(job *Job, result *Result) bool {
+    if len(result.Plan.Passes) == 0 || len(job.Request.Pipeline) > 0 {
+        return false
+    }
+
+    scale := 1
+    for _, p := range result.Plan.Passes {
+        scale *= p.Scale
+    }
+    format := outputFormat(result.OutputPath, job.Request.Format)
+    return s.stats.record(result.Plan.Passes[0].Model, scale, job.Device, result, format)
+}
+
+// matchingDevices returns the devices that satisfy a device preference.
+func (s *Service) matchingDevices(pref string) []Device {
+    devices := make([]Device, 0, len(s.devices))
+    for _, d := range s.devices {
+        if d.Matches(pref) {
+            devices = append(devices, d)
+        }
+    }
+    return devices
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestThroughputStatsSave(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "work", throughputFile)
+    stats := loadThroughputStats(path)
+
+    result := &Result{
+        Duration:      2 * time.Second,
+        InputSize:     ImageSize{Width: 100, Height: 100},
+        OutputSize:    ImageSize{Width: 400, Height: 400},
+        FileSizeBytes: 32000,
+    }
+    if !stats.record("m", 4, "gpu0", result, "png") {
+        t.Fatal("record() = false, want true")
+    }
+    if stats.record("m", 4, "gpu0", &Result{}, "png") {
+        t.Error("record() of a job without duration = true, want false")
+    }
+
+    // Recording does not touch the disk
+    if _, err := os.Stat(path); !os.IsNotExist(err) {
+        t.Fatalf("stats saved by record: %v", err)
+    }
+
+    stats.save()
+    loaded := loadThroughputStats(path)
+    if got, ok := loaded.speed("m", 4, []Device{{Name: "gpu0"}}); !ok || got != 5000 {
+        t.Errorf("speed = %v, %v, want 5000", got, ok)
+    }
+    if got := loaded.bytesPerPixel("png"); got != 0.2 {
+        t.Errorf("bytes per pixel = %v, want 0.2", got)
+    }
+}
@@ -0,0 +1,617 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+    // maxTombstones is the number of tombstones a store keeps; older ones are dropped.
+    maxTombstones = 10000
+    // journalCompactSize is the smallest journal size that triggers a
+    // compaction while the service runs.
+    journalCompactSize = 4 << 20
+)
+
+// Tombstone is what remains of a job after it was evicted from the history.
+type Tombstone struct {
+    ID         string    `json:"job_id"`
+    // BatchID is set for the jobs of a batch.
+    BatchID    string    `json:"batch_id,omitempty"`
+    Status     string    `json:"status"`
+    FinishedAt time.Time `json:"finished_at"`
+    ExpiredAt  time.Time `json:"expired_at"`
+}
+
+// JobStore keeps the jobs of a service. Put is called on submission and on
+// every state transition while the service holds its job lock, so stores may
+// read the job without further synchronisation but should not wait for the
+// disk there.
+type JobStore interface {
+    // Get returns the job with the given ID.
+    Get(id string) (*Job, bool)
+    // Put inserts or updates a job.
+    Put(job *Job) error
+    // List returns all jobs.
+    List() []*Job
+    // Delete removes a job and keeps a tombstone for its ID.
+    Delete(id string) error
+    // Tombstone returns the tombstone of a deleted job.
+    Tombstone(id string) (Tombstone, bool)
+    // BatchTombstones returns the tombstones of the deleted jobs of a batch.
+    BatchTombstones(batchID string) []Tombstone
+    // Close releases the resources held by the store.
+    Close() error
+}
+
+// memoryStore keeps jobs in a map; they are lost when the process stops.
+type memoryStore struct {
+    mu         sync.RWMutex
+    jobs       map[string]*Job
+    tombstones map[string]Tombstone
+    // buried holds the tombstoned IDs in deletion order.
+    buried     []string
+}
+
+// NewMemoryStore creates a store that keeps jobs in memory only.
+func NewMemoryStore() JobStore {
+    m := newMemoryStore(0)
+    return &m
+}
+
+// newMemoryStore creates an empty memory store.
+func newMemoryStore(size int) memoryStore {
+    return memoryStore{
+        jobs:       make(map[string]*Job, size),
+        tombstones: make(map[string]Tombstone),
+    }
+}
+
+// Get returns the job with the given ID.
+func (m *memoryStore) Get(id string) (*Job, bool) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    job, ok := m.jobs[id]
+    return job, ok
+}
+
+// Put inserts or updates a job.
+func (m *memoryStore) Put(job *Job) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.jobs[job.ID] = job
+    return nil
+}
+
+// List returns all jobs.
+func (m *memoryStore) List() []*Job {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    jobs := make([]*Job, 0, len(m.jobs))
+    for _, job := range m.jobs {
+        jobs = append(jobs, job)
+    }
+    return jobs
+}
+
+// Delete removes a job and keeps a tombstone for its ID.
+func (m *memoryStore) Delete(id string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    m.delete(id, time.Now())
+    return nil
+}
+
+// delete replaces a job by its tombstone. The caller must hold mu.
+func (m *memoryStore) delete(id string, now time.Time) (Tombstone, bool) {
+    job, ok := m.jobs[id]
+    if !ok {
+        return Tombstone{}, false
+    }
+    delete(m.jobs, id)
+
+    t := Tombstone{ID: id, BatchID: job.Request.BatchID, Status: job.Status, FinishedAt: job.FinishedAt, ExpiredAt: now}
+    m.bury(t)
+    return t, true
+}
+
+// bury adds a tombstone and drops the oldest ones above maxTombstones. The
+// caller must hold mu.
+func (m *memoryStore) bury(t Tombstone) {
+    if _, ok := m.tombstones[t.ID]; !ok {
+        m.buried = append(m.buried, t.ID)
+    }
+    m.tombstones[t.ID] = t
+
+    for len(m.buried) > maxTombstones {
+        delete(m.tombstones, m.buried[0])
+        m.buried = m.buried[1:]
+    }
+}
+
+// Tombstone returns the tombstone of a deleted job.
+func (m *memoryStore) Tombstone(id string) (Tombstone, bool) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    t, ok := m.tombstones[id]
+    return t, ok
+}
+
+// BatchTombstones returns the tombstones of the deleted jobs of a batch in
+// deletion order.
+func (m *memoryStore) BatchTombstones(batchID string) []Tombstone {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+
+    var tombstones []Tombstone
+    for _, id := range m.buried {
+        if t := m.tombstones[id]; t.BatchID == batchID {
+            tombstones = append(tombstones, t)
+        }
+    }
+    return tombstones
+}
+
+// Close does nothing for the memory store.
+func (m *memoryStore) Close() error {
+    return nil
+}
+
+// jobRecord is the serialised form of a job in the journal.
+type jobRecord struct {
+    ID            string          `json:"id"`
+    Request       Request         `json:"request"`
+    Status        string          `json:"status"`
+    Progress      int             `json:"progress"`
+    StartTime     time.Time       `json:"start_time"`
+    StartedAt     time.Time       `json:"started_at"`
+    FinishedAt    time.Time       `json:"finished_at"`
+    // ExpiredAt is set for tombstones of jobs evicted from the history.
+    ExpiredAt     time.Time       `json:"expired_at"`
+    InputSize     ImageSize       `json:"input_size"`
+    Result        *Result         `json:"result,omitempty"`
+    Error         string          `json:"error,omitempty"`
+    TilesDone     int             `json:"tiles_done,omitempty"`
+    TilesTotal    int             `json:"tiles_total,omitempty"`
+    Resumed       bool            `json:"resumed,omitempty"`
+    ResumedTiles  int             `json:"resumed_tiles,omitempty"`
+    Plan          *Plan           `json:"plan,omitempty"`
+    Device        string          `json:"device,omitempty"`
+    Stage         string          `json:"stage,omitempty"`
+    Pipeline      []StageProgress `json:"pipeline,omitempty"`
+    Timeout       time.Duration   `json:"timeout,omitempty"`
+    Attempts      []Attempt       `json:"attempts,omitempty"`
+    ErrorCode     ErrorCode       `json:"error_code,omitempty"`
+    DownloadToken string          `json:"download_token,omitempty"`
+}
+
+// newJobRecord captures the persistent state of a job.
+func newJobRecord(job *Job) jobRecord {
+    rec := jobRecord{
+        ID:            job.ID,
+        Request:       job.Request,
+        Status:        job.Status,
+        Progress:      job.Progress,
+        StartTime:     job.StartTime,
+        StartedAt:     job.StartedAt,
+        FinishedAt:    job.FinishedAt,
+        InputSize:     job.InputSize,
+        Result:        job.Result,
+        TilesDone:     job.TilesDone,
+        TilesTotal:    job.TilesTotal,
+        Resumed:       job.Resumed,
+        ResumedTiles:  job.ResumedTiles,
+        Plan:          job.Plan,
+        Device:        job.Device,
+        Stage:         job.Stage,
+        Pipeline:      job.Pipeline,
+        Timeout:       job.Timeout,
+        Attempts:      job.Attempts,
+        ErrorCode:     job.ErrorCode,
+        DownloadToken: job.DownloadToken,
+    }
+    if job.Error != nil {
+        rec.Error = job.Error.Error()
+    }
+    return rec
+}
+
+// job restores a job from its record.
+func (r jobRecord) job() *Job {
+    job := &Job{
+        ID:            r.ID,
+        Request:       r.Request,
+        Status:        r.Status,
+        Progress:      r.Progress,
+        StartTime:     r.StartTime,
+        StartedAt:     r.StartedAt,
+        FinishedAt:    r.FinishedAt,
+        InputSize:     r.InputSize,
+        Result:        r.Result,
+        TilesDone:     r.TilesDone,
+        TilesTotal:    r.TilesTotal,
+        Resumed:       r.Resumed,
+        ResumedTiles:  r.ResumedTiles,
+        Plan:          r.Plan,
+        Device:        r.Device,
+        Stage:         r.Stage,
+        Pipeline:      r.Pipeline,
+        Timeout:       r.Timeout,
+        Attempts:      r.Attempts,
+        ErrorCode:     r.ErrorCode,
+        DownloadToken: r.DownloadToken,
+    }
+    if r.Error != "" {
+        job.Error = errors.New(r.Error)
+    }
+    return job
+}
+
+// tombstoneRecord is the journal entry of a deleted job.
+func tombstoneRecord(t Tombstone) jobRecord {
+    return jobRecord{
+        ID:         t.ID,
+        Request:    Request{BatchID: t.BatchID},
+        Status:     t.Status,
+        FinishedAt: t.FinishedAt,
+        ExpiredAt:  t.ExpiredAt,
+    }
+}
+
+// journalStore keeps jobs in memory and appends every update as a JSON line to
+// a journal file. The journal is replayed and compacted when it is opened, and
+// compacted again whenever it has doubled in size while the service runs.
+//
+// Put and Delete only queue the records, they are called under the service's
+// job lock. A writer goroutine appends the queued records in batches with a
+// single sync each, so a crash loses at most the transitions of the last
+// batch; those jobs are resumed from their earlier state.
+type journalStore struct {
+    memoryStore
+    path    string
+    // records holds the latest serialised record of every job and tombstone
+    // for compaction, order their IDs in submission order and pending the
+    // records not yet written. They are guarded by mu.
+    records map[string][]byte
+    order   []string
+    pending [][]byte
+
+    // file, size and compactAt, the size that triggers the next compaction,
+    // belong to the writer goroutine. compactAt is at least compactSize.
+    file        *os.File
+    size        int64
+    compactAt   int64
+    compactSize int64
+
+    wake      chan struct{}
+    done      chan struct{}
+    stopped   chan struct{}
+    closeOnce sync.Once
+    closeErr  error
+}
+
+// NewJournalStore opens (or creates) the journal at path and loads its jobs.
+func NewJournalStore(path string) (JobStore, error) {
+    return openJournal(path, journalCompactSize)
+}
+
+// openJournal opens the journal at path, compacting it while running once it
+// has reached compactSize and doubled since the last compaction.
+func openJournal(path string, compactSize int64) (*journalStore, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return nil, fmt.Errorf("failed to create journal dir: %w", err)
+    }
+
+    records, err := readJournal(path)
+    if err != nil {
+        return nil, err
+    }
+
+    store := &journalStore{
+        memoryStore: newMemoryStore(len(records)),
+        path:        path,
+        records:     make(map[string][]byte, len(records)),
+        compactSize: compactSize,
+        wake:        make(chan struct{}, 1),
+        done:        make(chan struct{}),
+        stopped:     make(chan struct{}),
+    }
+    for _, rec := range records {
+        if !rec.ExpiredAt.IsZero() {
+            store.bury(Tombstone{
+                ID:         rec.ID,
+                BatchID:    rec.Request.BatchID,
+                Status:     rec.Status,
+                FinishedAt: rec.FinishedAt,
+                ExpiredAt:  rec.ExpiredAt,
+            })
+        } else {
+            store.jobs[rec.ID] = rec.job()
+        }
+
+        data, err := json.Marshal(rec)
+        if err != nil {
+            return nil, err
+        }
+        store.records[rec.ID] = data
+        store.order = append(store.order, rec.ID)
+    }
+
+    // Compact: keep only the latest record of every job and the tombstones
+    // that were not dropped
+    if err := store.compact(); err != nil {
+        return nil, err
+    }
+
+    go store.run()
+    return store, nil
+}
+
+// Put updates the in-memory copy of the job and queues its state for the
+// journal.
+func (j *journalStore) Put(job *Job) error {
+    data, err := json.Marshal(newJobRecord(job))
+    if err != nil {
+        return err
+    }
+
+    j.mu.Lock()
+    defer j.mu.Unlock()
+
+    j.jobs[job.ID] = job
+    j.record(job.ID, data)
+    return nil
+}
+
+// Delete replaces a job by its tombstone and queues the deletion for the journal.
+func (j *journalStore) Delete(id string) error {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+
+    t, ok := j.delete(id, time.Now())
+    if !ok {
+        return nil
+    }
+
+    data, err := json.Marshal(tombstoneRecord(t))
+    if err != nil {
+        return err
+    }
+    j.record(id, data)
+    return nil
+}
+
+// record queues a record and wakes the writer. The caller must hold mu.
+func (j *journalStore) record(id string, data []byte) {
+    if _, ok := j.records[id]; !ok {
+        j.order = append(j.order, id)
+    }
+    j.records[id] = data
+    j.pending = append(j.pending, data)
+
+    select {
+    case j.wake <- struct{}{}:
+    default:
+    }
+}
+
+// run writes the queued records until the store is closed.
+func (j *journalStore) run() {
+    defer close(j.stopped)
+
+    for {
+        select {
+        case <-j.wake:
+            j.flush()
+        case <-j.done:
+            j.flush()
+            return
+        }
+    }
+}
+
+// flush appends the queued records to the journal with a single sync and
+// compacts the journal once it has reached compactAt. A failed write forces a
+// compaction, which rewrites the records that were lost.
+func (j *journalStore) flush() {
+    j.mu.Lock()
+    batch := j.pending
+    j.pending = nil
+    j.mu.Unlock()
+
+    if len(batch) > 0 {
+        if err := j.append(batch); err != nil {
+            log.Printf("Failed to write journal %s: %v", j.path, err)
+            j.size = j.compactAt
+        }
+    }
+    if j.size >= j.compactAt {
+        if err := j.compact(); err != nil {
+            log.Printf("Failed to compact journal %s: %v", j.path, err)
+        }
+    }
+}
+
+// append writes records to the journal and syncs them to disk.
+func (j *journalStore) append(batch [][]byte) error {
+    var buf bytes.Buffer
+    for _, data := range batch {
+        buf.Write(data)
+        buf.WriteByte('\n')
+    }
+
+    n, err := j.file.Write(buf.Bytes())
+    j.size += int64(n)
+    if err != nil {
+        return fmt.Errorf("failed to write journal: %w", err)
+    }
+    if err := j.file.Sync(); err != nil {
+        return fmt.Errorf("failed to sync journal: %w", err)
+    }
+    return nil
+}
+
+// compact replaces the journal by the latest records of the jobs and kept
+// tombstones and reopens it. The records are copied under mu and written
+// without it; records queued meanwhile are appended to the new journal.
+func (j *journalStore) compact() error {
+    j.mu.Lock()
+    kept := j.order[:0]
+    lines := make([][]byte, 0, len(j.order))
+    for _, id := range j.order {
+        _, job := j.jobs[id]
+        _, tomb := j.tombstones[id]
+        if !job && !tomb {
+            delete(j.records, id)
+            continue
+        }
+        kept = append(kept, id)
+        lines = append(lines, j.records[id])
+    }
+    j.order = kept
+    j.pending = nil
+    j.mu.Unlock()
+
+    // Closed first, Windows cannot replace open files
+    if j.file != nil {
+        j.file.Close()
+    }
+    err := writeJournal(j.path, lines)
+    if err != nil {
+        err = fmt.Errorf("failed to compact journal: %w", err)
+    }
+
+    j.file, j.size = nil, 0
+    f, openErr := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+    if openErr != nil {
+        return errors.Join(err, fmt.Errorf("failed to open journal: %w", openErr))
+    }
+    j.file = f
+    if fi, statErr := f.Stat(); statErr == nil {
+        j.size = fi.Size()
+    }
+    j.compactAt = max(j.compactSize, 2*j.size)
+    return err
+}
+
+// Close writes the queued records and closes the journal file.
+func (j *journalStore) Close() error {
+    j.closeOnce.Do(func() {
+        close(j.done)
+        <-j.stopped
+        if j.file != nil {
+            j.closeErr = j.file.Close()
+        }
+    })
+    return j.closeErr
+}
+
+// readJournal replays a journal and returns the latest record of every job in
+// submission order. Lines that cannot be parsed (e.g. a write torn by a crash)
+// are logged and skipped.
+func readJournal(path string) ([]jobRecord, error) {
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open journal: %w", err)
+    }
+    defer f.Close()
+
+    latest := make(map[string]int)
+    records := make([]jobRecord, 0)
+
+    scanner := bufio.NewScanner(f)
+    scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        var rec jobRecord
+        if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+            log.Printf("Skipping unreadable journal record %s:%d: %v", path, line, err)
+            continue
+        }
+        if rec.ID == "" {
+            log.Printf("Skipping journal record without job ID %s:%d", path, line)
+            continue
+        }
+        if i, ok := latest[rec.ID]; ok {
+            records[i] = rec
+            continue
+        }
+        latest[rec.ID] = len(records)
+        records = append(records, rec)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read journal: %w", err)
+    }
+
+    return records, nil
+}
+
+// writeJournal replaces the journal at path with the given records atomically.
+// The new journal is synced before it replaces the old one, and the rename is
+// synced afterwards, so a crash leaves either of them behind.
+func writeJournal(path string, lines [][]byte) error {
+    tmp := path + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+
+    w := bufio.NewWriter(f)
+    for _, line := range lines {
+        w.Write(line)
+        w.WriteByte('\n')
+    }
+    if err := w.Flush(); err != nil {
+        f.Close()
+        return err
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        return err
+    }
+    if err := f.Close(); err != nil {
+        return err
+    }
+
+    if err := os.Rename(tmp, path); err != nil {
+        return err
+    }
+    return syncDir(filepath.Dir(path))
+}
+
+// syncDir syncs a directory, making renames within it durable. Windows
+// cannot sync directories, so the rename is left to the file system there.
+func syncDir(dir string) error {
+    if runtime.GOOS == "windows" {
+        return nil
+    }
+
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+
+    return d.Sync()
+}
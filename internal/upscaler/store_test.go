@@ -0,0 +1,226 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// journalLines returns the number of lines in a journal.
+func journalLines(t *testing.T, path string) int {
+    t.Helper()
+
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+
+    n := 0
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        n++
+    }
+    return n
+}
+
+func TestJournalReplayAndCompaction(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "jobs.journal")
+
+    store, err := NewJournalStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    done := &Job{ID: "done", Status: "queued", Request: Request{ModelName: "realesrgan-x4plus"}}
+    store.Put(done)
+    done.Status = "processing"
+    store.Put(done)
+    done.Status = "completed"
+    done.FinishedAt = time.Now()
+    store.Put(done)
+    failed := &Job{ID: "failed", Status: "failed", Error: errors.New("upscale failed"), ErrorCode: ErrCodeEngineFailed}
+    store.Put(failed)
+    queued := &Job{ID: "queued", Status: "queued"}
+    store.Put(queued)
+    if err := store.Delete("done"); err != nil {
+        t.Fatal(err)
+    }
+    if err := store.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if n := journalLines(t, path); n != 6 {
+        t.Fatalf("journal has %d lines before compaction, want 6", n)
+    }
+
+    // A write torn by a crash
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.WriteString(`{"id":"torn","sta`)
+    f.Close()
+
+    store, err = NewJournalStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+
+    tests := []struct {
+        id         string
+        wantStatus string
+        wantJob    bool
+        wantTomb   bool
+    }{
+        {"done", "completed", false, true},
+        {"failed", "failed", true, false},
+        {"queued", "queued", true, false},
+        {"torn", "", false, false},
+    }
+    for _, tt := range tests {
+        job, ok := store.Get(tt.id)
+        if ok != tt.wantJob {
+            t.Errorf("Get(%s) found = %v, want %v", tt.id, ok, tt.wantJob)
+        }
+        if ok && job.Status != tt.wantStatus {
+            t.Errorf("Get(%s).Status = %s, want %s", tt.id, job.Status, tt.wantStatus)
+        }
+        tomb, ok := store.Tombstone(tt.id)
+        if ok != tt.wantTomb {
+            t.Errorf("Tombstone(%s) found = %v, want %v", tt.id, ok, tt.wantTomb)
+        }
+        if ok && tomb.Status != tt.wantStatus {
+            t.Errorf("Tombstone(%s).Status = %s, want %s", tt.id, tomb.Status, tt.wantStatus)
+        }
+    }
+
+    if job, _ := store.Get("failed"); job.Error == nil || job.ErrorCode != ErrCodeEngineFailed {
+        t.Errorf("failed job lost its error: %+v", job)
+    }
+
+    // One record per job and tombstone, no torn line, no temporary file
+    if n := journalLines(t, path); n != 3 {
+        t.Errorf("compacted journal has %d lines, want 3", n)
+    }
+    if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+        t.Errorf("temporary journal left behind: %v", err)
+    }
+}
+
+func TestJournalCompactsWhileRunning(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "jobs.journal")
+
+    store, err := openJournal(path, 4096)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    job := &Job{ID: "busy", Status: "processing"}
+    for i := 0; i <= 100; i++ {
+        job.Progress = i
+        if err := store.Put(job); err != nil {
+            t.Fatal(err)
+        }
+        // Let the writer catch up, so not every update lands in one batch
+        if i%10 == 0 {
+            time.Sleep(10 * time.Millisecond)
+        }
+    }
+    for i := 0; i < 5; i++ {
+        store.Put(&Job{ID: fmt.Sprintf("done-%d", i), Status: "completed"})
+        store.Delete(fmt.Sprintf("done-%d", i))
+    }
+    if err := store.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    if n := journalLines(t, path); n >= 50 {
+        t.Errorf("journal has %d lines, want it compacted", n)
+    }
+
+    reopened, err := NewJournalStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer reopened.Close()
+    if got, ok := reopened.Get("busy"); !ok || got.Progress != 100 {
+        t.Errorf("Get(busy) = %+v, %v, want progress 100", got, ok)
+    }
+    if _, ok := reopened.Tombstone("done-4"); !ok {
+        t.Error("tombstone of done-4 lost")
+    }
+}
+
+func TestTombstoneLimit(t *testing.T) {
+    m := newMemoryStore(0)
+    for i := 0; i < maxTombstones+10; i++ {
+        id := fmt.Sprintf("job-%d", i)
+        m.jobs[id] = &Job{ID: id, Status: "completed"}
+        m.delete(id, time.Now())
+    }
+
+    if len(m.tombstones) != maxTombstones || len(m.buried) != maxTombstones {
+        t.Fatalf("kept %d tombstones (%d buried), want %d", len(m.tombstones), len(m.buried), maxTombstones)
+    }
+    if _, ok := m.Tombstone("job-9"); ok {
+        t.Error("oldest tombstone was not dropped")
+    }
+    if _, ok := m.Tombstone(fmt.Sprintf("job-%d", maxTombstones+9)); !ok {
+        t.Error("newest tombstone was dropped")
+    }
+}
+
+func TestBatchTombstones(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "jobs.journal")
+
+    store, err := NewJournalStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, job := range []*Job{
+        {ID: "a", Status: "completed", Request: Request{BatchID: "batch", BatchItem: 0}},
+        {ID: "b", Status: "failed", Request: Request{BatchID: "batch", BatchItem: 1}},
+        {ID: "c", Status: "completed"},
+    } {
+        if err := store.Put(job); err != nil {
+            t.Fatal(err)
+        }
+        if err := store.Delete(job.ID); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := store.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    // The batch of a tombstone survives the replay
+    store, err = NewJournalStore(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer store.Close()
+
+    tests := []struct {
+        batchID string
+        want    []string
+    }{
+        {"batch", []string{"a", "b"}},
+        {"other", nil},
+    }
+    for _, tt := range tests {
+        var got []string
+        for _, ts := range store.BatchTombstones(tt.batchID) {
+            got = append(got, ts.ID)
+        }
+        if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+            t.Errorf("BatchTombstones(%q) = %v, want %v", tt.batchID, got, tt.want)
+        }
+    }
+}
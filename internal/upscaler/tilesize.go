@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+    // tileSizesFile holds the learned tile sizes in the work directory.
+    tileSizesFile = "tile_sizes.json"
+    // oomTileSize is the first explicit tile size tried after an engine that
+    // chose its tile size itself ran out of memory.
+    oomTileSize = 256
+    // minTileSize is the smallest tile size tried before giving up.
+    minTileSize = 32
+)
+
+// tileSizes remembers, per device and model, the largest engine tile size that
+// worked after a smaller one had to be used because of out-of-memory failures.
+type tileSizes struct {
+    mu    sync.Mutex
+    path  string
+    sizes map[string]int
+}
+
+// loadTileSizes reads the tile sizes stored at path.
+func loadTileSizes(path string) *tileSizes {
+    t := &tileSizes{path: path, sizes: make(map[string]int)}
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return t
+    }
+    if err := json.Unmarshal(data, &t.sizes); err != nil {
+        log.Printf("Ignoring invalid tile sizes in %s: %v", path, err)
+        t.sizes = make(map[string]int)
+    }
+    return t
+}
+
+// tileSizeKey identifies a device and model.
+func tileSizeKey(device, model string) string {
+    return device + "/" + model
+}
+
+// get returns the remembered tile size of a device and model.
+func (t *tileSizes) get(device, model string) (int, bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    size, ok := t.sizes[tileSizeKey(device, model)]
+    return size, ok
+}
+
+// remember stores the tile size that worked for a device and model and saves
+// the tile sizes.
+func (t *tileSizes) remember(device, model string, size int) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.sizes[tileSizeKey(device, model)] = size
+
+    if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+        log.Printf("Failed to save tile sizes: %v", err)
+        return
+    }
+    if err := writeJSONAtomic(t.path, t.sizes); err != nil {
+        log.Printf("Failed to save tile sizes: %v", err)
+    }
+}
+
+// smallerTileSize returns the tile size to try after an out-of-memory failure
+// with the given one (0 = chosen by the engine).
+func smallerTileSize(size int) (int, bool) {
+    next := oomTileSize
+    if size > 0 {
+        next = size / 2
+    }
+    if next < minTileSize {
+        return 0, false
+    }
+    return next, true
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+)
+
+// stitchStripRows is the number of output rows blended at a time while stitching.
+const stitchStripRows = 64
+
+// tileProgressShare is the share of the overall progress spent on running tiles;
+// the remainder is used for stitching and encoding.
+const tileProgressShare = 90
+
+// tile is a rectangle of the input image processed by a single engine run.
+// The rectangle includes the overlap shared with neighbouring tiles.
+type tile struct {
+    Row  int             `json:"row"`
+    Col  int             `json:"col"`
+    Rect image.Rectangle `json:"rect"`
+    // Core is the part of the tile not shared with a neighbour.
+    Core image.Rectangle `json:"core"`
+}
+
+// tilePlan describes how an input image is split into overlapping tiles.
+type tilePlan struct {
+    Input    ImageSize `json:"input"`
+    TileSize int       `json:"tile_size"`
+    Overlap  int       `json:"overlap"`
+    Rows     int       `json:"rows"`
+    Cols     int       `json:"cols"`
+    Tiles    []tile    `json:"tiles"`
+}
+
+// planTiles splits an image of the given size into tiles of tileSize pixels,
+// each extended by overlap pixels on every side that has a neighbour.
+func planTiles(size ImageSize, tileSize, overlap int) tilePlan {
+    plan := tilePlan{
+        Input:    size,
+        TileSize: tileSize,
+        Overlap:  overlap,
+        Cols:     (size.Width + tileSize - 1) / tileSize,
+        Rows:     (size.Height + tileSize - 1) / tileSize,
+    }
+
+    bounds := image.Rect(0, 0, size.Width, size.Height)
+    for r := 0; r < plan.Rows; r++ {
+        for c := 0; c < plan.Cols; c++ {
+            core := image.Rect(c*tileSize, r*tileSize, (c+1)*tileSize, (r+1)*tileSize).Intersect(bounds)
+            plan.Tiles = append(plan.Tiles, tile{
+                Row:  r,
+                Col:  c,
+                Core: core,
+                Rect: core.Inset(-overlap).Intersect(bounds),
+            })
+        }
+    }
+
+    return plan
+}
+
+// shouldSplit reports whether the service should tile the input itself.
+func (s *Service) shouldSplit(size ImageSize, format string) bool {
+    if s.config.SplitTileSize <= 0 || !canEncode(format) {
+        return false
+    }
+    if size.Width <= s.config.SplitTileSize && size.Height <= s.config.SplitTileSize {
+        return false
+    }
+
+    megapixels := float64(size.Width) * float64(size.Height) / 1e6
+    return megapixels > s.config.SplitThresholdMP
+}
+
+// upscaleTiled cuts the input into overlapping tiles, upscales every tile as a
+// separate engine run and stitches the results with feathered seams.
+// Only one row of upscaled tiles is held in memory while the output is encoded.
+// If the execution has a job directory, completed tiles are checkpointed there
+// and skipped when the job is resumed.
+func (s *Service) upscaleTiled(ctx context.Context, engine Engine, task Task, size ImageSize, exec execution) error {
+    src, err := decodeImage(task.InputPath)
+    if err != nil {
+        return err
+    }
+
+    var tileDir string
+    if exec.dir != "" {
+        tileDir = filepath.Join(exec.dir, "tiles")
+        if err := os.MkdirAll(tileDir, 0755); err != nil {
+            return fmt.Errorf("failed to create tile dir: %w", err)
+        }
+    } else {
+        tileDir, err = s.tempDir("tiles-")
+        if err != nil {
+            return fmt.Errorf("failed to create tile dir: %w", err)
+        }
+        defer os.RemoveAll(tileDir)
+    }
+
+    opaque := true
+    if o, ok := src.(interface{ Opaque() bool }); ok {
+        opaque = o.Opaque()
+    }
+
+    plan := planTiles(size, s.config.SplitTileSize, s.config.SplitOverlap)
+    sub, ok := src.(interface {
+        SubImage(r image.Rectangle) image.Image
+    })
+    if !ok {
+        return fmt.Errorf("unsupported image type %T for tiling", src)
+    }
+
+    outputs := make([]string, len(plan.Tiles))
+    for i, t := range plan.Tiles {
+        outputs[i] = filepath.Join(tileDir, fmt.Sprintf("tile_%d_%d_out.png", t.Row, t.Col))
+    }
+
+    key := checkpointKey(task, plan)
+    done := loadCheckpoint(tileDir, key, outputs)
+    resumed := len(done)
+    exec.tiles(resumed, len(plan.Tiles), resumed)
+    exec.progress(resumed * tileProgressShare / len(plan.Tiles))
+
+    for i, t := range plan.Tiles {
+        if done[i] {
+            continue
+        }
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+
+        tileIn := filepath.Join(tileDir, fmt.Sprintf("tile_%d_%d.png", t.Row, t.Col))
+
+        rect := t.Rect.Add(src.Bounds().Min)
+        if err := encodeImage(tileIn, sub.SubImage(rect), "png", 0); err != nil {
+            return fmt.Errorf("failed to write tile %d/%d: %w", i+1, len(plan.Tiles), err)
+        }
+
+        tileTask := task
+        tileTask.InputPath = tileIn
+        tileTask.OutputPath = outputs[i]
+        tileTask.Format = "png"
+
+        completed := len(done)
+        err := engine.Run(ctx, tileTask, func(p int) {
+            exec.progress((completed*100 + p) * tileProgressShare / (100 * len(plan.Tiles)))
+        })
+        if err != nil {
+            return fmt.Errorf("tile %d/%d failed: %w", i+1, len(plan.Tiles), err)
+        }
+
+        _ = os.Remove(tileIn)
+
+        done[i] = true
+        if exec.dir != "" {
+            if err := saveCheckpoint(tileDir, key, done); err != nil {
+                return fmt.Errorf("failed to save checkpoint: %w", err)
+            }
+        }
+        exec.tiles(len(done), len(plan.Tiles), resumed)
+    }
+
+    exec.stage("stitch")
+    st := newStitcher(plan, task.Scale, outputs, opaque, func(p int) {
+        exec.progress(tileProgressShare + p*(100-tileProgressShare)/100)
+    })
+    if err := encodeImage(task.OutputPath, st, outputFormat(task.OutputPath, task.Format), 0); err != nil {
+        return err
+    }
+    if st.err != nil {
+        _ = os.Remove(task.OutputPath)
+        return st.err
+    }
+
+    return nil
+}
+
+// loadedTile is an upscaled tile held in memory during stitching.
+type loadedTile struct {
+    img  image.Image
+    rect image.Rectangle // output coordinates
+    core image.Rectangle // output coordinates
+}
+
+// stitcher is a lazily evaluated image that blends upscaled tiles on demand.
+// Encoders read images top to bottom, so only the tiles overlapping the current
+// strip of rows are kept in memory.
+type stitcher struct {
+    plan       tilePlan
+    scale      int
+    outputs    []string
+    opaque     bool
+    bounds     image.Rectangle
+    loaded     map[int]*loadedTile
+    strip      *image.RGBA64
+    onProgress func(int)
+    err        error
+}
+
+// newStitcher creates a stitcher for the given tile outputs.
+func newStitcher(plan tilePlan, scale int, outputs []string, opaque bool, onProgress func(int)) *stitcher {
+    return &stitcher{
+        plan:       plan,
+        scale:      scale,
+        outputs:    outputs,
+        opaque:     opaque,
+        bounds:     image.Rect(0, 0, plan.Input.Width*scale, plan.Input.Height*scale),
+        loaded:     make(map[int]*loadedTile),
+        onProgress: onProgress,
+    }
+}
+
+// ColorModel implements image.Image.
+func (st *stitcher) ColorModel() color.Model {
+    return color.RGBAModel
+}
+
+// Bounds implements image.Image.
+func (st *stitcher) Bounds() image.Rectangle {
+    return st.bounds
+}
+
+// Opaque lets the PNG encoder skip its own opacity scan.
+func (st *stitcher) Opaque() bool {
+    return st.opaque
+}
+
+// At implements image.Image.
+func (st *stitcher) At(x, y int) color.Color {
+    return st.RGBA64At(x, y)
+}
+
+// RGBA64At implements image.RGBA64Image.
+func (st *stitcher) RGBA64At(x, y int) color.RGBA64 {
+    if st.err != nil || !(image.Point{x, y}.In(st.bounds)) {
+        return color.RGBA64{}
+    }
+
+    if st.strip == nil || !(image.Point{x, y}.In(st.strip.Rect)) {
+        st.fillStrip(y - y%stitchStripRows)
+    }
+    if st.strip == nil {
+        return color.RGBA64{}
+    }
+
+    return st.strip.RGBA64At(x, y)
+}
+
+// fillStrip blends all tiles covering the rows [y0, y0+stitchStripRows).
+func (st *stitcher) fillStrip(y0 int) {
+    y1 := min(y0+stitchStripRows, st.bounds.Max.Y)
+    strip := image.Rect(0, y0, st.bounds.Dx(), y1)
+
+    if st.onProgress != nil && st.bounds.Dy() > 0 {
+        st.onProgress(y0 * 100 / st.bounds.Dy())
+    }
+
+    tiles, err := st.tilesFor(strip)
+    if err != nil {
+        st.err = err
+        st.strip = nil
+        return
+    }
+
+    width := strip.Dx()
+    acc := make([]float64, width*4)
+    weights := make([]float64, width)
+
+    if st.strip == nil || st.strip.Rect.Dx() != width || st.strip.Rect.Dy() != strip.Dy() {
+        st.strip = image.NewRGBA64(strip)
+    } else {
+        st.strip.Rect = strip
+    }
+
+    for y := y0; y < y1; y++ {
+        clear(acc)
+        clear(weights)
+
+        for _, t := range tiles {
+            if y < t.rect.Min.Y || y >= t.rect.Max.Y {
+                continue
+            }
+            wy := st.ramp(y, t.rect.Min.Y, t.rect.Max.Y, t.core.Min.Y, t.core.Max.Y, st.bounds.Min.Y, st.bounds.Max.Y)
+
+            src, fast := t.img.(image.RGBA64Image)
+            origin := t.img.Bounds().Min
+            for x := t.rect.Min.X; x < t.rect.Max.X; x++ {
+                w := wy * st.ramp(x, t.rect.Min.X, t.rect.Max.X, t.core.Min.X, t.core.Max.X, st.bounds.Min.X, st.bounds.Max.X)
+                if w <= 0 {
+                    continue
+                }
+
+                px, py := origin.X+x-t.rect.Min.X, origin.Y+y-t.rect.Min.Y
+                var r, g, b, a uint32
+                if fast {
+                    c := src.RGBA64At(px, py)
+                    r, g, b, a = uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+                } else {
+                    r, g, b, a = t.img.At(px, py).RGBA()
+                }
+
+                i := x * 4
+                acc[i] += w * float64(r)
+                acc[i+1] += w * float64(g)
+                acc[i+2] += w * float64(b)
+                acc[i+3] += w * float64(a)
+                weights[x] += w
+            }
+        }
+
+        for x := 0; x < width; x++ {
+            if weights[x] == 0 {
+                continue
+            }
+            i := x * 4
+            st.strip.SetRGBA64(x, y, color.RGBA64{
+                R: uint16(acc[i]/weights[x] + 0.5),
+                G: uint16(acc[i+1]/weights[x] + 0.5),
+                B: uint16(acc[i+2]/weights[x] + 0.5),
+                A: uint16(acc[i+3]/weights[x] + 0.5),
+            })
+        }
+    }
+}
+
+// ramp returns the feathering weight of a tile at coordinate v along one axis.
+// Inside the core the weight is 1; across the overlap shared with a neighbour it
+// falls linearly so that the weights of adjacent tiles sum to one. Sides on the
+// image border are not feathered.
+func (st *stitcher) ramp(v, lo, hi, coreLo, coreHi, boundLo, boundHi int) float64 {
+    overlap := float64(st.plan.Overlap * st.scale)
+    if overlap <= 0 {
+        if v >= coreLo && v < coreHi {
+            return 1
+        }
+        return 0
+    }
+
+    w := 1.0
+    if coreLo > boundLo {
+        // Neighbour before us, its extended range ends at coreLo+overlap.
+        start := float64(coreLo) - overlap
+        w = min(w, (float64(v)-start+0.5)/(2*overlap))
+    }
+    if coreHi < boundHi {
+        end := float64(coreHi) + overlap
+        w = min(w, (end-float64(v)-0.5)/(2*overlap))
+    }
+    return max(w, 0)
+}
+
+// tilesFor loads the tiles overlapping the given output rectangle and releases
+// tiles that lie entirely above it.
+func (st *stitcher) tilesFor(r image.Rectangle) ([]*loadedTile, error) {
+    for i, t := range st.loaded {
+        if t.rect.Max.Y <= r.Min.Y {
+            delete(st.loaded, i)
+        }
+    }
+
+    tiles := make([]*loadedTile, 0)
+    for i, t := range st.plan.Tiles {
+        rect := image.Rect(t.Rect.Min.X*st.scale, t.Rect.Min.Y*st.scale, t.Rect.Max.X*st.scale, t.Rect.Max.Y*st.scale)
+        if !rect.Overlaps(r) {
+            continue
+        }
+
+        lt, ok := st.loaded[i]
+        if !ok {
+            img, err := decodeImage(st.outputs[i])
+            if err != nil {
+                return nil, fmt.Errorf("failed to load tile %d: %w", i+1, err)
+            }
+            if img.Bounds().Dx() != rect.Dx() || img.Bounds().Dy() != rect.Dy() {
+                return nil, fmt.Errorf("tile %d has size %dx%d, expected %dx%d",
+                    i+1, img.Bounds().Dx(), img.Bounds().Dy(), rect.Dx(), rect.Dy())
+            }
+
+            lt = &loadedTile{
+                img:  img,
+                rect: rect,
+                core: image.Rect(t.Core.Min.X*st.scale, t.Core.Min.Y*st.scale, t.Core.Max.X*st.scale, t.Core.Max.Y*st.scale),
+            }
+            st.loaded[i] = lt
+        }
+        tiles = append(tiles, lt)
+    }
+
+    return tiles, nil
+}
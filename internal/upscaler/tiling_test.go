@@ -0,0 +1,154 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanTiles(t *testing.T) {
+    tests := []struct {
+        name       string
+        size       ImageSize
+        tileSize   int
+        overlap    int
+        rows, cols int
+    }{
+        {"exact fit", ImageSize{Width: 64, Height: 64}, 32, 4, 2, 2},
+        {"partial last tiles", ImageSize{Width: 100, Height: 70}, 32, 4, 3, 4},
+        {"single tile", ImageSize{Width: 20, Height: 10}, 32, 8, 1, 1},
+        {"no overlap", ImageSize{Width: 65, Height: 33}, 32, 0, 2, 3},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            plan := planTiles(tt.size, tt.tileSize, tt.overlap)
+            if plan.Rows != tt.rows || plan.Cols != tt.cols || len(plan.Tiles) != tt.rows*tt.cols {
+                t.Fatalf("planTiles() = %dx%d with %d tiles, want %dx%d", plan.Rows, plan.Cols, len(plan.Tiles), tt.rows, tt.cols)
+            }
+
+            // The cores cover every pixel exactly once
+            bounds := image.Rect(0, 0, tt.size.Width, tt.size.Height)
+            area := 0
+            for _, tl := range plan.Tiles {
+                area += tl.Core.Dx() * tl.Core.Dy()
+                if want := tl.Core.Inset(-tt.overlap).Intersect(bounds); tl.Rect != want {
+                    t.Errorf("tile %d,%d rect = %v, want %v", tl.Row, tl.Col, tl.Rect, want)
+                }
+                for _, other := range plan.Tiles {
+                    if other != tl && other.Core.Overlaps(tl.Core) {
+                        t.Errorf("cores of tiles %d,%d and %d,%d overlap", tl.Row, tl.Col, other.Row, other.Col)
+                    }
+                }
+            }
+            if area != tt.size.Width*tt.size.Height {
+                t.Errorf("cores cover %d pixels, want %d", area, tt.size.Width*tt.size.Height)
+            }
+        })
+    }
+}
+
+func TestStitcherWeightsSumToOne(t *testing.T) {
+    tests := []struct {
+        width, tileSize, overlap, scale int
+    }{
+        {100, 32, 0, 1},
+        {100, 32, 4, 1},
+        {100, 32, 4, 2},
+        {130, 64, 16, 4},
+    }
+
+    for _, tt := range tests {
+        t.Run(fmt.Sprintf("%d/%d/%d/%dx", tt.width, tt.tileSize, tt.overlap, tt.scale), func(t *testing.T) {
+            plan := planTiles(ImageSize{Width: tt.width, Height: 1}, tt.tileSize, tt.overlap)
+            st := newStitcher(plan, tt.scale, nil, true, nil)
+
+            for x := 0; x < tt.width*tt.scale; x++ {
+                sum := 0.0
+                for _, tl := range plan.Tiles {
+                    lo, hi := tl.Rect.Min.X*tt.scale, tl.Rect.Max.X*tt.scale
+                    if x < lo || x >= hi {
+                        continue
+                    }
+                    sum += st.ramp(x, lo, hi, tl.Core.Min.X*tt.scale, tl.Core.Max.X*tt.scale, 0, tt.width*tt.scale)
+                }
+                if math.Abs(sum-1) > 1e-9 {
+                    t.Fatalf("weights at x=%d sum to %v, want 1", x, sum)
+                }
+            }
+        })
+    }
+}
+
+func TestStitcherSeams(t *testing.T) {
+    tests := []struct {
+        name              string
+        size              ImageSize
+        tileSize, overlap int
+        scale             int
+    }{
+        {"2x with overlap", ImageSize{Width: 90, Height: 70}, 32, 6, 2},
+        {"4x without overlap", ImageSize{Width: 40, Height: 40}, 16, 0, 4},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // Tiles cut from one upscaled image must stitch back to it
+            // without visible seams
+            want := image.NewNRGBA(image.Rect(0, 0, tt.size.Width*tt.scale, tt.size.Height*tt.scale))
+            for y := 0; y < want.Rect.Dy(); y++ {
+                for x := 0; x < want.Rect.Dx(); x++ {
+                    want.Set(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+                }
+            }
+
+            dir := t.TempDir()
+            plan := planTiles(tt.size, tt.tileSize, tt.overlap)
+            outputs := make([]string, len(plan.Tiles))
+            for i, tl := range plan.Tiles {
+                rect := image.Rect(tl.Rect.Min.X*tt.scale, tl.Rect.Min.Y*tt.scale, tl.Rect.Max.X*tt.scale, tl.Rect.Max.Y*tt.scale)
+                outputs[i] = filepath.Join(dir, fmt.Sprintf("tile_%d.png", i))
+                if err := encodeImage(outputs[i], want.SubImage(rect), "png", 0); err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            st := newStitcher(plan, tt.scale, outputs, true, nil)
+            if st.Bounds() != want.Rect {
+                t.Fatalf("Bounds() = %v, want %v", st.Bounds(), want.Rect)
+            }
+            for y := 0; y < want.Rect.Dy(); y++ {
+                for x := 0; x < want.Rect.Dx(); x++ {
+                    r, g, b, a := want.At(x, y).RGBA()
+                    got := st.RGBA64At(x, y)
+                    if uint32(got.R) != r || uint32(got.G) != g || uint32(got.B) != b || uint32(got.A) != a {
+                        t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want.At(x, y))
+                    }
+                }
+            }
+            if st.err != nil {
+                t.Fatalf("stitcher error = %v", st.err)
+            }
+        })
+    }
+}
+
+func TestStitcherRejectsWrongTileSize(t *testing.T) {
+    dir := t.TempDir()
+    plan := planTiles(ImageSize{Width: 20, Height: 20}, 32, 0)
+    outputs := []string{filepath.Join(dir, "tile.png")}
+    if err := encodeImage(outputs[0], image.NewNRGBA(image.Rect(0, 0, 30, 40)), "png", 0); err != nil {
+        t.Fatal(err)
+    }
+
+    st := newStitcher(plan, 2, outputs, true, nil)
+    if c := st.RGBA64At(0, 0); c != (color.RGBA64{}) || st.err == nil {
+        t.Fatalf("RGBA64At() = %v, err = %v, want an error for the 30x40 tile", c, st.err)
+    }
+}
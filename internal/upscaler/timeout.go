@@ -0,0 +1,56 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+    defaultTimeoutMin   = 2 * time.Minute
+    defaultTimeoutMax   = 6 * time.Hour
+    defaultTimeoutPerMP = 20 * time.Second
+    // timeoutSafetyFactor is applied to predicted durations, which are averages.
+    timeoutSafetyFactor = 3
+)
+
+// validateTimeout checks a per-request timeout override.
+func (s *Service) validateTimeout(timeout time.Duration) error {
+    if timeout < 0 {
+        return fmt.Errorf("invalid timeout: %s", timeout)
+    }
+    if timeout > s.config.TimeoutOverrideMax {
+        return fmt.Errorf("timeout %s exceeds the maximum of %s", timeout, s.config.TimeoutOverrideMax)
+    }
+    return nil
+}
+
+// jobTimeout returns the time a job may run. Without an override it is derived
+// from the predicted duration of the job, or from the output megapixels if
+// there is no throughput data yet, and clamped to the configured bounds. The
+// caller must hold jobsMu.
+func (s *Service) jobTimeout(job *Job) time.Duration {
+    if job.Request.Timeout > 0 {
+        return job.Request.Timeout
+    }
+
+    var timeout time.Duration
+    if duration, ok := s.predictJob(job); ok && duration > 0 {
+        timeout = duration * timeoutSafetyFactor
+    } else if job.InputSize.Width > 0 && job.InputSize.Height > 0 {
+        out := targetSize(job.InputSize, job.Request)
+        if len(job.Request.Pipeline) > 0 {
+            if plan, err := s.planJob(job.InputSize, job.Request); err == nil {
+                out = plan.OutputSize
+            }
+        }
+        megapixels := float64(out.Width) * float64(out.Height) / 1e6
+        timeout = time.Duration(megapixels * float64(s.config.TimeoutPerMP))
+    } else {
+        timeout = s.config.TimeoutMax
+    }
+
+    return min(max(timeout, s.config.TimeoutMin), s.config.TimeoutMax)
+}
@@ -4,21 +4,24 @@
 package upscaler
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "golang.org/x/image/webp"
+
+	"upscale-service/internal/ids"
 )
 
 // Config holds the configuration settings for the upscaler service.
@@ -30,16 +33,95 @@ type Config struct {
     Threads      string
     EnableGPU    bool
     GPUID        int
+    // Engines are additional ncnn-vulkan binaries (e.g. Real-CUGAN, waifu2x),
+    // consulted after the binary above in the given order.
+    Engines      []EngineConfig
+    // Devices lists the compute devices workers are bound to. If empty, a single
+    // device is derived from EnableGPU and GPUID.
+    Devices      []Device
+    // ResampleFallback runs jobs on the built-in resample engine when the
+    // engine of the requested model is unavailable (e.g. binary missing).
+    ResampleFallback bool
+    // WorkDir holds temporary job files and tiles (default ~/.mlcupscale/tmp).
+    WorkDir          string
+    // SplitTileSize is the tile edge in input pixels used when the service splits
+    // large images itself (0 disables splitting).
+    SplitTileSize    int
+    // SplitOverlap is the overlap in input pixels shared by neighbouring tiles.
+    SplitOverlap     int
+    // SplitThresholdMP is the input size in megapixels above which images are split.
+    SplitThresholdMP float64
+    // Store keeps jobs and their results (default: in memory only).
+    Store            JobStore
+    // MaxQueueSize is the number of queued jobs above which submissions are
+    // rejected with ErrQueueFull (0 = unlimited).
+    MaxQueueSize     int
+    // TimeoutMin and TimeoutMax bound the computed job timeouts
+    // (default 2 minutes and 6 hours).
+    TimeoutMin         time.Duration
+    TimeoutMax         time.Duration
+    // TimeoutPerMP is the time allowed per output megapixel while there is no
+    // throughput data for a model (default 20 seconds).
+    TimeoutPerMP       time.Duration
+    // TimeoutOverrideMax is the largest per-request timeout (default TimeoutMax).
+    TimeoutOverrideMax time.Duration
+    // MaxRetries is the number of times a transiently failed job is repeated,
+    // waiting RetryBackoff (default 5 seconds) before the first retry and
+    // doubling it for each further one.
+    MaxRetries         int
+    RetryBackoff       time.Duration
+    // CPUFallback repeats jobs on the CPU when the GPU cannot be initialised.
+    CPUFallback        bool
+    // PriorityAging is the waiting time after which a queued job is treated as
+    // one priority level higher (default 10 minutes).
+    PriorityAging    time.Duration
+    // HistoryMaxJobs and HistoryMaxAge bound the finished jobs kept by
+    // PruneHistory (default 1000 jobs and 24 hours).
+    HistoryMaxJobs   int
+    HistoryMaxAge    time.Duration
+    // DownloadTokens gives every job a secret DownloadToken.
+    DownloadTokens   bool
+    // MaxBatchSize is the largest number of images in a batch (0 = unlimited).
+    MaxBatchSize     int
+    // ModelsPollInterval is the interval at which WatchModels checks the
+    // models directories for changes (default 10 seconds, negative disables).
+    ModelsPollInterval time.Duration
 }
 
+// ErrQueueFull is returned by SubmitJob when the queue has reached MaxQueueSize.
+var ErrQueueFull = errors.New("queue is full")
+
 // Request represents a single image upscaling task request.
+// The output size is given either by Scale (which may be fractional) or by a
+// target width and/or height; with both, Fit decides how the box is filled.
 type Request struct {
-    InputPath  string
-    OutputPath string
-    Scale      int
-    ModelName  string
-    TileSize   int
-    Format     string
+    // JobID is the ID of the job, e.g. to name the output file after it
+    // before submitting; empty picks a new ID.
+    JobID        string
+    InputPath    string
+    OutputPath   string
+    Scale        float64
+    TargetWidth  int
+    TargetHeight int
+    Fit          string
+    ModelName    string
+    TileSize     int
+    Format       string
+    // Device is the device preference: "" or "auto", "gpu", "cpu" or a device name.
+    Device       string
+    Priority     Priority
+    // Timeout overrides the computed job timeout (0 = computed).
+    Timeout      time.Duration
+    // BatchID groups the jobs submitted together by SubmitBatch; BatchItem is
+    // the job's position in the batch and Name the original file name.
+    BatchID      string
+    BatchItem    int
+    Name         string
+    // Pipeline lists the processing stages to run instead of a single
+    // upscale. Scale, TargetWidth, TargetHeight and Fit are then ignored.
+    Pipeline     []PipelineStage
+    // Options are passed to the engine of every model pass.
+    Options      EngineOptions
 }
 
 // Result contains the output information of a completed upscaling task.
@@ -49,6 +131,8 @@ type Result struct {
     InputSize     ImageSize
     OutputSize    ImageSize
     FileSizeBytes int64
+    Engine        string
+    Plan          Plan
 }
 
 // ImageSize represents the dimensions of an image.
@@ -64,89 +148,390 @@ type Job struct {
     Status     string
     Progress   int
     StartTime  time.Time
+    // StartedAt is the time processing started.
+    StartedAt  time.Time
+    // FinishedAt is the time the job reached a final status.
+    FinishedAt time.Time
+    // InputSize is the size of the input image, used for estimates.
+    InputSize  ImageSize
     Result     *Result
     Error      error
+    // TilesDone and TilesTotal track split-and-stitch progress.
+    TilesDone  int
+    TilesTotal int
+    // Resumed is set for jobs restarted from a checkpoint after a restart,
+    // ResumedTiles is the number of tiles that did not have to be redone.
+    Resumed      bool
+    ResumedTiles int
+    // Plan is the execution plan, available once processing has started.
+    Plan       *Plan
+    // Device is the name of the device the job ran on.
+    Device     string
+    // Timeout is the time each attempt of the job may run, set when
+    // processing starts.
+    Timeout    time.Duration
+    // Stage is the step a processing job is currently in, e.g. "upscale".
+    Stage      string
+    // Pipeline holds the progress of each stage of a pipeline request.
+    Pipeline   []StageProgress
+    // Attempts records every run of the job, including retries.
+    Attempts   []Attempt
+    // ErrorCode classifies Error for failed, timed out and cancelled jobs.
+    ErrorCode  ErrorCode
+    // DownloadToken is the secret required to download the result, if enabled.
+    DownloadToken string
     cancelFunc context.CancelFunc
 }
 
 // Service manages the upscaling queue and execution.
 type Service struct {
-    config   Config
-    jobs     map[string]*Job
-    jobsMu   sync.Mutex
-    jobQueue chan *Job
+    config    Config
+    store     JobStore
+    jobsMu    sync.Mutex
+    queue     *jobQueue
+    devices   []Device
+    workers   int
+    stats     *throughputStats
+    tileSizes *tileSizes
+    engines   []Engine
+    enginesMu sync.RWMutex
+    // models is the current model catalogue, swapped by reloadModels under
+    // reloadMu; hashes caches the checksums of model files.
+    models    atomic.Pointer[modelCatalogue]
+    reloadMu  sync.Mutex
+    hashes    *fileHashes
+    // snapshotMu serialises taking and releasing model snapshots; it is
+    // taken before jobsMu, never while holding it.
+    snapshotMu sync.Mutex
+    events    *EventBus
+    // running counts the workers; jobs run with contexts derived from baseCtx,
+    // which Shutdown cancels through interrupt.
+    running      sync.WaitGroup
+    baseCtx      context.Context
+    interrupt    context.CancelCauseFunc
+    shuttingDown bool
+    maintenance  bool
 }
 
 // NewService creates a new upscaler service instance.
+// The realesrgan-ncnn-vulkan engine and the built-in resample engine are registered by default.
 func NewService(cfg Config) *Service {
-    return &Service{
-        config:   cfg,
-        jobs:     make(map[string]*Job),
-        jobQueue: make(chan *Job, 100),
+    if cfg.WorkDir == "" {
+        cfg.WorkDir = defaultWorkDir()
+    }
+    if cfg.Store == nil {
+        cfg.Store = NewMemoryStore()
+    }
+    if cfg.TimeoutMin <= 0 {
+        cfg.TimeoutMin = defaultTimeoutMin
+    }
+    if cfg.TimeoutMax <= 0 {
+        cfg.TimeoutMax = defaultTimeoutMax
+    }
+    if cfg.TimeoutPerMP <= 0 {
+        cfg.TimeoutPerMP = defaultTimeoutPerMP
+    }
+    if cfg.TimeoutOverrideMax <= 0 {
+        cfg.TimeoutOverrideMax = cfg.TimeoutMax
+    }
+    if cfg.RetryBackoff <= 0 {
+        cfg.RetryBackoff = 5 * time.Second
+    }
+    if cfg.HistoryMaxJobs <= 0 {
+        cfg.HistoryMaxJobs = defaultHistoryMaxJobs
+    }
+    if cfg.HistoryMaxAge <= 0 {
+        cfg.HistoryMaxAge = defaultHistoryMaxAge
+    }
+
+    s := &Service{
+        config:    cfg,
+        store:     cfg.Store,
+        queue:     newJobQueue(cfg.PriorityAging),
+        devices:   normalizeDevices(cfg),
+        stats:     loadThroughputStats(filepath.Join(cfg.WorkDir, throughputFile)),
+        tileSizes: loadTileSizes(filepath.Join(cfg.WorkDir, tileSizesFile)),
+        hashes:    newFileHashes(),
+        events:    NewEventBus(),
+    }
+    s.baseCtx, s.interrupt = context.WithCancelCause(context.Background())
+
+    s.RegisterEngine(NewRealESRGANEngine(RealESRGANConfig{
+        BinaryPath: cfg.BinaryPath,
+        ModelsPath: cfg.ModelsPath,
+        Threads:    cfg.Threads,
+    }))
+    for _, ec := range cfg.Engines {
+        if ec.Threads == "" {
+            ec.Threads = cfg.Threads
+        }
+        engine, err := NewEngine(ec)
+        if err != nil {
+            log.Printf("Skipping engine: %v", err)
+            continue
+        }
+        s.RegisterEngine(engine)
     }
+    s.RegisterEngine(NewResampleEngine())
+
+    return s
 }
 
-// StartWorkers starts the specified number of worker goroutines.
+// StartWorkers starts the worker goroutines of every device. Devices without an
+// explicit worker count get the specified number of workers.
 func (s *Service) StartWorkers(count int) {
-    for i := 0; i < count; i++ {
-        go s.worker()
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    for _, device := range s.devices {
+        workers := device.Workers
+        if workers <= 0 {
+            workers = count
+        }
+        s.running.Add(workers)
+        for i := 0; i < workers; i++ {
+            go s.worker(device)
+        }
+        s.workers += workers
     }
 }
 
-// worker processes jobs from the queue.
-func (s *Service) worker() {
-    for job := range s.jobQueue {
-        s.processJob(job)
+// workerCount returns the number of started workers, at least one. The caller
+// must hold jobsMu.
+func (s *Service) workerCount() int {
+    return max(s.workers, 1)
+}
+
+// worker processes jobs from the queue on the given device until the queue is
+// closed.
+func (s *Service) worker(device Device) {
+    defer s.running.Done()
+
+    for {
+        job := s.queue.pop(device)
+        if job == nil {
+            return
+        }
+        s.processJob(job, device)
     }
 }
 
 // SubmitJob adds a new upscaling request to the processing queue.
 func (s *Service) SubmitJob(req Request) (string, error) {
+    if err := s.validateRequest(req); err != nil {
+        return "", err
+    }
+
+    // Only used for estimates, the job fails later if the input is unreadable
+    inputSize, _ := s.getImageSize(req.InputPath)
+
+    job, err := s.submit(req, inputSize)
+    if err != nil {
+        return "", err
+    }
+
+    // Pinned by the queued job, the snapshot is taken outside jobsMu
+    s.snapshotModels(req)
+    return job.ID, nil
+}
+
+// submit queues a validated request if submissions are accepted.
+func (s *Service) submit(req Request, inputSize ImageSize) (*Job, error) {
     s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
 
-    id := generateJobID()
+    if err := s.accepting(); err != nil {
+        return nil, err
+    }
+
+    token := ""
+    if s.config.DownloadTokens {
+        token = ids.Token()
+    }
+    return s.enqueue(req, inputSize, token)
+}
+
+// validateRequest checks the parts of a request that are not checked when the
+// job runs.
+func (s *Service) validateRequest(req Request) error {
+    if err := s.validateDevice(req.Device); err != nil {
+        return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if err := s.validateTimeout(req.Timeout); err != nil {
+        return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if err := s.validatePipeline(req); err != nil {
+        return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if err := s.validateOptions(req); err != nil {
+        return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if err := s.validateModels(req); err != nil {
+        return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if err := s.validateModelScales(req); err != nil {
+        return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    return nil
+}
+
+// accepting returns an error if new submissions are rejected. New jobs are
+// only pushed under jobsMu, so the queue cannot grow between the check and
+// the push. The caller must hold jobsMu.
+func (s *Service) accepting() error {
+    if s.shuttingDown {
+        return ErrShuttingDown
+    }
+    if s.maintenance {
+        return ErrMaintenance
+    }
+    if s.config.MaxQueueSize > 0 && s.queue.len() >= s.config.MaxQueueSize {
+        return ErrQueueFull
+    }
+    return nil
+}
+
+// enqueue creates a job for a request, stores it and queues it. The caller
+// must hold jobsMu, and snapshot the models of the request after releasing it.
+func (s *Service) enqueue(req Request, inputSize ImageSize, token string) (*Job, error) {
+    id := req.JobID
+    if id == "" {
+        var err error
+        if id, err = s.newJobID(); err != nil {
+            return nil, err
+        }
+    } else if !ids.Valid(id) || s.jobIDUsed(id) {
+        return nil, fmt.Errorf("%w: invalid or duplicate job ID %q", ErrInvalidRequest, id)
+    }
+    req.JobID = id
     job := &Job{
-        ID:        id,
-        Request:   req,
-        Status:    "queued",
-        Progress:  0,
-        StartTime: time.Now(),
+        ID:            id,
+        Request:       req,
+        Status:        "queued",
+        Progress:      0,
+        StartTime:     time.Now(),
+        InputSize:     inputSize,
+        DownloadToken: token,
     }
 
-    s.jobs[id] = job
-    s.jobsMu.Unlock()
+    if err := s.store.Put(job); err != nil {
+        return nil, fmt.Errorf("failed to store job: %w", err)
+    }
 
-    // Send to worker queue
-    // Use a goroutine to avoid blocking the API response if the queue is full
-    go func() {
-        s.jobQueue <- job
-    }()
+    s.queue.push(job)
+    s.publish(job, EventQueued)
 
-    return id, nil
+    return job, nil
 }
 
-// GetJob retrieves the status and details of a specific job.
+// GetJob retrieves the status and details of a specific job. It returns a
+// snapshot that is safe to read while the job runs on.
 func (s *Service) GetJob(jobID string) (*Job, bool) {
     s.jobsMu.Lock()
     defer s.jobsMu.Unlock()
 
-    job, ok := s.jobs[jobID]
-    return job, ok
+    job, ok := s.store.Get(jobID)
+    if !ok {
+        return nil, false
+    }
+    return job.snapshot(), true
+}
+
+// snapshot copies a job for reading without jobsMu. Result and Plan are
+// shared, they are never modified once set. The caller must hold jobsMu.
+func (j *Job) snapshot() *Job {
+    c := *j
+    c.Pipeline = slices.Clone(j.Pipeline)
+    c.Attempts = slices.Clone(j.Attempts)
+    c.cancelFunc = nil
+    return &c
+}
+
+// QueuePosition returns the 1-based position of a queued job in start order,
+// or 0 if the job is not queued.
+func (s *Service) QueuePosition(jobID string) int {
+    job, ok := s.store.Get(jobID)
+    if !ok {
+        return 0
+    }
+    return s.queue.position(job)
+}
+
+// QueueLength returns the number of queued jobs.
+func (s *Service) QueueLength() int {
+    return s.queue.len()
+}
+
+// UsesFile reports whether a job that has not finished yet reads or writes
+// path, so file cleanup can skip it.
+func (s *Service) UsesFile(path string) bool {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    for _, job := range s.store.List() {
+        if !job.Finished() && (job.Request.InputPath == path || job.Request.OutputPath == path) {
+            return true
+        }
+    }
+    return false
+}
+
+// Close releases the job store.
+func (s *Service) Close() error {
+    return s.store.Close()
+}
+
+// setStatus moves a job to a new status, records the transition in the store
+// and publishes it. The caller must hold jobsMu.
+func (s *Service) setStatus(job *Job, status string) {
+    job.Status = status
+    if status != "processing" {
+        job.Stage = ""
+    }
+    if job.Finished() {
+        job.FinishedAt = time.Now()
+    }
+    if err := s.store.Put(job); err != nil {
+        log.Printf("Failed to store job %s: %v", job.ID, err)
+    }
+    if t, ok := statusEvents[status]; ok {
+        s.publish(job, t)
+    }
+}
+
+// setStage records the step a processing job has reached. The caller must
+// hold jobsMu.
+func (s *Service) setStage(job *Job, stage string) {
+    if job.Stage == stage || job.Status != "processing" {
+        return
+    }
+    job.Stage = stage
+    s.publish(job, EventStage)
 }
 
-// processJob executes the upscaling logic for a given job and updates its status.
-func (s *Service) processJob(job *Job) {
+// processJob executes the upscaling logic for a given job on a device and updates its status.
+func (s *Service) processJob(job *Job, device Device) {
     s.jobsMu.Lock()
     // Check if already cancelled while in queue
     if job.Status == "cancelled" {
         s.jobsMu.Unlock()
+        // A resumed job may still have checkpoints from its previous run
+        _ = os.RemoveAll(s.jobDir(job.ID))
         return
     }
 
-    job.Status = "processing"
     job.Progress = 1 // Set to 1% immediately
+    job.Device = device.Name
+    job.StartedAt = time.Now()
+    job.Timeout = s.jobTimeout(job)
+    if len(job.Request.Pipeline) > 0 {
+        job.Pipeline = newStageProgress(job.Request.Pipeline)
+    }
+    s.setStatus(job, "processing")
+    s.setStage(job, "prepare")
 
-    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+    // The timeout applies to each attempt, see runAttempts
+    ctx, cancel := context.WithCancel(s.baseCtx)
     job.cancelFunc = cancel
     s.jobsMu.Unlock()
 
@@ -157,67 +542,119 @@ func (s *Service) processJob(job *Job) {
         s.jobsMu.Lock()
         if p > job.Progress {
             job.Progress = p
+            if job.Status == "processing" {
+                s.publish(job, EventProgress)
+            }
+        }
+        s.jobsMu.Unlock()
+    }
+
+    onStage := func(stage string) {
+        s.jobsMu.Lock()
+        s.setStage(job, stage)
+        s.jobsMu.Unlock()
+    }
+
+    onStep := func(i, p int) {
+        s.jobsMu.Lock()
+        if i < len(job.Pipeline) && p > job.Pipeline[i].Progress {
+            job.Pipeline[i].Progress = p
         }
         s.jobsMu.Unlock()
     }
 
-    // Prepare temp working directory and copy input/output so current files
-    // are visible under ~/.mlcupscale/tmp while processing.
+    // Prepare the job directory and copy the input so current files are visible
+    // under the work directory while processing. The directory also holds the
+    // manifest and tile checkpoints used to resume the job after a restart.
     req := job.Request
     origInput := req.InputPath
     origOutput := req.OutputPath
 
-    homeDir, errHome := os.UserHomeDir()
-    if errHome != nil {
-        homeDir = os.TempDir()
+    dir := s.jobDir(job.ID)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        s.failJob(job, dir, fmt.Errorf("failed to create job dir: %w", err))
+        return
     }
 
-    tmpDir := filepath.Join(homeDir, ".mlcupscale", "tmp")
-    if err := os.MkdirAll(tmpDir, 0755); err != nil {
-        s.jobsMu.Lock()
-        job.Status = "failed"
-        job.Error = fmt.Errorf("failed to create temp dir: %w", err)
-        s.jobsMu.Unlock()
-        return
+    tmpInput := filepath.Join(dir, "in_"+filepath.Base(origInput))
+    if _, err := os.Stat(tmpInput); err != nil {
+        if err := copyFile(origInput, tmpInput+".part"); err != nil {
+            s.failJob(job, dir, fmt.Errorf("failed to copy input to job dir: %w", err))
+            return
+        }
+        if err := os.Rename(tmpInput+".part", tmpInput); err != nil {
+            s.failJob(job, dir, fmt.Errorf("failed to copy input to job dir: %w", err))
+            return
+        }
     }
 
-    tmpInput := filepath.Join(tmpDir, job.ID+"_"+filepath.Base(origInput))
-    if err := copyFile(origInput, tmpInput); err != nil {
-        s.jobsMu.Lock()
-        job.Status = "failed"
-        job.Error = fmt.Errorf("failed to copy input to temp: %w", err)
-        s.jobsMu.Unlock()
+    if err := writeManifest(dir, job); err != nil {
+        s.failJob(job, dir, fmt.Errorf("failed to write job manifest: %w", err))
         return
     }
 
-    tmpOutput := filepath.Join(tmpDir, job.ID+"_out_"+filepath.Base(origOutput))
+    tmpOutput := filepath.Join(dir, "out_"+filepath.Base(origOutput))
     req.InputPath = tmpInput
     req.OutputPath = tmpOutput
 
-    result, err := s.Upscale(ctx, req, onProgress)
+    result, err := s.runAttempts(ctx, job, req, execution{
+        dir:        dir,
+        device:     device,
+        onProgress: onProgress,
+        onStage:    onStage,
+        onStep:     onStep,
+        onPlan: func(p Plan) {
+            s.jobsMu.Lock()
+            job.Plan = &p
+            s.jobsMu.Unlock()
+        },
+        onTiles: func(done, total, resumed int) {
+            s.jobsMu.Lock()
+            job.TilesDone = done
+            job.TilesTotal = total
+            if job.Resumed {
+                job.ResumedTiles = resumed
+            }
+            s.jobsMu.Unlock()
+        },
+    })
 
     // If upscale succeeded, move tmp output back to original output location
     if err == nil && result != nil {
+        onStage("finalize")
+
         // Ensure destination dir exists
         _ = os.MkdirAll(filepath.Dir(origOutput), 0755)
 
         // Try rename, fall back to copy
         if mvErr := os.Rename(tmpOutput, origOutput); mvErr != nil {
             if cpErr := copyFile(tmpOutput, origOutput); cpErr != nil {
-                s.jobsMu.Lock()
-                job.Status = "failed"
-                job.Error = fmt.Errorf("failed to move output to final location: rename=%v copy=%v", mvErr, cpErr)
-                s.jobsMu.Unlock()
+                s.failJob(job, dir, fmt.Errorf("failed to move output to final location: rename=%v copy=%v", mvErr, cpErr))
                 return
             }
-            _ = os.Remove(tmpOutput)
         }
 
         result.OutputPath = origOutput
     }
 
-    // Remove temp input file
-    _ = os.Remove(tmpInput)
+    if err != nil && interrupted(ctx) {
+        // Keep the manifest and checkpoints, the job is resumed on the next start
+        s.jobsMu.Lock()
+        job.cancelFunc = nil
+        s.jobsMu.Unlock()
+        log.Printf("Job %s interrupted by shutdown", job.ID)
+        return
+    }
+
+    // The job reached a terminal state, its checkpoints are no longer needed
+    _ = os.RemoveAll(dir)
+
+    // Measured before the job is published as completed, and saved to disk
+    // without holding jobsMu. Checkpoints make resumed runs faster than a
+    // full run, so those are not measured.
+    if err == nil && !job.Resumed && s.recordThroughput(job, result) {
+        s.stats.save()
+    }
 
     s.jobsMu.Lock()
     defer s.jobsMu.Unlock()
@@ -232,110 +669,196 @@ func (s *Service) processJob(job *Job) {
     if err != nil {
         // Check if error was due to context cancellation
         if ctx.Err() == context.Canceled {
-             job.Status = "cancelled"
+             job.ErrorCode = ErrCodeCancelled
+             s.setStatus(job, "cancelled")
+        } else if errors.Is(err, errTimedOut) {
+             job.Error = err
+             job.ErrorCode = ErrCodeTimeout
+             s.setStatus(job, "timed_out")
         } else {
-             job.Status = "failed"
              job.Error = err
+             job.ErrorCode = classifyError(err)
+             s.setStatus(job, "failed")
         }
     } else {
-        job.Status = "completed"
         job.Progress = 100
         job.Result = result
+        s.setStatus(job, "completed")
     }
 }
 
+// failJob marks a job as failed and removes its working directory.
+func (s *Service) failJob(job *Job, dir string, err error) {
+    _ = os.RemoveAll(dir)
+
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
+
+    job.cancelFunc = nil
+    if job.Status == "cancelled" {
+        return
+    }
+    job.Error = err
+    job.ErrorCode = classifyError(err)
+    s.setStatus(job, "failed")
+}
+
 // CancelJob attempts to cancel a running or queued job.
 func (s *Service) CancelJob(jobID string) error {
     s.jobsMu.Lock()
     defer s.jobsMu.Unlock()
 
-    job, ok := s.jobs[jobID]
+    job, ok := s.store.Get(jobID)
     if !ok {
         return fmt.Errorf("job not found")
     }
 
-    if job.Status == "completed" || job.Status == "failed" {
-        return fmt.Errorf("job already finished")
-    }
-
     if job.Status == "cancelled" {
         return nil
     }
 
+    if job.Finished() {
+        return fmt.Errorf("job already finished")
+    }
+
     // If running, cancel the context
     if job.cancelFunc != nil {
         job.cancelFunc()
     }
+    s.queue.remove(job)
 
-    job.Status = "cancelled"
+    job.ErrorCode = ErrCodeCancelled
+    s.setStatus(job, "cancelled")
     return nil
 }
 
-// Upscale performs the actual image upscaling using the external binary.
-func (s *Service) Upscale(ctx context.Context, req Request, onProgress func(int)) (*Result, error) {
-    start := time.Now()
+// SetPriority changes the priority of a queued job.
+func (s *Service) SetPriority(jobID string, priority Priority) error {
+    s.jobsMu.Lock()
+    defer s.jobsMu.Unlock()
 
-    // Validate
-    if err := s.validate(req); err != nil {
-        return nil, fmt.Errorf("validation failed: %w", err)
+    job, ok := s.store.Get(jobID)
+    if !ok {
+        return fmt.Errorf("job not found")
     }
 
-    // Get input size
-    inputSize, err := s.getImageSize(req.InputPath)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get input size: %w", err)
+    if job.Status != "queued" || !s.queue.setPriority(job, priority) {
+        return fmt.Errorf("job is not queued")
     }
 
-    // Build command
-    args := s.buildArgs(req)
+    job.Request.Priority = priority
+    if err := s.store.Put(job); err != nil {
+        log.Printf("Failed to store job %s: %v", job.ID, err)
+    }
+    return nil
+}
 
-    cmd := exec.CommandContext(ctx, s.config.BinaryPath, args...)
+// execution carries the per-job state threaded through a single upscale run.
+type execution struct {
+    // dir is the job directory used for checkpoints; empty for throwaway runs.
+    dir        string
+    device     Device
+    onProgress func(int)
+    onStage    func(string)
+    // onStep reports the progress of the pipeline stage with the given index.
+    onStep     func(index, progress int)
+    onTiles    func(done, total, resumed int)
+    onPlan     func(Plan)
+    // tileSizes are the engine tile sizes of the models of the request, set
+    // by runAttempts; models without one use Request.TileSize.
+    tileSizes  map[string]int
+}
 
-    // Capture stderr for progress
-    stderr, err := cmd.StderrPipe()
-    if err != nil {
-        return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+// tileSize returns the engine tile size for a model of the request.
+func (e execution) tileSize(req Request, model string) int {
+    if size, ok := e.tileSizes[model]; ok {
+        return size
     }
+    return req.TileSize
+}
 
-    if err := cmd.Start(); err != nil {
-        return nil, fmt.Errorf("failed to start command: %w", err)
+// progress reports overall progress in percent.
+func (e execution) progress(p int) {
+    if e.onProgress != nil {
+        e.onProgress(p)
     }
+}
 
-    // Parse progress in a goroutine
-    var wg sync.WaitGroup
-    wg.Add(1)
-    go func() {
-        defer wg.Done()
+// stage reports that the run reached a new step.
+func (e execution) stage(name string) {
+    if e.onStage != nil {
+        e.onStage(name)
+    }
+}
 
-        scanner := bufio.NewScanner(stderr)
-        scanner.Split(bufio.ScanLines)
+// step reports the progress of a pipeline stage in percent.
+func (e execution) step(index, p int) {
+    if e.onStep != nil {
+        e.onStep(index, p)
+    }
+}
 
-        for scanner.Scan() {
-            line := scanner.Text()
-            // Debug: Log binary output
-            fmt.Println("Upscaler Output:", line)
+// tiles reports split-and-stitch progress.
+func (e execution) tiles(done, total, resumed int) {
+    if e.onTiles != nil {
+        e.onTiles(done, total, resumed)
+    }
+}
 
-            // Format is typically "23.45%"
-            if strings.Contains(line, "%") {
-                line = strings.TrimSpace(line)
-                line = strings.TrimSuffix(line, "%")
+// plan reports the execution plan once it is known.
+func (e execution) plan(p Plan) {
+    if e.onPlan != nil {
+        e.onPlan(p)
+    }
+}
 
-                var percent float64
-                if _, err := fmt.Sscanf(line, "%f", &percent); err == nil {
-                    if onProgress != nil {
-                        onProgress(int(percent))
-                    }
-                }
-            }
-        }
-    }()
+// Upscale performs the actual image upscaling using the engine that serves the requested model.
+func (s *Service) Upscale(ctx context.Context, req Request, onProgress func(int)) (*Result, error) {
+    return s.upscale(ctx, req, execution{device: s.devices[0], onProgress: onProgress})
+}
+
+// upscale runs a request within the given execution.
+func (s *Service) upscale(ctx context.Context, req Request, exec execution) (*Result, error) {
+    if len(req.Pipeline) > 0 {
+        return s.runPipeline(ctx, req, exec)
+    }
+
+    start := time.Now()
+
+    // Validate
+    engine, model, err := s.validate(req)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
 
-    // Wait for completion
-    if err := cmd.Wait(); err != nil {
-        return nil, fmt.Errorf("upscale failed: %w", err)
+    // Get input size
+    inputSize, err := s.getImageSize(req.InputPath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get input size: %w", err)
     }
 
-    wg.Wait()
+    plan, err := planRequest(inputSize, req, model, s.supportedScales(engine, model))
+    if err != nil {
+        return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+    }
+    if format := outputFormat(req.OutputPath, req.Format); plan.ResizeTo != nil && !canEncode(format) {
+        return nil, fmt.Errorf("%w: %s output cannot be combined with resizing, use png or jpg", ErrInvalidRequest, format)
+    }
+    exec.plan(plan)
+
+    task := Task{
+        InputPath:  req.InputPath,
+        OutputPath: req.OutputPath,
+        ModelName:  model,
+        TileSize:   exec.tileSize(req, req.ModelName),
+        Format:     req.Format,
+        Device:     exec.device,
+        Options:    req.Options,
+    }
+
+    if err := s.runPlan(ctx, engine, task, inputSize, plan, exec); err != nil {
+        return nil, err
+    }
 
     // Get output size
     outputSize, err := s.getImageSize(req.OutputPath)
@@ -355,61 +878,23 @@ func (s *Service) Upscale(ctx context.Context, req Request, onProgress func(int)
         InputSize:     inputSize,
         OutputSize:    outputSize,
         FileSizeBytes: stat.Size(),
+        Engine:        engine.Name(),
+        Plan:          plan,
     }, nil
 }
 
-// validate checks if the request parameters and required files are valid.
-func (s *Service) validate(req Request) error {
-    if _, err := os.Stat(s.config.BinaryPath); os.IsNotExist(err) {
-        return fmt.Errorf("upscaler binary not found: %s", s.config.BinaryPath)
-    }
-
+// validate checks if the request parameters and required files are valid
+// and returns the engine and model that will run the request.
+func (s *Service) validate(req Request) (Engine, string, error) {
     if _, err := os.Stat(req.InputPath); os.IsNotExist(err) {
-        return fmt.Errorf("input file not found: %s", req.InputPath)
-    }
-
-    if req.Scale < 2 || req.Scale > 4 {
-        return fmt.Errorf("invalid scale: %d (must be 2, 3, or 4)", req.Scale)
-    }
-
-    modelPath := filepath.Join(s.config.ModelsPath, req.ModelName)
-    if _, err := os.Stat(modelPath); os.IsNotExist(err) {
-        // Try with .param and .bin extensions if directory check fails
-        // RealESRGAN models usually come as .param and .bin files with the same name
-        if _, err := os.Stat(modelPath + ".param"); os.IsNotExist(err) {
-             return fmt.Errorf("model not found: %s", req.ModelName)
-        }
-    }
-
-    return nil
-}
-
-// buildArgs constructs the command-line arguments for the upscaler binary.
-func (s *Service) buildArgs(req Request) []string {
-    args := []string{
-        "-i", req.InputPath,
-        "-o", req.OutputPath,
-        "-s", fmt.Sprintf("%d", req.Scale),
-        "-m", s.config.ModelsPath,
-        "-n", req.ModelName,
-        "-j", s.config.Threads,
-    }
-
-    if req.TileSize > 0 {
-        args = append(args, "-t", fmt.Sprintf("%d", req.TileSize))
-    }
-
-    if !s.config.EnableGPU {
-        args = append(args, "-g", "-1")
-    } else if s.config.GPUID >= 0 {
-        args = append(args, "-g", fmt.Sprintf("%d", s.config.GPUID))
+        return nil, "", fmt.Errorf("input file not found: %s", req.InputPath)
     }
 
-    if req.Format != "" {
-        args = append(args, "-f", req.Format)
+    if err := validateScale(req); err != nil {
+        return nil, "", err
     }
 
-    return args
+    return s.resolveEngine(req.ModelName)
 }
 
 // getImageSize uses Go's image library to get image dimensions.
@@ -428,64 +913,43 @@ func (s *Service) getImageSize(path string) (ImageSize, error) {
     return ImageSize{Width: cfg.Width, Height: cfg.Height}, nil
 }
 
-// GetAvailableModels scans the models directory and returns a list of installed models.
+// GetAvailableModels returns the models of all registered engines from the
+// model catalogue, described by their manifests where available. Engines whose
+// models cannot be listed (e.g. missing models directory) are skipped so the
+// built-in engines remain usable.
 func (s *Service) GetAvailableModels() ([]ModelInfo, error) {
-    entries, err := os.ReadDir(s.config.ModelsPath)
-    if err != nil {
-        return nil, err
+    c := s.catalogue()
+    models := c.available()
+    if len(models) == 0 && c.listErr != nil {
+        return nil, c.listErr
     }
-
-    models := make([]ModelInfo, 0)
-    seen := make(map[string]bool)
-
-    for _, entry := range entries {
-        // Filter for .param or .bin or directories
-        name := entry.Name()
-        modelName := name
-
-        // If file, strip extension to get model name
-        if !entry.IsDir() {
-            ext := filepath.Ext(name)
-            if ext == ".param" || ext == ".bin" {
-                modelName = name[0 : len(name)-len(ext)]
-            } else {
-                continue
-            }
-        }
-
-        if seen[modelName] {
-            continue
-        }
-        seen[modelName] = true
-
-        info := ModelInfo{
-            Name:            modelName,
-            SupportedScales: []int{2, 3, 4},
-        }
-
-        switch modelName {
-        case "realesrgan-x4plus":
-            info.Description = "General purpose 4x upscaling for photos"
-        case "realesrgan-x4plus-anime":
-            info.Description = "Optimized for anime and illustrations"
-            info.SupportedScales = []int{4}
-        case "realesr-animevideov3":
-            info.Description = "Anime/video optimized with 2x/3x/4x support"
-        default:
-            info.Description = "Custom model"
-        }
-
-        models = append(models, info)
-    }
-
     return models, nil
 }
 
 // ModelInfo describes the capabilities of an AI model.
 type ModelInfo struct {
-    Name            string `json:"name"`
-    Description     string `json:"description"`
-    SupportedScales []int  `json:"supported_scales"`
+    Name                string        `json:"name"`
+    DisplayName         string        `json:"display_name,omitempty"`
+    Description         string        `json:"description"`
+    Engine              string        `json:"engine"`
+    NativeScale         int           `json:"native_scale,omitempty"`
+    SupportedScales     []int         `json:"supported_scales"`
+    ContentType         string        `json:"content_type,omitempty"`
+    License             string        `json:"license,omitempty"`
+    RecommendedTileSize int           `json:"recommended_tile_size,omitempty"`
+    Default             bool          `json:"default,omitempty"`
+    // Options lists the engine-specific options the model accepts.
+    Options             *ModelOptions `json:"options,omitempty"`
+    // Available is false if the model files are missing, truncated or do not
+    // match the manifest; Problem explains why.
+    Available           bool          `json:"available"`
+    Problem             string        `json:"problem,omitempty"`
+    // ChecksumVerified is true if the manifest lists the SHA-256 of every
+    // file of the model and they matched. Otherwise only the presence and
+    // sizes of the files were checked.
+    ChecksumVerified    bool          `json:"checksum_verified"`
+    // files are the paths of the files the model needs.
+    files               []string
 }
 
 // copyFile copies a file from src to dst preserving mode where possible.
@@ -515,7 +979,40 @@ func copyFile(src, dst string) error {
     return nil
 }
 
-// generateJobID creates a unique identifier for a job based on the current timestamp.
-func generateJobID() string {
-    return fmt.Sprintf("%d", time.Now().UnixNano())
+// defaultWorkDir returns ~/.mlcupscale/tmp, or a directory below the system
+// temp dir if the home directory cannot be determined.
+func defaultWorkDir() string {
+    homeDir, err := os.UserHomeDir()
+    if err != nil {
+        homeDir = os.TempDir()
+    }
+    return filepath.Join(homeDir, ".mlcupscale", "tmp")
+}
+
+// tempDir creates a new temporary directory below the work directory.
+func (s *Service) tempDir(pattern string) (string, error) {
+    if err := os.MkdirAll(s.config.WorkDir, 0755); err != nil {
+        return "", err
+    }
+    return os.MkdirTemp(s.config.WorkDir, pattern)
+}
+
+// newJobID generates a random job ID that is neither in use nor tombstoned.
+// The caller must hold jobsMu.
+func (s *Service) newJobID() (string, error) {
+    for i := 0; i < 3; i++ {
+        id := ids.New()
+        if !s.jobIDUsed(id) {
+            return id, nil
+        }
+    }
+    return "", fmt.Errorf("failed to generate a unique job ID")
+}
+
+// jobIDUsed reports whether a job or a tombstone has the ID. The caller must
+// hold jobsMu.
+func (s *Service) jobIDUsed(id string) bool {
+    _, used := s.store.Get(id)
+    _, buried := s.store.Tombstone(id)
+    return used || buried
 }
\ No newline at end of file
@@ -0,0 +1,78 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"errors"
+	"testing"
+
+	"upscale-service/internal/ids"
+)
+
+func TestSubmitJobID(t *testing.T) {
+    s, dir := newModelsService(t, Config{})
+    writeModel(t, dir, "realesrgan-x4plus")
+
+    req := Request{InputPath: "in.png", ModelName: "realesrgan-x4plus", Scale: 2}
+
+    id, err := s.SubmitJob(req)
+    if err != nil || !ids.Valid(id) {
+        t.Fatalf("SubmitJob() = %q, %v, want a new valid ID", id, err)
+    }
+
+    req.JobID = ids.New()
+    got, err := s.SubmitJob(req)
+    if err != nil || got != req.JobID {
+        t.Fatalf("SubmitJob() with JobID = %q, %v, want %q", got, err, req.JobID)
+    }
+
+    for _, jobID := range []string{req.JobID, "not-an-id"} {
+        req.JobID = jobID
+        if _, err := s.SubmitJob(req); !errors.Is(err, ErrInvalidRequest) {
+            t.Errorf("SubmitJob() with JobID %q: err = %v, want ErrInvalidRequest", jobID, err)
+        }
+    }
+}
+
+func TestGetJobSnapshot(t *testing.T) {
+    s, dir := newModelsService(t, Config{})
+    writeModel(t, dir, "realesrgan-x4plus")
+
+    id, err := s.SubmitJob(Request{InputPath: "in.png", ModelName: "realesrgan-x4plus", Scale: 2, BatchID: "batch"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    job, _ := s.store.Get(id)
+
+    s.jobsMu.Lock()
+    job.Pipeline = []StageProgress{{Type: StageUpscale}}
+    job.Attempts = []Attempt{{Number: 1}}
+    s.jobsMu.Unlock()
+
+    snap, ok := s.GetJob(id)
+    if !ok || snap == job {
+        t.Fatalf("GetJob() = %p, %v, want a copy of %p", snap, ok, job)
+    }
+    batch, ok := s.GetBatch("batch")
+    if !ok || batch.Jobs[0] == job {
+        t.Fatalf("GetBatch() jobs = %v, %v, want copies", batch, ok)
+    }
+
+    // The running job moves on, the snapshots do not
+    s.jobsMu.Lock()
+    job.Progress = 50
+    job.Pipeline[0].Progress = 50
+    job.Attempts = append(job.Attempts, Attempt{Number: 2})
+    s.jobsMu.Unlock()
+
+    for _, got := range []*Job{snap, batch.Jobs[0]} {
+        if got.Progress != 0 || got.Pipeline[0].Progress != 0 || len(got.Attempts) != 1 {
+            t.Errorf("snapshot changed with the job: progress %d, stage progress %d, %d attempts",
+                got.Progress, got.Pipeline[0].Progress, len(got.Attempts))
+        }
+    }
+    if pos := s.QueuePosition(id); pos != 1 {
+        t.Errorf("QueuePosition() = %d, want 1", pos)
+    }
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2026 Michael Lechner
+// MIT License
+
+package upscaler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// waifu2xPrefix is prepended to the model directory names to form the model
+// names.
+const waifu2xPrefix = "waifu2x-"
+
+// waifu2xScaleFile matches the 2x model files of a waifu2x model directory,
+// e.g. "noise1_scale2.0x_model.param" or "scale2.0x_model.param".
+var waifu2xScaleFile = regexp.MustCompile(`^(?:noise([0-9])_)?scale2\.0x_model\.param$`)
+
+// waifu2xScales are the scales waifu2x-ncnn-vulkan reaches by repeating its
+// 2x model.
+var waifu2xScales = []int{2, 4, 8, 16, 32}
+
+// waifu2xEngine runs the external waifu2x-ncnn-vulkan binary. Each "models-*"
+// directory below the models path is a model, e.g. models-cunet is served as
+// "waifu2x-cunet".
+type waifu2xEngine struct {
+    config EngineConfig
+}
+
+// NewWaifu2xEngine creates an engine that shells out to waifu2x-ncnn-vulkan.
+func NewWaifu2xEngine(cfg EngineConfig) Engine {
+    if cfg.Name == "" {
+        cfg.Name = EngineWaifu2x
+    }
+    return &waifu2xEngine{config: cfg}
+}
+
+// Name returns the engine identifier.
+func (e *waifu2xEngine) Name() string {
+    return e.config.Name
+}
+
+// Capabilities describes the features of the ncnn binary.
+func (e *waifu2xEngine) Capabilities() Capabilities {
+    return Capabilities{
+        GPU:      true,
+        TileSize: true,
+        Formats:  []string{"png", "jpg", "webp"},
+    }
+}
+
+// Available checks that the binary exists.
+func (e *waifu2xEngine) Available() error {
+    return binaryAvailable(e.config.BinaryPath)
+}
+
+// Models returns a model for every model directory that contains 2x models.
+func (e *waifu2xEngine) Models() ([]ModelInfo, error) {
+    dirs, err := modelDirs(e.config.ModelsPath)
+    if err != nil {
+        return nil, err
+    }
+
+    models := make([]ModelInfo, 0, len(dirs))
+    for _, dir := range dirs {
+        path := e.modelDir(waifu2xPrefix + dir)
+        levels := e.scan(path)
+        if len(levels) == 0 {
+            continue
+        }
+
+        // Manifests describe known models, see registry.go
+        info := ModelInfo{
+            Name:            waifu2xPrefix + dir,
+            Description:     "Custom waifu2x model",
+            Engine:          e.Name(),
+            SupportedScales: waifu2xScales,
+            Options: &ModelOptions{
+                DenoiseLevels:  levels,
+                DefaultDenoise: intPtr(waifu2xDefaultDenoise(levels)),
+                TTA:            true,
+            },
+            files: pairFiles(path),
+        }
+
+        models = append(models, info)
+    }
+
+    return models, nil
+}
+
+// SupportedScales returns the scales of a model.
+func (e *waifu2xEngine) SupportedScales(model string) []int {
+    if len(e.scan(e.modelDir(model))) == 0 {
+        return nil
+    }
+    return waifu2xScales
+}
+
+// Run executes the binary for a single task and parses its progress output.
+func (e *waifu2xEngine) Run(ctx context.Context, task Task, onProgress func(int)) error {
+    if err := e.Available(); err != nil {
+        return err
+    }
+
+    args, err := e.buildArgs(task)
+    if err != nil {
+        return err
+    }
+    return runBinary(ctx, e.config.BinaryPath, args, parseWaifu2xProgress, onProgress)
+}
+
+// buildArgs constructs the command-line arguments for waifu2x-ncnn-vulkan.
+func (e *waifu2xEngine) buildArgs(task Task) ([]string, error) {
+    dir := e.modelPath(task)
+
+    levels := e.scan(dir)
+    noise := waifu2xDefaultDenoise(levels)
+    if task.Options.Denoise != nil {
+        noise = *task.Options.Denoise
+    }
+    if !slices.Contains(levels, noise) {
+        return nil, fmt.Errorf("%w: model %s has no model for denoise level %d", ErrInvalidRequest, task.ModelName, noise)
+    }
+
+    args := []string{
+        "-i", task.InputPath,
+        "-o", task.OutputPath,
+        "-s", fmt.Sprintf("%d", task.Scale),
+        "-n", fmt.Sprintf("%d", noise),
+        "-m", dir,
+    }
+
+    if e.config.Threads != "" {
+        args = append(args, "-j", e.config.Threads)
+    }
+
+    if task.TileSize > 0 {
+        args = append(args, "-t", fmt.Sprintf("%d", task.TileSize))
+    }
+
+    args = append(args, deviceArgs(task.Device)...)
+
+    if task.Options.TTA {
+        args = append(args, "-x")
+    }
+
+    if task.Format != "" {
+        args = append(args, "-f", task.Format)
+    }
+
+    return args, nil
+}
+
+// modelDir returns the directory of a model below the models path.
+func (e *waifu2xEngine) modelDir(model string) string {
+    return filepath.Join(e.config.ModelsPath, "models-"+strings.TrimPrefix(model, waifu2xPrefix))
+}
+
+// modelPath returns the directory holding the model files of a task.
+func (e *waifu2xEngine) modelPath(task Task) string {
+    if task.ModelDir != "" {
+        return task.ModelDir
+    }
+    return e.modelDir(task.ModelName)
+}
+
+// scan returns the sorted denoise levels of the 2x model files in a model
+// directory; -1 is the model without denoising.
+func (e *waifu2xEngine) scan(dir string) []int {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil
+    }
+
+    var levels []int
+    for _, entry := range entries {
+        m := waifu2xScaleFile.FindStringSubmatch(entry.Name())
+        if m == nil {
+            continue
+        }
+        level := -1
+        if m[1] != "" {
+            level, _ = strconv.Atoi(m[1])
+        }
+        if !slices.Contains(levels, level) {
+            levels = append(levels, level)
+        }
+    }
+
+    slices.Sort(levels)
+    return levels
+}
+
+// waifu2xDefaultDenoise returns the denoise level used when a request does
+// not set one: 0 like the binary, or the lowest level the model has.
+func waifu2xDefaultDenoise(levels []int) int {
+    if len(levels) == 0 || slices.Contains(levels, 0) {
+        return 0
+    }
+    return levels[0]
+}
+
+// parseWaifu2xProgress extracts a progress value from a waifu2x output line.
+// Besides percentages the binary reports finished images as
+// "input -> output done", which counts as 100%.
+func parseWaifu2xProgress(line string) (int, bool) {
+    if strings.HasSuffix(strings.TrimSpace(line), " done") {
+        return 100, true
+    }
+    return parsePercent(line)
+}